@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"interviews-ai/internal/admin"
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/realtimetest"
+)
+
+const adminToken = "secret"
+
+// adminRequest calls the admin API and decodes the JSON response into out, if given.
+func adminRequest(t *testing.T, server *httptest.Server, method string, path string, body string, token string, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func newAdminServer(t *testing.T, h *harness) *httptest.Server {
+	mux := http.NewServeMux()
+	admin.New(h.hub, adminToken).Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	server := newAdminServer(t, h)
+
+	for _, token := range []string{"", "wrong"} {
+		if status := adminRequest(t, server, "GET", "/admin/sessions", "", token, nil); status != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, status)
+		}
+	}
+}
+
+func TestAdminInspectsAndControlsSessions(t *testing.T) {
+	h := newHarness(t, harnessOptions{upstream: realtimetest.Options{
+		Script: []realtimetest.ScriptedResponse{{Transcript: "Let us talk about your last project."}},
+	}})
+	server := newAdminServer(t, h)
+	b := h.connect()
+
+	var list struct {
+		Sessions []admin.SessionView `json:"sessions"`
+	}
+	if status := adminRequest(t, server, "GET", "/admin/sessions", "", adminToken, &list); status != http.StatusOK {
+		t.Fatalf("list status = %d", status)
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0].ID != b.sessionId || list.Sessions[0].State != ai.SessionActive {
+		t.Fatalf("sessions = %+v, want the active session %s", list.Sessions, b.sessionId)
+	}
+	if list.Sessions[0].LastEvent == "" || list.Sessions[0].DurationSeconds <= 0 {
+		t.Errorf("session = %+v, want a last event and a duration", list.Sessions[0])
+	}
+
+	if status := adminRequest(t, server, "GET", "/admin/sessions/nope", "", adminToken, nil); status != http.StatusNotFound {
+		t.Errorf("unknown session status = %d, want 404", status)
+	}
+
+	// an injected message reaches the model, which answers it
+	body := `{"text": "Move on to the system design question.", "respond": true}`
+	if status := adminRequest(t, server, "POST", "/admin/sessions/"+b.sessionId+"/message", body, adminToken, nil); status != http.StatusAccepted {
+		t.Fatalf("message status = %d, want 202", status)
+	}
+	if !h.upstream.WaitFor("conversation.item.create", waitTimeout) {
+		t.Fatal("upstream did not receive the system message")
+	}
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive the response to the system message")
+	}
+
+	var detail admin.SessionView
+	adminRequest(t, server, "GET", "/admin/sessions/"+b.sessionId, "", adminToken, &detail)
+	if detail.Usage.Responses != 1 || len(detail.Transcript) != 1 {
+		t.Errorf("session = %+v, want one response in usage and transcript", detail)
+	}
+
+	if status := adminRequest(t, server, "POST", "/admin/sessions/"+b.sessionId+"/message", `{"text": ""}`, adminToken, nil); status != http.StatusBadRequest {
+		t.Errorf("empty message status = %d, want 400", status)
+	}
+
+	if status := adminRequest(t, server, "POST", "/admin/sessions/"+b.sessionId+"/terminate", "", adminToken, nil); status != http.StatusAccepted {
+		t.Fatalf("terminate status = %d, want 202", status)
+	}
+	if !b.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed")
+	}
+	waitUntil(t, "session removed", func() bool { return h.hub.Len() == 0 })
+	if status := adminRequest(t, server, "POST", "/admin/sessions/"+b.sessionId+"/terminate", "", adminToken, nil); status != http.StatusNotFound {
+		t.Errorf("terminating an ended session: status = %d, want 404", status)
+	}
+}
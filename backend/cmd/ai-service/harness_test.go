@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/realtimetest"
+	"interviews-ai/internal/ai/templates"
+	"interviews-ai/internal/ai/tools"
+	"interviews-ai/internal/common/middleware"
+	"interviews-ai/internal/ratelimit"
+
+	"github.com/gorilla/websocket"
+)
+
+// harness runs the ai-service websocket handler against a mock Realtime upstream.
+type harness struct {
+	t        *testing.T
+	upstream *realtimetest.Server
+	hub      *ai.Hub
+	usage    *ai.MemoryUsageStore
+	server   *httptest.Server
+
+	mu     sync.Mutex
+	events []ai.HubEvent
+	notify chan struct{}
+}
+
+// harnessOptions configure newHarness; the zero value runs the handler against a
+// mock upstream with no limits and no tools.
+type harnessOptions struct {
+	// upstream configures the mock upstream, which always records what it receives.
+	upstream realtimetest.Options
+	// config selects the mock upstream unless it names another provider.
+	config *ai.Config
+	// limits, if set, are enforced with a limiter kept in memory.
+	limits *ratelimit.Config
+	// tools are offered to the model, none by default.
+	tools *tools.Registry
+	// configure, if set, adjusts the settings before any session starts.
+	configure func(*settings)
+	// settings, if set, give the settings for each new session in place of those
+	// built from config, limits and configure.
+	settings func() *settings
+}
+
+// newHarness runs the ai-service websocket handler as opts describe.
+func newHarness(t *testing.T, opts harnessOptions) *harness {
+	t.Helper()
+
+	opts.upstream.Record = true
+	upstream := realtimetest.NewServer(opts.upstream)
+	t.Cleanup(upstream.Close)
+
+	current := opts.settings
+	if current == nil {
+		config := opts.config
+		if config == nil {
+			config = &ai.Config{}
+		}
+		if config.Provider == "" {
+			config.Provider, config.Endpoint = ai.ProviderMock, upstream.URL()
+		}
+		provider, err := ai.NewProvider(config)
+		if err != nil {
+			t.Fatalf("NewProvider: %v", err)
+		}
+		fixed := &settings{config: config, provider: provider, templates: templates.Instructions}
+		if opts.limits != nil {
+			fixed.limiter = ratelimit.New(ratelimit.NewMemoryBackend(), *opts.limits)
+		}
+		if opts.configure != nil {
+			opts.configure(fixed)
+		}
+		current = func() *settings { return fixed }
+	}
+	registry := opts.tools
+	if registry == nil {
+		registry = tools.NewRegistry(tools.DefaultTimeout)
+	}
+
+	h := &harness{
+		t:        t,
+		upstream: upstream,
+		hub:      ai.NewHub(),
+		usage:    ai.NewMemoryUsageStore(),
+		notify:   make(chan struct{}),
+	}
+	h.hub.Observer = h.observe
+
+	h.server = httptest.NewServer(http.HandlerFunc(middleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+		handleWs(w, r, h.hub, current(), registry, nil, h.usage)
+	}, middleware.AuthMiddleware)))
+
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+func (h *harness) observe(event ai.HubEvent) {
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	close(h.notify)
+	h.notify = make(chan struct{})
+	h.mu.Unlock()
+}
+
+// hubEvents returns the hub events recorded for the session of clientId, in order.
+func (h *harness) hubEvents(clientId string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var kinds []string
+	for _, event := range h.events {
+		if event.ClientId == clientId {
+			kinds = append(kinds, event.Kind)
+		}
+	}
+	return kinds
+}
+
+// waitForHubEvent blocks until the hub reports kind for the session of clientId.
+func (h *harness) waitForHubEvent(clientId string, kind string, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		h.mu.Lock()
+		for _, event := range h.events {
+			if event.ClientId == clientId && event.Kind == kind {
+				h.mu.Unlock()
+				return true
+			}
+		}
+		notify := h.notify
+		h.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// browser is a fake frontend connected to the service.
+type browser struct {
+	t         *testing.T
+	conn      *websocket.Conn
+	clientId  string
+	sessionId string
+}
+
+// connect opens a browser connection and waits for the upstream session to be created.
+func (h *harness) connect() *browser {
+	h.t.Helper()
+	return h.connectQuery("")
+}
+
+// connectQuery is connect with query parameters added to the websocket URL.
+func (h *harness) connectQuery(query string) *browser {
+	h.t.Helper()
+	b, err := h.dialQuery(query)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if b.waitFor("session.created", 5*time.Second) == nil {
+		h.t.Fatal("browser did not receive session.created")
+	}
+	return b
+}
+
+// dial opens a browser connection without waiting for any event.
+// It is safe to call from goroutines other than the test's.
+func (h *harness) dial() (*browser, error) {
+	return h.dialQuery("")
+}
+
+// dialQuery is dial with query parameters added to the websocket URL.
+func (h *harness) dialQuery(query string) (*browser, error) {
+	url := "ws" + strings.TrimPrefix(h.server.URL, "http") + "/ws"
+	if query != "" {
+		url += "?" + query
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial service: %v", err)
+	}
+	h.t.Cleanup(func() { conn.Close() })
+
+	clientId := resp.Header.Get(clientIdHeader)
+	if clientId == "" {
+		return nil, fmt.Errorf("upgrade response has no %s header", clientIdHeader)
+	}
+	return &browser{t: h.t, conn: conn, clientId: clientId, sessionId: resp.Header.Get(sessionIdHeader)}, nil
+}
+
+func (b *browser) send(event map[string]interface{}) {
+	if err := b.conn.WriteJSON(event); err != nil {
+		b.t.Errorf("browser write: %v", err)
+	}
+}
+
+// sendAudio appends pcm16 audio to the input buffer in 100ms chunks.
+func (b *browser) sendAudio(pcm []byte) {
+	const chunk = 4800
+	for start := 0; start < len(pcm); start += chunk {
+		end := min(start+chunk, len(pcm))
+		b.send(map[string]interface{}{
+			"type":  "input_audio_buffer.append",
+			"audio": base64.StdEncoding.EncodeToString(pcm[start:end]),
+		})
+	}
+}
+
+// waitFor reads events until one of the given type arrives, returning nil on timeout or close.
+func (b *browser) waitFor(eventType string, timeout time.Duration) map[string]interface{} {
+	b.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer b.conn.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := b.conn.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal(message, &event); err != nil {
+			b.t.Errorf("browser received invalid JSON: %s", message)
+			return nil
+		}
+		if event["type"] == eventType {
+			return event
+		}
+	}
+}
+
+// waitForSession reads session.updated events until the session in one satisfies
+// match, failing the test on timeout.
+func (b *browser) waitForSession(match func(session map[string]interface{}) bool) map[string]interface{} {
+	b.t.Helper()
+	for {
+		updated := b.waitFor("session.updated", waitTimeout)
+		if updated == nil {
+			b.t.Fatal("browser did not receive the expected session.updated")
+		}
+		if session, _ := updated["session"].(map[string]interface{}); match(session) {
+			return session
+		}
+	}
+}
+
+// waitClosed reports whether the service closes the browser connection within timeout.
+func (b *browser) waitClosed(timeout time.Duration) bool {
+	b.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		if _, _, err := b.conn.ReadMessage(); err != nil {
+			netErr, ok := err.(interface{ Timeout() bool })
+			return !(ok && netErr.Timeout())
+		}
+	}
+}
+
+// tone returns ms milliseconds of loud pcm16 audio followed by silence.
+func tone(ms int, silenceMs int) []byte {
+	pcm := make([]byte, (ms+silenceMs)*48)
+	for i := 0; i < ms*24; i++ {
+		sample := int16(8000)
+		if i%2 == 0 {
+			sample = -8000
+		}
+		pcm[2*i] = byte(sample)
+		pcm[2*i+1] = byte(sample >> 8)
+	}
+	return pcm
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/health"
+)
+
+var errDraining = errors.New("draining: the service is shutting down")
+
+// newHealthHandler wires the liveness and readiness checks of the service. config
+// reports the result of the last config load; records may be nil when session
+// records are not kept.
+func newHealthHandler(hub *ai.Hub, config health.Check, breaker *ai.Breaker, records ai.RecordStore, draining *atomic.Bool) *health.Handler {
+	ready := map[string]health.Check{
+		"config": config,
+		"upstream": func(ctx context.Context) error {
+			return breaker.Check()
+		},
+		"draining": func(ctx context.Context) error {
+			if draining.Load() {
+				return errDraining
+			}
+			return nil
+		},
+	}
+	if store, ok := records.(*ai.FileRecordStore); ok {
+		ready["storage"] = func(ctx context.Context) error {
+			return store.Check()
+		}
+	}
+
+	return &health.Handler{
+		Live: map[string]health.Check{
+			"hub": hub.Ping,
+		},
+		Ready: ready,
+	}
+}
+
+// drain waits up to timeout for the live sessions to end on their own, then closes
+// the rest and waits for them to be torn down.
+func drain(hub *ai.Hub, timeout time.Duration) {
+	slog.Info("Draining sessions", "sessions", hub.Len(), "timeout", timeout)
+	deadline := time.Now().Add(timeout)
+	for hub.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := hub.Len(); n > 0 {
+		slog.Warn("Closing sessions still live after the drain timeout", "sessions", n)
+		hub.CloseAll()
+		for end := time.Now().Add(5 * time.Second); hub.Len() > 0 && time.Now().Before(end); {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/health"
+)
+
+func probe(t *testing.T, server *httptest.Server, path string) (int, health.Response) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body health.Response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("%s: decode response: %v", path, err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestHealthProbes(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	records, err := ai.NewFileRecordStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaker := ai.NewBreaker(ai.BreakerConfig{Threshold: 1, Cooldown: time.Hour})
+	var draining atomic.Bool
+	var reloadErr error
+
+	mux := http.NewServeMux()
+	config := func(ctx context.Context) error { return reloadErr }
+	newHealthHandler(h.hub, config, breaker, records, &draining).Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	if status, body := probe(t, server, "/healthz"); status != http.StatusOK || body.Checks["hub"] != "ok" {
+		t.Errorf("/healthz = %d %+v, want 200 with a passing hub check", status, body)
+	}
+	status, body := probe(t, server, "/readyz")
+	if status != http.StatusOK {
+		t.Errorf("/readyz = %d %+v, want 200", status, body)
+	}
+	for _, check := range []string{"config", "upstream", "storage", "draining"} {
+		if body.Checks[check] != "ok" {
+			t.Errorf("readiness check %s = %q, want ok", check, body.Checks[check])
+		}
+	}
+
+	// a failed config reload
+	reloadErr = errors.New("session.temperature must be between 0.6 and 1.2")
+	if status, body := probe(t, server, "/readyz"); status != http.StatusServiceUnavailable || body.Checks["config"] == "ok" {
+		t.Errorf("/readyz after a failed reload = %d %+v, want 503 with a failing config check", status, body)
+	}
+	reloadErr = nil
+
+	// a failed dial opens the circuit
+	breaker.Allow()
+	breaker.Record(context.DeadlineExceeded)
+	if status, body := probe(t, server, "/readyz"); status != http.StatusServiceUnavailable || body.Checks["upstream"] == "ok" {
+		t.Errorf("/readyz with the circuit open = %d %+v, want 503 with a failing upstream check", status, body)
+	}
+
+	draining.Store(true)
+	if status, body := probe(t, server, "/readyz"); status != http.StatusServiceUnavailable || body.Checks["draining"] == "ok" {
+		t.Errorf("/readyz while draining = %d %+v, want 503 with a failing draining check", status, body)
+	}
+	// draining does not make the process unhealthy
+	if status, _ := probe(t, server, "/healthz"); status != http.StatusOK {
+		t.Errorf("/healthz while draining = %d, want 200", status)
+	}
+
+	resp, err := http.Get(server.URL + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var version health.BuildInfo
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil || version.Version == "" || version.GoVersion == "" {
+		t.Errorf("/version = %+v (%v), want a version and a Go version", version, err)
+	}
+}
+
+func TestDrainClosesSessions(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	b := h.connect()
+
+	drain(h.hub, 200*time.Millisecond)
+	if h.hub.Len() != 0 {
+		t.Fatalf("%d sessions left after draining", h.hub.Len())
+	}
+	if !b.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed")
+	}
+}
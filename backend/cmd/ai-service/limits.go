@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/common/middleware"
+	"interviews-ai/internal/config"
+	"interviews-ai/internal/metrics"
+	"interviews-ai/internal/ratelimit"
+
+	"github.com/gorilla/websocket"
+)
+
+// newLimitsBackend returns the backend keeping the counters of the session limits.
+func newLimitsBackend(limits config.LimitsConfig) (ratelimit.Backend, error) {
+	if limits.Backend == config.LimitsBackendRedis {
+		return ratelimit.OpenRedisBackend(limits.RedisURL)
+	}
+	return ratelimit.NewMemoryBackend(), nil
+}
+
+// clientIP returns the IP of the browser, from header when it is set.
+func clientIP(r *http.Request, header string) string {
+	if header != "" {
+		// X-Forwarded-For lists the client first, then each proxy
+		first, _, _ := strings.Cut(r.Header.Get(header), ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// identity is who the limits and budgets count a session of user, connecting from
+// ip, against. Anonymous users can only be told apart by where they connect from.
+func identity(user string, ip string) string {
+	if user == middleware.AnonymousUser {
+		return user + "@" + ip
+	}
+	return user
+}
+
+// admit checks a new session against the limits before it dials upstream. A
+// rejected browser is told why and its connection closed. An admitted session must
+// call release once it ends.
+func admit(r *http.Request, current *settings, session *ai.Session, conn *websocket.Conn) (release func(), ok bool) {
+	if current.limiter == nil {
+		return func() {}, true
+	}
+	ip := clientIP(r, current.clientIPHeader)
+	release, err := current.limiter.Admit(r.Context(), session.ID, identity(session.UserID, ip), ip)
+	if err == nil {
+		return release, true
+	}
+	rejection, ok := ratelimit.IsRejection(err)
+	if !ok {
+		// an unreachable backend must not stop interviews
+		metrics.LimiterErrors.Inc()
+		session.Logger.Error("Failed to check session limits, admitting the session", "error", err)
+		return func() {}, true
+	}
+
+	metrics.SessionsRejected.WithLabelValues(rejection.Reason).Inc()
+	session.Logger.Warn("Session rejected", "reason", rejection.Reason, "ip", ip, "retry_after", rejection.RetryAfter)
+	reject(conn, rejection.Reason, rejection.Error(), rejection.RetryAfter)
+	return nil, false
+}
+
+// admitBudget refuses a session whose user already used up its budget.
+func admitBudget(client *ai.AIClient, session *ai.Session, conn *websocket.Conn) bool {
+	if client.Budget == nil || client.Usage == nil {
+		return true
+	}
+	usage, err := client.Usage.UserUsage(client.UsageKey)
+	if err != nil {
+		// like the limits, a budget that cannot be read does not stop interviews
+		session.Logger.Error("Failed to read user usage, admitting the session", "error", err)
+		return true
+	}
+	now := time.Now()
+	status := client.Budget.Status(usage, now)
+	if status.Share < 1 {
+		return true
+	}
+
+	metrics.SessionsRejected.WithLabelValues(ai.SessionEndBudget).Inc()
+	metrics.BudgetEvents.WithLabelValues("rejected").Inc()
+	session.Logger.Warn("Session rejected", "reason", ai.SessionEndBudget, "plan", client.Budget.Plan, "period", status.Period, "unit", status.Unit)
+	reject(conn, ai.SessionEndBudget, fmt.Sprintf("%s %s budget exceeded", status.Period, status.Unit), status.ResetsAt.Sub(now))
+	return false
+}
+
+// reject tells the browser why its session was refused, and closes its connection.
+func reject(conn *websocket.Conn, reason, message string, retryAfter time.Duration) {
+	conn.WriteJSON(ai.SessionRejectedEvent{
+		Type:         ai.MsgTypeSessionRejected,
+		Reason:       reason,
+		Error:        message,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason))
+	conn.Close()
+}
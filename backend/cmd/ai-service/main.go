@@ -1,39 +1,61 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"interviews-ai/internal/admin"
 	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/templates"
+	"interviews-ai/internal/ai/tools"
+	"interviews-ai/internal/ai/tools/sandbox"
 
 	"interviews-ai/internal/ai/types"
+	"interviews-ai/internal/common/middleware"
+	"interviews-ai/internal/config"
+	"interviews-ai/internal/logging"
+	"interviews-ai/internal/metrics"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-func handleWs(w http.ResponseWriter, r *http.Request, hub *ai.Hub, config *ai.Config) {
+const (
+	clientIdHeader  = "X-Client-Id"
+	sessionIdHeader = "X-Session-Id"
+)
 
-	log.Println("Incoming websocket connection")
+func handleWs(w http.ResponseWriter, r *http.Request, hub *ai.Hub, current *settings, registry *tools.Registry, records ai.RecordStore, usage ai.UsageStore) {
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true // bad
 		},
 	}
 
-	clientConn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Fatalf("Error upgrading client's http request to a websocket connection: %v", err)
+	template := r.URL.Query().Get("template")
+	if template == "" {
+		template = templates.DefaultTemplate
+	}
+	config, provider := current.config, current.provider
+	instructions, ok := current.templates[template]
+	if !ok {
+		metrics.Upgrades.WithLabelValues("rejected").Inc()
+		http.Error(w, fmt.Sprintf("unknown template %q", template), http.StatusBadRequest)
 		return
 	}
 
-	// establish a websocket connection with the AI endpoint
-	aiClientConn, err := ai.CreateAIWebSocketConnection(config)
-	if err != nil {
-		log.Fatalf("Error establishing websocket connection with AI endpoint %v", err)
-		return
+	sendBuffer := config.SendBuffer
+	if sendBuffer <= 0 {
+		sendBuffer = ai.DefaultSendBuffer
 	}
 
 	// get a unique identifier
@@ -43,46 +65,192 @@ func handleWs(w http.ResponseWriter, r *http.Request, hub *ai.Hub, config *ai.Co
 	client := &ai.Client{
 		ClientId:   clientId,
 		AiClientId: aiClientId,
-		Conn:       clientConn,
 		Hub:        hub,
-		Send:       make(chan types.Message, 1024),
+		Send:       make(chan types.Message, sendBuffer),
 	}
 
 	aiClient := &ai.AIClient{
 		ClientId:   clientId,
 		AiClientId: aiClientId,
-		Conn:       aiClientConn,
 		Hub:        hub,
-		Send:       make(chan types.Message, 1024),
+		Send:       make(chan types.Message, sendBuffer),
+		Tools:      registry,
+		Provider:   provider,
+		Records:    records,
+		Config:     config,
 	}
 
-	hub.RegisterClient <- client
-	hub.RegisterAIClient <- aiClient
+	// the session outlives the request, so it is not derived from r.Context()
+	session := ai.NewSession(context.Background(), hub, client, aiClient)
+	session.UserID = middleware.UserID(r.Context())
+	aiClient.Usage = usage
+	aiClient.UsageKey = identity(session.UserID, clientIP(r, current.clientIPHeader))
+	if current.budget != nil {
+		aiClient.Budget = current.budget(session.UserID)
+	}
+	session.Template = template
+	session.Logger.Info("Incoming websocket connection", "user_id", session.UserID, "template", template)
 
-	go client.ClientReadPump()
-	go client.ClientWritePump()
-	go aiClient.AiClientReadPump()
-	go aiClient.AiClientWritePump()
+	// the ids let the browser correlate its connection with server logs
+	header := http.Header{
+		clientIdHeader:  []string{clientId},
+		sessionIdHeader: []string{session.ID},
+	}
+	clientConn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		metrics.Upgrades.WithLabelValues("rejected").Inc()
+		session.Logger.Warn("Failed to upgrade client request to a websocket connection", "error", err)
+		return
+	}
+	metrics.Upgrades.WithLabelValues("accepted").Inc()
+	if config.MaxMessageBytes > 0 {
+		clientConn.SetReadLimit(config.MaxMessageBytes)
+	}
+	client.Conn = clientConn
 
+	// limits are checked before dialing, so a rejected session costs nothing upstream
+	if !admitBudget(aiClient, session, clientConn) {
+		return
+	}
+	release, ok := admit(r, current, session, clientConn)
+	if !ok {
+		return
+	}
+	go func() {
+		<-session.Done()
+		release()
+	}()
+
+	// establish a websocket connection with the AI endpoint
+	err = session.Connect(func() (ai.UpstreamConn, error) {
+		return ai.CreateAIWebSocketConnection(config, provider, registry, instructions)
+	})
+	if err != nil {
+		clientConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "AI service unavailable"))
+		clientConn.Close()
+		return
+	}
 }
 
 func main() {
+	cfg, options, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// the logger is not configured yet, and the errors span several lines
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if options.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fatal("Error printing config", err)
+		}
+		return
+	}
+	logging.Setup(cfg.LogConfig())
+	if options.File != "" {
+		slog.Info("Loaded config file", "path", options.File)
+	}
+	aiConfig := cfg.AI()
 
-	config, configErr := ai.LoadConfig()
-	if configErr != nil {
-		log.Fatal("Error loading config: ", configErr)
+	shutdownTracing, err := ai.SetupTracing(context.Background(), aiConfig.Tracing)
+	if err != nil {
+		fatal("Error setting up tracing", err)
 	}
-	hub := ai.NewHub()
-	go hub.Run()
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handleWs(w, r, hub, config)
-	})
+	defer shutdownTracing(context.Background())
 
-	log.Printf("Starting new socket server on port 5555")
-	err := http.ListenAndServe(":5555", nil)
+	// stop dialing an upstream that keeps failing
+	breaker := ai.NewBreaker(aiConfig.Breaker)
+	// the counters behind the session limits, shared between instances with redis
+	limits, err := newLimitsBackend(cfg.Limits)
 	if err != nil {
-		log.Fatalln("Unexpected serve error: ", err)
+		fatal("Error creating the limits backend", err)
 	}
+	// new sessions use the latest valid config and templates
+	reloader, err := newReloader(os.Args[1:], cfg, options, breaker, limits)
+	if err != nil {
+		fatal("Error loading session settings", err)
+	}
+	slog.Info("Using realtime provider", "provider", reloader.settings().provider.Name())
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloader.watch(context.Background(), cfg.Reload.Interval, hup)
+
+	// tools the model may call during a session
+	registry := tools.NewRegistry(cfg.Timeouts.Tool)
+	runCode, err := sandbox.NewRunCodeTool(sandbox.DefaultLimits)
+	if err != nil {
+		slog.Warn("run_code tool disabled", "error", err)
+	} else if err := registry.Register(runCode); err != nil {
+		fatal("Error registering run_code tool", err)
+	}
+
+	var records ai.RecordStore
+	// usage totals of each user are kept with the records, or else until the service stops
+	var usage ai.UsageStore = ai.NewMemoryUsageStore()
+	if aiConfig.RecordsDir != "" {
+		store, err := ai.NewFileRecordStore(aiConfig.RecordsDir)
+		if err != nil {
+			fatal("Error creating session record store", err)
+		}
+		records, usage = store, store
+	}
+
+	hub := ai.NewHub()
+	var draining atomic.Bool
+	http.HandleFunc("/ws", middleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			metrics.Upgrades.WithLabelValues("rejected").Inc()
+			http.Error(w, errDraining.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		handleWs(w, r, hub, reloader.settings(), registry, records, usage)
+	}, middleware.AuthMiddleware))
+
+	http.Handle("/metrics", metrics.Handler())
+	newHealthHandler(hub, reloader.check, breaker, records, &draining).Register(http.DefaultServeMux)
+
+	// operator endpoints are only served when a token is configured
+	if cfg.Admin.Token != "" {
+		admin.New(hub, cfg.Admin.Token).Register(http.DefaultServeMux)
+	} else {
+		slog.Info("Admin API disabled: ADMIN_TOKEN is not set")
+	}
+
+	server := &http.Server{Addr: cfg.Server.Addr, ReadHeaderTimeout: cfg.Timeouts.ReadHeader}
+	go func() {
+		var err error
+		tls := cfg.Server.TLS
+		slog.Info("Starting new socket server", "addr", server.Addr, "tls", tls.CertFile != "")
+		if tls.CertFile != "" {
+			err = server.ListenAndServeTLS(tls.CertFile, tls.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Unexpected serve error", err)
+		}
+	}()
+
+	// on SIGTERM, report not ready and refuse new sessions while the live ones finish
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	slog.Info("Shutting down", "signal", (<-signals).String())
+	draining.Store(true)
+	drain(hub, cfg.Timeouts.Drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Server shutdown", "error", err)
+	}
+}
+
+// fatal logs err and exits, like log.Fatal.
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
 
 func generateConnectionID(prefix string) string {
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/realtimetest"
+	"interviews-ai/internal/ai/templates"
+	"interviews-ai/internal/ai/vad"
+	"interviews-ai/internal/metrics"
+	"interviews-ai/internal/ratelimit"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// generous because hundreds of sessions share the CPU under the race detector
+const waitTimeout = 20 * time.Second
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	// the service logs every frame; keep test output readable unless -v is given
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRoutesEventsBetweenBrowserAndUpstream(t *testing.T) {
+	h := newHarness(t, harnessOptions{upstream: realtimetest.Options{
+		Script: []realtimetest.ScriptedResponse{{Transcript: "Tell me about yourself."}},
+	}})
+	b := h.connect()
+
+	// one session.update when connecting and one after session.created
+	if !h.upstream.WaitFor("session.update", waitTimeout) {
+		t.Fatal("upstream did not receive session.update")
+	}
+
+	b.sendAudio(tone(300, 700))
+	if b.waitFor("input_audio_buffer.speech_started", waitTimeout) == nil {
+		t.Fatal("browser did not receive speech_started")
+	}
+	if b.waitFor("response.audio.delta", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.audio.delta")
+	}
+	done := b.waitFor("response.done", waitTimeout)
+	if done == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+	if status := done["response"].(map[string]interface{})["status"]; status != "completed" {
+		t.Errorf("response status = %v, want completed", status)
+	}
+
+	b.send(map[string]interface{}{
+		"type":     "response.create",
+		"response": map[string]interface{}{"instructions": "Ask a coding question"},
+	})
+	if !h.upstream.WaitFor("response.create", waitTimeout) {
+		t.Fatal("upstream did not receive response.create")
+	}
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive a response to its text message")
+	}
+}
+
+func TestBrowserDisconnectTearsDownSession(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	b := h.connect()
+
+	b.conn.Close()
+	if !h.waitForHubEvent(b.clientId, ai.HubEventUnregister, waitTimeout) {
+		t.Fatalf("session was not unregistered, hub events: %v", h.hubEvents(b.clientId))
+	}
+
+	want := []string{ai.HubEventRegister, ai.HubEventUnregister}
+	if got := h.hubEvents(b.clientId); !reflect.DeepEqual(got[:len(want)], want) {
+		t.Errorf("hub events = %v, want prefix %v", got, want)
+	}
+
+	waitUntil(t, "upstream session closed", func() bool { return h.upstream.Sessions() == 0 })
+}
+
+func TestUpstreamDisconnectClosesBrowser(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	b := h.connect()
+
+	h.upstream.DisconnectAll()
+	if !b.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed")
+	}
+
+	want := []string{ai.HubEventRegister, ai.HubEventUnregister}
+	waitUntil(t, "session unregistered", func() bool {
+		return len(h.hubEvents(b.clientId)) >= len(want)
+	})
+	if got := h.hubEvents(b.clientId); !reflect.DeepEqual(got[:len(want)], want) {
+		t.Errorf("hub events = %v, want prefix %v", got, want)
+	}
+}
+
+func TestUpstreamDialFailureClosesBrowser(t *testing.T) {
+	h := newHarness(t, harnessOptions{upstream: realtimetest.Options{RejectStatus: 401}})
+	b, err := h.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed")
+	}
+	// the session is visible while connecting and gone once the dial fails
+	want := []string{ai.HubEventRegister, ai.HubEventUnregister}
+	if events := h.hubEvents(b.clientId); !reflect.DeepEqual(events, want) {
+		t.Errorf("hub events = %v, want %v", events, want)
+	}
+}
+
+func TestSessionSnapshot(t *testing.T) {
+	h := newHarness(t, harnessOptions{upstream: realtimetest.Options{
+		Script:          []realtimetest.ScriptedResponse{{Transcript: "Tell me about yourself."}},
+		InputTranscript: "Hello there.",
+	}})
+	b, err := h.dialQuery("user_id=user-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.waitFor("session.created", waitTimeout) == nil {
+		t.Fatal("browser did not receive session.created")
+	}
+
+	b.sendAudio(tone(300, 700))
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+
+	session := h.hub.Session(b.sessionId)
+	if session == nil {
+		t.Fatalf("no live session %q", b.sessionId)
+	}
+	var snapshot ai.SessionSnapshot
+	waitUntil(t, "transcript of both turns", func() bool {
+		snapshot = session.Snapshot()
+		return len(snapshot.Transcript) == 2
+	})
+	if snapshot.UserID != "user-42" || snapshot.Template != templates.DefaultTemplate || snapshot.State != ai.SessionActive {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+	if snapshot.Transcript[0].Role != "user" || snapshot.Transcript[0].Text != "Hello there." {
+		t.Errorf("first turn = %+v", snapshot.Transcript[0])
+	}
+	if snapshot.Transcript[1].Role != "assistant" || snapshot.Transcript[1].Text != "Tell me about yourself." {
+		t.Errorf("second turn = %+v", snapshot.Transcript[1])
+	}
+	usage := snapshot.Usage
+	if usage.Responses != 1 || usage.MessagesIn == 0 || usage.MessagesOut == 0 || usage.AudioBytesIn == 0 || usage.AudioBytesOut == 0 || usage.OutputTokens == 0 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if sessions := h.hub.Sessions(); len(sessions) != 1 || sessions[0].ID != b.sessionId {
+		t.Errorf("Sessions() = %+v, want only %s", sessions, b.sessionId)
+	}
+
+	b.conn.Close()
+	<-session.Done()
+	if state := session.State(); state != ai.SessionClosed {
+		t.Errorf("state after close = %s, want %s", state, ai.SessionClosed)
+	}
+}
+
+func TestUsageUpdated(t *testing.T) {
+	// the script is shared by the sessions, one response each
+	response := realtimetest.ScriptedResponse{Transcript: "Hello.", Usage: map[string]interface{}{
+		"input_tokens": 1000, "output_tokens": 200,
+		"input_token_details":  map[string]interface{}{"text_tokens": 1000, "audio_tokens": 0},
+		"output_token_details": map[string]interface{}{"text_tokens": 0, "audio_tokens": 200},
+	}}
+	h := newHarness(t, harnessOptions{
+		upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{response, response}},
+		config:   &ai.Config{Prices: ai.DefaultPrices},
+	})
+	cost := testutil.ToFloat64(metrics.CostUSD)
+
+	// (1000*5 + 200*80) / 1e6 at the prices of the mock's model
+	const want = 0.021
+	for session := 1; session <= 2; session++ {
+		b := h.connectQuery("user_id=alice")
+		b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+		updated := b.waitFor(ai.MsgTypeUsageUpdated, waitTimeout)
+		if updated == nil {
+			t.Fatal("browser did not receive usage.updated")
+		}
+		response, _ := updated["response"].(map[string]interface{})
+		if response["input_text_tokens"] != 1000.0 || response["output_audio_tokens"] != 200.0 || math.Abs(response["cost_usd"].(float64)-want) > 1e-9 {
+			t.Errorf("session %d: response usage = %v", session, response)
+		}
+		// the second session's totals start over, while the user's add up
+		if total, _ := updated["session"].(map[string]interface{}); total["input_tokens"] != 1000.0 {
+			t.Errorf("session %d: session usage = %v", session, total)
+		}
+		user, _ := updated["user"].(map[string]interface{})
+		if user["user_id"] != "alice" || user["responses"] != float64(session) || math.Abs(user["cost_usd"].(float64)-want*float64(session)) > 1e-9 {
+			t.Errorf("session %d: user usage = %v", session, user)
+		}
+		b.conn.Close()
+	}
+	if got := testutil.ToFloat64(metrics.CostUSD) - cost; math.Abs(got-2*want) > 1e-9 {
+		t.Errorf("cost_usd_total grew by %v, want %v", got, 2*want)
+	}
+
+	// anonymous sessions are counted by IP, so leaving out user_id escapes no budget
+	b := h.connect()
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	updated := b.waitFor(ai.MsgTypeUsageUpdated, waitTimeout)
+	if user, _ := updated["user"].(map[string]interface{}); user["user_id"] != "anonymous@127.0.0.1" {
+		t.Errorf("anonymous usage.updated = %v", updated)
+	}
+}
+
+func TestUnknownTemplateIsRejected(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	if _, err := h.dialQuery("template=nope"); err == nil {
+		t.Fatal("dial with an unknown template succeeded")
+	}
+	if h.upstream.Sessions() != 0 {
+		t.Error("an upstream session was opened for a rejected request")
+	}
+}
+
+func TestSessionConfigure(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+	b := h.connect()
+
+	b.send(map[string]interface{}{
+		"type": "session.configure",
+		"session": map[string]interface{}{
+			"voice":          "sage",
+			"temperature":    0.9,
+			"turn_detection": map[string]interface{}{"type": "server_vad", "threshold": 0.6, "silence_duration_ms": 800},
+		},
+	})
+	session := b.waitForSession(func(session map[string]interface{}) bool { return session["voice"] == "sage" })
+	turnDetection, _ := session["turn_detection"].(map[string]interface{})
+	if session["temperature"] != 0.9 || turnDetection["threshold"] != 0.6 || turnDetection["silence_duration_ms"] != 800.0 {
+		t.Errorf("session after session.configure = %v", session)
+	}
+
+	// out of bounds settings are rejected without reaching the upstream
+	updates := len(sessionUpdates(h.upstream))
+	b.send(map[string]interface{}{
+		"type":    "session.configure",
+		"session": map[string]interface{}{"voice": "robot", "temperature": 2},
+	})
+	rejected := b.waitFor("session.configure.error", waitTimeout)
+	if rejected == nil {
+		t.Fatal("browser did not receive session.configure.error")
+	}
+	if message, _ := rejected["error"].(string); !strings.Contains(message, "voice") || !strings.Contains(message, "temperature") {
+		t.Errorf("error = %q, want both problems", message)
+	}
+	if n := len(sessionUpdates(h.upstream)); n != updates {
+		t.Errorf("upstream received %d session.update events after a rejected configure, want %d", n, updates)
+	}
+
+	// push-to-talk turns server VAD off
+	b.send(map[string]interface{}{
+		"type":    "session.configure",
+		"session": map[string]interface{}{"turn_detection": map[string]interface{}{"type": "none"}},
+	})
+	session = b.waitForSession(func(session map[string]interface{}) bool { return session["turn_detection"] == nil })
+	if session["voice"] != "sage" {
+		t.Errorf("session after push-to-talk = %v, want the voice kept", session)
+	}
+}
+
+func TestPushToTalk(t *testing.T) {
+	h := newHarness(t, harnessOptions{
+		upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{{Transcript: "Go on."}}},
+		config:   &ai.Config{TurnDetection: ai.TurnDetection{Type: ai.TurnDetectionNone}},
+	})
+	b := h.connect()
+
+	// a tap too short to hold a turn is dropped
+	b.send(map[string]interface{}{"type": "ptt.start"})
+	b.sendAudio(tone(50, 0))
+	b.send(map[string]interface{}{"type": "ptt.stop"})
+	if b.waitFor("ptt.error", waitTimeout) == nil {
+		t.Fatal("browser did not receive ptt.error for a short turn")
+	}
+
+	b.send(map[string]interface{}{"type": "ptt.start"})
+	b.sendAudio(tone(300, 700))
+	b.send(map[string]interface{}{"type": "ptt.stop"})
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+
+	var turns []string
+	for _, eventType := range h.upstream.ReceivedTypes() {
+		switch eventType {
+		case "input_audio_buffer.clear", "input_audio_buffer.commit", "response.create":
+			turns = append(turns, eventType)
+		}
+	}
+	want := []string{
+		"input_audio_buffer.clear", "input_audio_buffer.clear",
+		"input_audio_buffer.clear", "input_audio_buffer.commit", "response.create",
+	}
+	if !reflect.DeepEqual(turns, want) {
+		t.Errorf("upstream turn events = %v, want %v", turns, want)
+	}
+
+	// with server VAD on, the talk button is refused
+	vad := newHarness(t, harnessOptions{}).connect()
+	vad.send(map[string]interface{}{"type": "ptt.start"})
+	if event := vad.waitFor("ptt.error", waitTimeout); event == nil || !strings.Contains(event["error"].(string), "turn_detection none") {
+		t.Errorf("ptt.start with server VAD = %v, want ptt.error", event)
+	}
+}
+
+func TestNoiseGate(t *testing.T) {
+	h := newHarness(t, harnessOptions{config: &ai.Config{NoiseGate: &vad.Config{}}})
+	b := h.connect()
+	suppressed := testutil.ToFloat64(metrics.SuppressedAudioSeconds)
+
+	// silence around a short utterance
+	b.sendAudio(tone(0, 1000))
+	b.sendAudio(tone(300, 1500))
+	if b.waitFor("input_audio_buffer.speech_stopped", waitTimeout) == nil {
+		t.Fatal("the upstream did not detect the end of speech through the gate")
+	}
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+
+	appends := 0
+	for _, eventType := range h.upstream.ReceivedTypes() {
+		if eventType == "input_audio_buffer.append" {
+			appends++
+		}
+	}
+	// 38 chunks of 100ms were sent
+	if appends == 0 || appends >= 38 {
+		t.Errorf("upstream received %d appends, want some of the 38 dropped", appends)
+	}
+	usage := h.hub.Session(b.sessionId).Snapshot().Usage
+	if usage.SuppressedAudioMs < 1000 {
+		t.Errorf("suppressed audio = %dms, want at least 1000ms", usage.SuppressedAudioMs)
+	}
+	if got := testutil.ToFloat64(metrics.SuppressedAudioSeconds) - suppressed; math.Abs(got-float64(usage.SuppressedAudioMs)/1000) > 1e-6 {
+		t.Errorf("suppressed_audio_seconds_total grew by %v, want %v", got, float64(usage.SuppressedAudioMs)/1000)
+	}
+}
+
+// sessionUpdates returns the session.update events the upstream received.
+func sessionUpdates(upstream *realtimetest.Server) []string {
+	var updates []string
+	for _, eventType := range upstream.ReceivedTypes() {
+		if eventType == "session.update" {
+			updates = append(updates, eventType)
+		}
+	}
+	return updates
+}
+
+func TestSessionLimits(t *testing.T) {
+	h := newHarness(t, harnessOptions{config: &ai.Config{MaxMessageBytes: 1024}, limits: &ratelimit.Config{MaxSessions: 2, MaxSessionsPerUser: 1}})
+	rejectedUser := testutil.ToFloat64(metrics.SessionsRejected.WithLabelValues(ratelimit.ReasonUserSessions))
+
+	alice := h.connectQuery("user_id=alice")
+	for _, test := range []struct{ user, reason string }{
+		{"alice", ratelimit.ReasonUserSessions},
+		{"", ""},
+		{"carol", ratelimit.ReasonSessions},
+	} {
+		b, err := h.dialQuery("user_id=" + test.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.reason == "" {
+			if b.waitFor("session.created", waitTimeout) == nil {
+				t.Fatal("anonymous session was not created")
+			}
+			continue
+		}
+		rejected := b.waitFor(ai.MsgTypeSessionRejected, waitTimeout)
+		if rejected == nil || rejected["reason"] != test.reason || rejected["error"] == "" {
+			t.Fatalf("session of %s: got %v, want a rejection for %s", test.user, rejected, test.reason)
+		}
+		if !b.waitClosed(waitTimeout) {
+			t.Fatalf("rejected session of %s was not closed", test.user)
+		}
+	}
+	// rejected sessions never reach the upstream
+	if n := h.upstream.Sessions(); n != 2 {
+		t.Errorf("upstream has %d sessions, want 2", n)
+	}
+	if got := testutil.ToFloat64(metrics.SessionsRejected.WithLabelValues(ratelimit.ReasonUserSessions)) - rejectedUser; got != 1 {
+		t.Errorf("sessions_rejected_total{reason=%q} grew by %v, want 1", ratelimit.ReasonUserSessions, got)
+	}
+
+	// a message over the size limit ends the session, which frees its slots
+	alice.send(map[string]interface{}{"type": "input_audio_buffer.append", "audio": strings.Repeat("A", 2048)})
+	if !alice.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed after an oversized message")
+	}
+	waitUntil(t, "session removed", func() bool { return h.hub.Len() == 1 })
+	waitUntil(t, "slots released", func() bool {
+		b, err := h.dialQuery("user_id=alice")
+		return err == nil && b.waitFor("session.created", waitTimeout) != nil
+	})
+}
+
+func TestConnectionAttempts(t *testing.T) {
+	h := newHarness(t, harnessOptions{limits: &ratelimit.Config{AttemptsPerMinute: 2}})
+
+	for i := 0; i < 2; i++ {
+		h.connectQuery("user_id=bob").conn.Close()
+	}
+	b, err := h.dialQuery("user_id=bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := b.waitFor(ai.MsgTypeSessionRejected, waitTimeout)
+	if rejected == nil || rejected["reason"] != ratelimit.ReasonRateLimited {
+		t.Fatalf("third attempt: got %v, want a rejection for %s", rejected, ratelimit.ReasonRateLimited)
+	}
+	if ms, _ := rejected["retry_after_ms"].(float64); ms <= 0 || ms > 60000 {
+		t.Errorf("retry_after_ms = %v, want within a minute", rejected["retry_after_ms"])
+	}
+}
+
+func TestMaxSessionDuration(t *testing.T) {
+	h := newHarness(t, harnessOptions{config: &ai.Config{MaxSessionDuration: 300 * time.Millisecond}, limits: &ratelimit.Config{}})
+
+	b := h.connect()
+	ended := b.waitFor(ai.MsgTypeSessionEnded, waitTimeout)
+	if ended == nil || ended["reason"] != ai.SessionEndMaxDuration {
+		t.Fatalf("got %v, want session.ended for %s", ended, ai.SessionEndMaxDuration)
+	}
+	if !b.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed at the max duration")
+	}
+	waitUntil(t, "upstream session closed", func() bool { return h.upstream.Sessions() == 0 })
+}
+
+func TestBudget(t *testing.T) {
+	// each turn uses 1200 tokens, so the first warns and the second exceeds the budget;
+	// the third wraps up carol's session
+	response := realtimetest.ScriptedResponse{Transcript: "Next question.", Usage: map[string]interface{}{"input_tokens": 1000, "output_tokens": 200}}
+	h := newHarness(t, harnessOptions{
+		upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{response, response, {Transcript: "Goodbye."}, response, response}},
+		configure: func(s *settings) {
+			s.budget = func(user string) *ai.Budget { return &ai.Budget{Plan: "trial", DailyTokens: 2000, WarnAt: 0.5} }
+		},
+	})
+
+	b := h.connectQuery("user_id=carol")
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	warning := b.waitFor(ai.MsgTypeBudgetWarning, waitTimeout)
+	if warning == nil || warning["plan"] != "trial" || warning["period"] != "daily" || warning["unit"] != "tokens" {
+		t.Fatalf("got %v, want a budget.warning for the daily tokens", warning)
+	}
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	if exceeded := b.waitFor(ai.MsgTypeBudgetExceeded, waitTimeout); exceeded == nil || exceeded["share"].(float64) < 1 {
+		t.Fatalf("got %v, want budget.exceeded", exceeded)
+	}
+	// the browser hears the wrap-up out before the session ends
+	for {
+		done := b.waitFor("response.done", waitTimeout)
+		if done == nil {
+			t.Fatal("browser did not receive the wrap-up's response.done before the session ended")
+		}
+		if metadata, _ := done["response"].(map[string]interface{})["metadata"].(map[string]interface{}); metadata["purpose"] == "budget_wrap_up" {
+			break
+		}
+	}
+	ended := b.waitFor(ai.MsgTypeSessionEnded, waitTimeout)
+	if ended == nil || ended["reason"] != ai.SessionEndBudget {
+		t.Fatalf("got %v, want session.ended for %s", ended, ai.SessionEndBudget)
+	}
+	if !b.waitClosed(waitTimeout) {
+		t.Fatal("browser connection was not closed once the budget was exceeded")
+	}
+
+	// the model was asked to wrap up before the session ended
+	var wrapUp, wrapUpResponse bool
+	for _, event := range h.upstream.Received() {
+		raw := string(event.Raw)
+		wrapUp = wrapUp || event.Type == "conversation.item.create" && strings.Contains(raw, `"role":"system"`)
+		wrapUpResponse = wrapUpResponse || event.Type == "response.create" && strings.Contains(raw, "budget_wrap_up")
+	}
+	if !wrapUp || !wrapUpResponse {
+		t.Errorf("upstream received no wrap-up: %v", h.upstream.ReceivedTypes())
+	}
+
+	// a user over budget cannot start another session until the period resets
+	rejectedBudget := testutil.ToFloat64(metrics.BudgetEvents.WithLabelValues("rejected"))
+	b, err := h.dialQuery("user_id=carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := b.waitFor(ai.MsgTypeSessionRejected, waitTimeout)
+	if rejected == nil || rejected["reason"] != ai.SessionEndBudget {
+		t.Fatalf("got %v, want a rejection for %s", rejected, ai.SessionEndBudget)
+	}
+	if ms, _ := rejected["retry_after_ms"].(float64); ms <= 0 || ms > float64(24*time.Hour/time.Millisecond) {
+		t.Errorf("retry_after_ms = %v, want within a day", rejected["retry_after_ms"])
+	}
+	if got := testutil.ToFloat64(metrics.BudgetEvents.WithLabelValues("rejected")) - rejectedBudget; got != 1 {
+		t.Errorf("budget_events_total{event=\"rejected\"} grew by %v, want 1", got)
+	}
+	// other users keep their own budget
+	h.connectQuery("user_id=dave")
+
+	// an anonymous user has one too, kept for its IP
+	b = h.connect()
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	if b.waitFor(ai.MsgTypeBudgetWarning, waitTimeout) == nil {
+		t.Fatal("anonymous user was not warned")
+	}
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	if b.waitFor(ai.MsgTypeSessionEnded, waitTimeout) == nil {
+		t.Fatal("anonymous session was not ended once its budget was exceeded")
+	}
+	b, err = h.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected := b.waitFor(ai.MsgTypeSessionRejected, waitTimeout); rejected == nil || rejected["reason"] != ai.SessionEndBudget {
+		t.Fatalf("got %v, want a rejection of the anonymous user for %s", rejected, ai.SessionEndBudget)
+	}
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	sessions := 200
+	if testing.Short() {
+		sessions = 20
+	}
+	h := newHarness(t, harnessOptions{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := h.dial()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if b.waitFor("session.created", waitTimeout) == nil {
+				t.Errorf("%s: no session.created", b.clientId)
+				return
+			}
+			b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+			if b.waitFor("response.done", waitTimeout) == nil {
+				t.Errorf("%s: no response.done", b.clientId)
+			}
+			b.conn.Close()
+			if !h.waitForHubEvent(b.clientId, ai.HubEventUnregister, waitTimeout) {
+				t.Errorf("%s: session was not torn down", b.clientId)
+			}
+		}()
+	}
+	wg.Wait()
+
+	waitUntil(t, "all upstream sessions closed", func() bool { return h.upstream.Sessions() == 0 })
+}
+
+// TestSimultaneousTeardown closes both ends of busy sessions at once; run it with -race.
+func TestSimultaneousTeardown(t *testing.T) {
+	sessions := 50
+	if testing.Short() {
+		sessions = 10
+	}
+	h := newHarness(t, harnessOptions{})
+
+	browsers := make([]*browser, sessions)
+	for i := range browsers {
+		browsers[i] = h.connect()
+	}
+
+	var wg sync.WaitGroup
+	for _, b := range browsers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// keep the session busy while it goes away; writes fail once the service closes it
+			audio := base64.StdEncoding.EncodeToString(tone(100, 0))
+			for i := 0; i < 10; i++ {
+				b.conn.WriteJSON(map[string]interface{}{"type": "input_audio_buffer.append", "audio": audio})
+			}
+			b.conn.WriteJSON(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+			b.conn.Close()
+		}()
+	}
+	h.upstream.DisconnectAll()
+	wg.Wait()
+
+	for _, b := range browsers {
+		if !h.waitForHubEvent(b.clientId, ai.HubEventUnregister, waitTimeout) {
+			t.Fatalf("%s: session was not torn down, hub events: %v", b.clientId, h.hubEvents(b.clientId))
+		}
+	}
+	// give stray pumps a chance to unregister twice before counting
+	time.Sleep(100 * time.Millisecond)
+	for _, b := range browsers {
+		unregistered := 0
+		for _, kind := range h.hubEvents(b.clientId) {
+			if kind == ai.HubEventUnregister {
+				unregistered++
+			}
+		}
+		if unregistered != 1 {
+			t.Errorf("%s: unregistered %d times, want once", b.clientId, unregistered)
+		}
+	}
+}
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"interviews-ai/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// histogramCount returns how many observations a histogram without labels has.
+func histogramCount(t *testing.T, name string) uint64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	h := newHarness(t, harnessOptions{})
+
+	accepted := testutil.ToFloat64(metrics.Upgrades.WithLabelValues("accepted"))
+	rejected := testutil.ToFloat64(metrics.Upgrades.WithLabelValues("rejected"))
+	appends := testutil.ToFloat64(metrics.Events.WithLabelValues(metrics.FromClient, "input_audio_buffer.append"))
+	other := testutil.ToFloat64(metrics.Events.WithLabelValues(metrics.FromClient, "other"))
+	firstAudio := histogramCount(t, "ai_service_time_to_first_audio_seconds")
+
+	b := h.connect()
+	if got := testutil.ToFloat64(metrics.SessionsActive); got < 1 {
+		t.Errorf("sessions_active = %v, want at least 1", got)
+	}
+
+	b.send(map[string]interface{}{"type": "made.up.event"})
+	b.sendAudio(tone(300, 700))
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+	if _, err := h.dialQuery("template=nope"); err == nil {
+		t.Fatal("dial with an unknown template succeeded")
+	}
+
+	if got := testutil.ToFloat64(metrics.Upgrades.WithLabelValues("accepted")) - accepted; got != 1 {
+		t.Errorf("accepted upgrades grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.Upgrades.WithLabelValues("rejected")) - rejected; got != 1 {
+		t.Errorf("rejected upgrades grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.Events.WithLabelValues(metrics.FromClient, "input_audio_buffer.append")) - appends; got != 10 {
+		t.Errorf("input_audio_buffer.append events grew by %v, want 10", got)
+	}
+	// unknown client event types do not become labels
+	if got := testutil.ToFloat64(metrics.Events.WithLabelValues(metrics.FromClient, "other")) - other; got != 1 {
+		t.Errorf("other client events grew by %v, want 1", got)
+	}
+	if got := histogramCount(t, "ai_service_time_to_first_audio_seconds") - firstAudio; got != 1 {
+		t.Errorf("time_to_first_audio observations grew by %d, want 1", got)
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	for _, name := range []string{
+		"ai_service_sessions_active",
+		"ai_service_upstream_dial_seconds_bucket",
+		"ai_service_send_queue_depth_bucket",
+		`ai_service_events_total{direction="upstream",type="response.audio.delta"}`,
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics does not expose %s", name)
+		}
+	}
+}
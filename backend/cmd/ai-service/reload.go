@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/templates"
+	"interviews-ai/internal/config"
+	"interviews-ai/internal/metrics"
+	"interviews-ai/internal/ratelimit"
+)
+
+// settings are what new sessions start with. A reload replaces them whole, so a
+// live session keeps the settings it started with.
+type settings struct {
+	config    *ai.Config
+	provider  ai.Provider
+	templates map[string]string
+	// limiter admits new sessions; there are no limits when it is nil.
+	limiter        *ratelimit.Limiter
+	clientIPHeader string
+	// budget returns the budget of a user, nil when it has none.
+	budget func(user string) *ai.Budget
+}
+
+// newSettings builds the session settings of cfg. breaker, if set, wraps the
+// provider, and limits, if set, keeps the counters of the limits.
+func newSettings(cfg *config.Config, breaker *ai.Breaker, limits ratelimit.Backend) (*settings, error) {
+	aiConfig := cfg.AI()
+	provider, err := ai.NewProvider(aiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("select AI provider: %v", err)
+	}
+	if breaker != nil {
+		provider = ai.WithBreaker(provider, breaker)
+	}
+	loaded, err := templates.Load(cfg.Templates.Dir)
+	if err != nil {
+		return nil, err
+	}
+	current := &settings{config: aiConfig, provider: provider, templates: loaded, clientIPHeader: cfg.Limits.ClientIPHeader, budget: cfg.Budget}
+	if limits != nil {
+		current.limiter = ratelimit.New(limits, cfg.RateLimits())
+	}
+	return current, nil
+}
+
+// restartSettings are the sections used only while the service starts; changing
+// them has no effect until it is restarted.
+var restartSettings = []string{"server", "timeouts.tool", "timeouts.read_header", "records.dir", "breaker", "tracing", "logging", "admin", "reload", "limits.backend", "limits.redis_url"}
+
+// reloader reloads the configuration with the command line the service started
+// with, on SIGHUP or when the config file or a template changes.
+type reloader struct {
+	args    []string
+	breaker *ai.Breaker
+	limits  ratelimit.Backend
+	// started is the configuration the service started with.
+	started *config.Config
+	current atomic.Pointer[settings]
+	// failed is the error of the last reload, nil if it succeeded.
+	failed atomic.Pointer[error]
+
+	mu sync.Mutex
+	// file and templateDir are watched for changes.
+	file        string
+	templateDir string
+}
+
+func newReloader(args []string, cfg *config.Config, options config.Options, breaker *ai.Breaker, limits ratelimit.Backend) (*reloader, error) {
+	initial, err := newSettings(cfg, breaker, limits)
+	if err != nil {
+		return nil, err
+	}
+	r := &reloader{args: args, breaker: breaker, limits: limits, started: cfg, file: options.File, templateDir: cfg.Templates.Dir}
+	r.current.Store(initial)
+	metrics.ConfigLastReloadSuccessful.Set(1)
+	return r, nil
+}
+
+// settings returns the settings for a new session.
+func (r *reloader) settings() *settings {
+	return r.current.Load()
+}
+
+// reload loads and validates the configuration and templates, and applies them to
+// new sessions. A configuration that fails is reported and the current one kept.
+func (r *reloader) reload(trigger string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := func() error {
+		cfg, options, err := config.Load(r.args)
+		if err != nil {
+			return err
+		}
+		next, err := newSettings(cfg, r.breaker, r.limits)
+		if err != nil {
+			return err
+		}
+		for _, name := range changedSettings(r.started, cfg, restartSettings) {
+			slog.Warn("Config setting changed but needs a restart to apply", "setting", name)
+		}
+		r.current.Store(next)
+		r.file, r.templateDir = options.File, cfg.Templates.Dir
+		slog.Info("Config reloaded", "trigger", trigger, "provider", next.provider.Name(), "templates", len(next.templates))
+		return nil
+	}()
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		r.failed.Store(&err)
+		metrics.ConfigLastReloadSuccessful.Set(0)
+		slog.Error("Config reload failed, keeping the current config", "trigger", trigger, "error", err)
+		return err
+	}
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+	r.failed.Store(nil)
+	metrics.ConfigLastReloadSuccessful.Set(1)
+	return nil
+}
+
+// check fails while the last reload has failed, when new sessions still get the
+// configuration loaded before it.
+func (r *reloader) check(ctx context.Context) error {
+	if err := r.failed.Load(); err != nil {
+		return fmt.Errorf("last config reload failed, keeping the previous config: %w", *err)
+	}
+	return nil
+}
+
+// watch reloads on every signal from hup, and whenever the watched files change
+// when interval is positive, until ctx is done.
+func (r *reloader) watch(ctx context.Context, interval time.Duration, hup <-chan os.Signal) {
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	last := r.fingerprint()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload("SIGHUP")
+			last = r.fingerprint()
+		case <-ticks:
+			// an edit that fails is not retried until the files change again
+			if current := r.fingerprint(); current != last {
+				last = current
+				r.reload("file change")
+			}
+		}
+	}
+}
+
+// fingerprint summarizes the size and modification time of the watched files.
+// Files are stat'ed through symlinks, so swapping a mounted ConfigMap counts as a
+// change.
+func (r *reloader) fingerprint() string {
+	r.mu.Lock()
+	paths := []string{r.file}
+	if r.templateDir != "" {
+		paths = append(paths, r.templateDir)
+		// a template that cannot be listed shows up as a failed reload instead
+		files, _ := templates.Files(r.templateDir)
+		paths = append(paths, files...)
+	}
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", path)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+// changedSettings lists the settings, among names, that differ between a and b.
+func changedSettings(a, b *config.Config, names []string) []string {
+	var changed []string
+	for _, name := range names {
+		if !reflect.DeepEqual(setting(a, name), setting(b, name)) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// setting returns the setting or section of config at a dotted path of yaml names.
+// It panics if the path names no setting.
+func setting(config *config.Config, path string) interface{} {
+	v := reflect.ValueOf(config).Elem()
+	for _, name := range strings.Split(path, ".") {
+		field, ok := yamlField(v, name)
+		if !ok {
+			panic(fmt.Sprintf("no config setting %q", path))
+		}
+		v = field
+	}
+	return v.Interface()
+}
+
+// yamlField returns the field of the struct v with the yaml name.
+func yamlField(v reflect.Value, name string) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ","); tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
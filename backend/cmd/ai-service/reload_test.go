@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai/realtimetest"
+	"interviews-ai/internal/config"
+	"interviews-ai/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// lastSessions returns the last session.update of each upstream session, the one
+// whose instructions upstream uses, by session id.
+func lastSessions(t *testing.T, upstream *realtimetest.Server) map[string]map[string]interface{} {
+	t.Helper()
+	sessions := make(map[string]map[string]interface{})
+	for _, event := range upstream.Received() {
+		if event.Type != "session.update" {
+			continue
+		}
+		var update struct {
+			Session map[string]interface{} `json:"session"`
+		}
+		if err := json.Unmarshal(event.Raw, &update); err != nil {
+			t.Fatal(err)
+		}
+		sessions[event.SessionID] = update.Session
+	}
+	return sessions
+}
+
+func TestReloadAppliesToNewSessions(t *testing.T) {
+	upstream := realtimetest.NewServer(realtimetest.Options{Record: true})
+	t.Cleanup(upstream.Close)
+
+	dir := t.TempDir()
+	templateDir := filepath.Join(dir, "templates")
+	if err := os.Mkdir(templateDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path string, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configFile := filepath.Join(dir, "config.yaml")
+	writeConfig := func(voice string, temperature float64) {
+		write(configFile, fmt.Sprintf("provider: mock\nmock:\n  endpoint: %s\nsession:\n  voice: %s\n  temperature: %v\ntemplates:\n  dir: %s\n",
+			upstream.URL(), voice, temperature, templateDir))
+	}
+	writeConfig("verse", 0.8)
+	write(filepath.Join(templateDir, "pairing.md"), "Pair with the candidate.")
+
+	args := []string{"--config", configFile}
+	cfg, options, err := config.Load(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newReloader(args, cfg, options, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, harnessOptions{settings: r.settings})
+	h.upstream = upstream
+
+	ctx, stopPolling := context.WithCancel(context.Background())
+	t.Cleanup(stopPolling)
+	hup := make(chan os.Signal, 1)
+	go r.watch(ctx, 10*time.Millisecond, hup)
+
+	first, err := h.dialQuery("template=pairing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.waitFor("session.created", waitTimeout) == nil {
+		t.Fatal("browser did not receive session.created")
+	}
+
+	successes := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("success"))
+	failures := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("failure"))
+
+	// edit the config and a template, and add another template
+	writeConfig("sage", 0.8)
+	write(filepath.Join(templateDir, "pairing.md"), "Pair with the candidate on a harder problem.")
+	write(filepath.Join(templateDir, "system-design.txt"), "Run a system design interview.")
+	waitUntil(t, "config reloaded", func() bool {
+		current := r.settings()
+		return current.config.Voice == "sage" && current.templates["system-design"] != ""
+	})
+	if testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("success")) == successes {
+		t.Error("successful reload was not counted")
+	}
+
+	second, err := h.dialQuery("template=pairing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.waitFor("session.created", waitTimeout) == nil {
+		t.Fatal("browser did not receive session.created")
+	}
+	if _, err := h.dialQuery("template=system-design"); err != nil {
+		t.Errorf("new template was not available: %v", err)
+	}
+
+	// instructions by voice
+	got := map[interface{}]interface{}{}
+	for _, session := range lastSessions(t, upstream) {
+		got[session["voice"]] = session["instructions"]
+	}
+	if got["verse"] != "Pair with the candidate." || got["sage"] != "Pair with the candidate on a harder problem." {
+		t.Errorf("instructions by voice = %v, want the old settings before the reload and the new ones after", got)
+	}
+
+	// the session started before the reload keeps going
+	first.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	if first.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("session started before the reload stopped working")
+	}
+
+	// an invalid config is rejected and the current settings kept
+	writeConfig("alloy", 5)
+	waitUntil(t, "failed reload counted", func() bool {
+		return testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("failure")) > failures
+	})
+	if voice := r.settings().config.Voice; voice != "sage" {
+		t.Errorf("voice after a failed reload = %q, want sage", voice)
+	}
+	if testutil.ToFloat64(metrics.ConfigLastReloadSuccessful) != 0 {
+		t.Error("last reload not reported as failed")
+	}
+	if err := r.check(context.Background()); err == nil {
+		t.Error("readiness check passed after a failed reload")
+	}
+
+	// without polling, a fixed config is only picked up on SIGHUP
+	stopPolling()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go r.watch(ctx, 0, hup)
+	writeConfig("alloy", 1)
+	hup <- syscall.SIGHUP
+	waitUntil(t, "reload on SIGHUP", func() bool { return r.settings().config.Voice == "alloy" })
+	waitUntil(t, "last reload reported as successful", func() bool {
+		return testutil.ToFloat64(metrics.ConfigLastReloadSuccessful) == 1
+	})
+	if err := r.check(context.Background()); err != nil {
+		t.Errorf("readiness check after a successful reload: %v", err)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	a, b := config.Default(), config.Default()
+	b.Server.Addr = ":7000"
+	b.Timeouts.Tool = time.Minute
+	b.Timeouts.Dial = time.Minute
+	b.Session.Voice = "sage"
+
+	got := changedSettings(a, b, restartSettings)
+	if len(got) != 2 || got[0] != "server" || got[1] != "timeouts.tool" {
+		t.Errorf("changedSettings = %v, want [server timeouts.tool]", got)
+	}
+}
+
+func TestRestartSettingsResolve(t *testing.T) {
+	cfg := config.Default()
+	for _, name := range restartSettings {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("restart setting %s: %v", name, r)
+				}
+			}()
+			setting(cfg, name)
+		}()
+	}
+
+	// a typo does not resolve to the enclosing section
+	defer func() {
+		if recover() == nil {
+			t.Error("setting accepted an unknown path")
+		}
+	}()
+	setting(cfg, "timeouts.tools")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/cassette"
+	"interviews-ai/internal/ai/realtimetest"
+)
+
+var updateCassettes = flag.Bool("update-cassettes", false, "re-record the golden cassettes from the mock upstream")
+
+const goldenCassette = "testdata/cassettes/voice_turn.jsonl"
+
+const goldenTranscript = "Tell me about a project you are proud of."
+
+// playVoiceTurn speaks one turn and waits for the whole response.
+func playVoiceTurn(t *testing.T, h *harness) {
+	t.Helper()
+	b := h.connect()
+
+	b.sendAudio(tone(300, 700))
+	if b.waitFor("input_audio_buffer.speech_started", waitTimeout) == nil {
+		t.Fatal("browser did not receive speech_started")
+	}
+	transcript := b.waitFor("response.audio_transcript.done", waitTimeout)
+	if transcript == nil {
+		t.Fatal("browser did not receive response.audio_transcript.done")
+	}
+	if got := transcript["transcript"]; got != goldenTranscript {
+		t.Errorf("transcript = %q, want %q", got, goldenTranscript)
+	}
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+	b.conn.Close()
+	if !h.waitForHubEvent(b.clientId, ai.HubEventUnregister, waitTimeout) {
+		t.Fatalf("session was not torn down, hub events: %v", h.hubEvents(b.clientId))
+	}
+}
+
+func TestReplayCassette(t *testing.T) {
+	if *updateCassettes {
+		recordGoldenCassette(t)
+	}
+
+	h := newHarness(t, harnessOptions{config: &ai.Config{Provider: ai.ProviderReplay, ReplayCassette: goldenCassette}})
+	playVoiceTurn(t, h)
+}
+
+// recordGoldenCassette records a voice turn against the mock upstream into goldenCassette.
+func recordGoldenCassette(t *testing.T) {
+	dir := t.TempDir()
+	h := newHarness(t, harnessOptions{
+		upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{{Transcript: goldenTranscript}}},
+		config:   &ai.Config{RecordDir: dir},
+	})
+	playVoiceTurn(t, h)
+	h.server.Close()
+
+	recorded, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil || len(recorded) != 1 {
+		t.Fatalf("expected one recorded cassette, got %v (%v)", recorded, err)
+	}
+	waitUntil(t, "cassette closed", func() bool { return h.upstream.Sessions() == 0 })
+	if _, err := cassette.Load(recorded[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(recorded[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(goldenCassette), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(goldenCassette, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("recorded %s", goldenCassette)
+}
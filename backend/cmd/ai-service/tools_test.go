@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/realtimetest"
+	"interviews-ai/internal/ai/tools"
+)
+
+// echoTool answers with its arguments after delay, unless its context ends first.
+type echoTool struct {
+	delay time.Duration
+}
+
+func (echoTool) Name() string                { return "echo" }
+func (echoTool) Description() string         { return "Repeats its arguments." }
+func (echoTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+
+func (e echoTool) Invoke(ctx context.Context, args json.RawMessage) (string, error) {
+	select {
+	case <-time.After(e.delay):
+		return string(args), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// toolEvents returns the outputs posted upstream, by call ID, and the types of the
+// conversation.item.create and response.create events from the first response.create on.
+func toolEvents(t *testing.T, upstream *realtimetest.Server) (map[string]string, []string) {
+	t.Helper()
+	outputs := make(map[string]string)
+	var types []string
+	for _, event := range upstream.Received() {
+		switch event.Type {
+		case "response.create":
+			types = append(types, event.Type)
+		case "conversation.item.create":
+			if len(types) == 0 {
+				continue
+			}
+			var create struct {
+				Item struct {
+					Type   string `json:"type"`
+					CallID string `json:"call_id"`
+					Output string `json:"output"`
+				} `json:"item"`
+			}
+			if err := json.Unmarshal(event.Raw, &create); err != nil {
+				t.Fatal(err)
+			}
+			types = append(types, create.Item.Type)
+			if create.Item.Type == "function_call_output" {
+				if _, ok := outputs[create.Item.CallID]; ok {
+					t.Errorf("call %s was answered twice", create.Item.CallID)
+				}
+				outputs[create.Item.CallID] = create.Item.Output
+			}
+		}
+	}
+	return outputs, types
+}
+
+func TestFunctionCalls(t *testing.T) {
+	// a tool that answers at once posts its output before the response repeats the call
+	for _, delay := range []time.Duration{0, 50 * time.Millisecond} {
+		registry := tools.NewRegistry(tools.DefaultTimeout)
+		if err := registry.Register(echoTool{delay: delay}); err != nil {
+			t.Fatal(err)
+		}
+		h := newHarness(t, harnessOptions{tools: registry, upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{
+			{FunctionCalls: []realtimetest.FunctionCall{{Name: "echo", Arguments: `{"n":1}`}, {Name: "echo", Arguments: `{"n":2}`}}},
+			{Transcript: "Thanks for waiting."},
+		}}})
+		b := h.connect()
+
+		b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+		for i := 0; i < 2; i++ {
+			if b.waitFor("response.done", waitTimeout) == nil {
+				t.Fatalf("delay %v: browser did not receive response.done %d", delay, i+1)
+			}
+		}
+
+		// every call is answered once, though the deltas, the done event and the output
+		// item all name it, and the model is asked to continue once both are answered
+		outputs, types := toolEvents(t, h.upstream)
+		var got []string
+		for _, output := range outputs {
+			got = append(got, output)
+		}
+		sort.Strings(got)
+		if want := []string{`{"n":1}`, `{"n":2}`}; !reflect.DeepEqual(got, want) {
+			t.Errorf("delay %v: outputs = %v, want %v", delay, got, want)
+		}
+		if want := []string{"response.create", "function_call_output", "function_call_output", "response.create"}; !reflect.DeepEqual(types, want) {
+			t.Errorf("delay %v: upstream received %v, want %v", delay, types, want)
+		}
+	}
+}
+
+func TestFunctionCallTimeout(t *testing.T) {
+	registry := tools.NewRegistry(200 * time.Millisecond)
+	if err := registry.Register(echoTool{delay: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, harnessOptions{tools: registry, upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{
+		{FunctionCall: &realtimetest.FunctionCall{Name: "echo", Arguments: `{}`}},
+		{Transcript: "That took too long."},
+	}}})
+	b := h.connect()
+
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	for i := 0; i < 2; i++ {
+		if b.waitFor("response.done", waitTimeout) == nil {
+			t.Fatalf("browser did not receive response.done %d", i+1)
+		}
+	}
+
+	// the model is told the tool timed out and still gets to respond
+	outputs, types := toolEvents(t, h.upstream)
+	if len(outputs) != 1 {
+		t.Fatalf("outputs = %v, want one", outputs)
+	}
+	for _, output := range outputs {
+		if !strings.Contains(output, "timed out after 200ms") {
+			t.Errorf("output = %s, want a timeout error", output)
+		}
+	}
+	if want := []string{"response.create", "function_call_output", "response.create"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("upstream received %v, want %v", types, want)
+	}
+}
+
+func TestBudgetExceededByToolCall(t *testing.T) {
+	registry := tools.NewRegistry(tools.DefaultTimeout)
+	if err := registry.Register(echoTool{}); err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, harnessOptions{
+		tools: registry,
+		upstream: realtimetest.Options{Script: []realtimetest.ScriptedResponse{
+			{FunctionCall: &realtimetest.FunctionCall{Name: "echo", Arguments: `{}`}, Usage: map[string]interface{}{"input_tokens": 1000, "output_tokens": 200}},
+			{Transcript: "That is all for today."},
+		}},
+		configure: func(s *settings) {
+			s.budget = func(user string) *ai.Budget { return &ai.Budget{Plan: "trial", DailyTokens: 1000} }
+		},
+	})
+	b := h.connectQuery("user_id=erin")
+
+	b.send(map[string]interface{}{"type": "response.create", "response": map[string]interface{}{}})
+	ended := b.waitFor(ai.MsgTypeSessionEnded, waitTimeout)
+	if ended == nil || ended["reason"] != ai.SessionEndBudget {
+		t.Fatalf("got %v, want session.ended for %s", ended, ai.SessionEndBudget)
+	}
+
+	// the tool output is posted, but only the wrap-up follows it: upstream would
+	// reject a second response.create while the wrap-up is active
+	outputs, _ := toolEvents(t, h.upstream)
+	if len(outputs) != 1 {
+		t.Errorf("outputs = %v, want one", outputs)
+	}
+	var creates []string
+	for _, event := range h.upstream.Received() {
+		if event.Type == "response.create" {
+			creates = append(creates, string(event.Raw))
+		}
+	}
+	if len(creates) != 2 || !strings.Contains(creates[1], "budget_wrap_up") {
+		t.Errorf("upstream received response.create %v, want the browser's and the wrap-up", creates)
+	}
+}
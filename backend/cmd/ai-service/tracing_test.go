@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTurnTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	h := newHarness(t, harnessOptions{})
+	b := h.connect()
+	// the silence that ends the turn is sent once the turn has started, so its
+	// upstream writes belong to the turn
+	b.sendAudio(tone(300, 0))
+	if b.waitFor("input_audio_buffer.speech_started", waitTimeout) == nil {
+		t.Fatal("browser did not receive speech_started")
+	}
+	b.sendAudio(tone(0, 700))
+	if b.waitFor("response.done", waitTimeout) == nil {
+		t.Fatal("browser did not receive response.done")
+	}
+
+	var turn sdktrace.ReadOnlySpan
+	children := make(map[string][]sdktrace.ReadOnlySpan)
+	spans := recorder.Ended()
+	for _, span := range spans {
+		if span.Name() == "turn" {
+			turn = span
+		}
+	}
+	if turn == nil {
+		t.Fatalf("no turn span among %d ended spans", len(spans))
+	}
+	for _, span := range spans {
+		if span.Parent().SpanID() == turn.SpanContext().SpanID() {
+			children[span.Name()] = append(children[span.Name()], span)
+		}
+	}
+
+	attributes := make(map[string]string)
+	for _, attribute := range turn.Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["session.id"] != b.sessionId || attributes["turn"] != "1" {
+		t.Errorf("turn attributes = %v, want session %s and turn 1", attributes, b.sessionId)
+	}
+
+	for _, name := range []string{"turn.speech", "turn.response", "hub.route", "upstream.write"} {
+		if len(children[name]) == 0 {
+			t.Errorf("turn has no %s child span; children: %v", name, children)
+		}
+	}
+	if len(children["turn.speech"]) == 0 || len(children["turn.response"]) == 0 {
+		return
+	}
+	speech, response := children["turn.speech"][0], children["turn.response"][0]
+	if speech.EndTime().After(response.StartTime()) {
+		t.Error("speech span ends after the response starts")
+	}
+
+	var firstAudio sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "turn.first_audio" && span.Parent().SpanID() == response.SpanContext().SpanID() {
+			firstAudio = span
+		}
+	}
+	if firstAudio == nil {
+		t.Fatal("response has no turn.first_audio child span")
+	}
+	if firstAudio.EndTime().After(response.EndTime()) {
+		t.Error("first audio span ends after the response")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"interviews-ai/internal/ai/realtimetest"
+)
+
+func main() {
+	addr := flag.String("addr", ":5556", "address to listen on")
+	scriptPath := flag.String("script", "", "JSON file with an array of scripted responses")
+	latency := flag.Duration("latency", 0, "delay before every server event")
+	realTime := flag.Bool("realtime", true, "pace audio deltas at playback speed")
+	disconnectAfter := flag.Int("disconnect-after", 0, "close each connection after this many client events")
+	transcript := flag.String("input-transcript", "", "transcript reported for every user turn")
+	flag.Parse()
+
+	opts := realtimetest.Options{
+		Latency:         *latency,
+		RealTime:        *realTime,
+		DisconnectAfter: *disconnectAfter,
+		InputTranscript: *transcript,
+	}
+
+	if *scriptPath != "" {
+		data, err := os.ReadFile(*scriptPath)
+		if err != nil {
+			log.Fatal("Error reading script: ", err)
+		}
+		if err := json.Unmarshal(data, &opts.Script); err != nil {
+			log.Fatal("Error parsing script: ", err)
+		}
+	}
+
+	server := realtimetest.New(opts)
+
+	log.Printf("Starting mock realtime server on %s", *addr)
+	err := http.ListenAndServe(*addr, server.Handler())
+	if err != nil {
+		log.Fatalln("Unexpected serve error: ", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package admin serves the operator API for inspecting and controlling live sessions.
+//
+// Every endpoint requires the admin token as a bearer token:
+//
+//	GET  /admin/sessions                  list live sessions
+//	GET  /admin/sessions/{id}             one session, including its transcript
+//	POST /admin/sessions/{id}/terminate   end a session
+//	POST /admin/sessions/{id}/message     inject a system message, {"text": "...", "respond": true}
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/common/middleware"
+)
+
+// maxMessageLen bounds injected system messages, in bytes.
+const maxMessageLen = 8 << 10
+
+type Handler struct {
+	Hub   *ai.Hub
+	Token string
+}
+
+// SessionView is a session as reported by the admin API.
+type SessionView struct {
+	ai.SessionSnapshot
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// MessageRequest is the body of POST /admin/sessions/{id}/message.
+type MessageRequest struct {
+	Text string `json:"text"`
+	// Respond asks the model to answer the message right away.
+	Respond bool `json:"respond"`
+}
+
+func New(hub *ai.Hub, token string) *Handler {
+	return &Handler{Hub: hub, Token: token}
+}
+
+// Register adds the admin endpoints to mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	auth := middleware.RequireBearerToken(h.Token)
+	mux.HandleFunc("GET /admin/sessions", middleware.Handle(h.listSessions, auth))
+	mux.HandleFunc("GET /admin/sessions/{id}", middleware.Handle(h.getSession, auth))
+	mux.HandleFunc("POST /admin/sessions/{id}/terminate", middleware.Handle(h.terminateSession, auth))
+	mux.HandleFunc("POST /admin/sessions/{id}/message", middleware.Handle(h.injectMessage, auth))
+}
+
+func (h *Handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	sessions := make([]SessionView, 0)
+	for _, snapshot := range h.Hub.Sessions() {
+		// transcripts can be long; they are only returned for a single session
+		snapshot.Transcript = nil
+		sessions = append(sessions, newSessionView(snapshot, now))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+func (h *Handler) getSession(w http.ResponseWriter, r *http.Request) {
+	session := h.lookup(w, r)
+	if session == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, newSessionView(session.Snapshot(), time.Now()))
+}
+
+func (h *Handler) terminateSession(w http.ResponseWriter, r *http.Request) {
+	session := h.lookup(w, r)
+	if session == nil {
+		return
+	}
+	session.Logger.Info("Admin terminated session")
+	session.Close()
+	writeJSON(w, http.StatusAccepted, newSessionView(session.Snapshot(), time.Now()))
+}
+
+func (h *Handler) injectMessage(w http.ResponseWriter, r *http.Request) {
+	session := h.lookup(w, r)
+	if session == nil {
+		return
+	}
+
+	var request MessageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageLen+1024)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	request.Text = strings.TrimSpace(request.Text)
+	if request.Text == "" || len(request.Text) > maxMessageLen {
+		writeError(w, http.StatusBadRequest, "text must be between 1 and 8192 bytes")
+		return
+	}
+
+	if err := session.InjectSystemMessage(request.Text, request.Respond); err != nil {
+		if errors.Is(err, ai.ErrSessionNotActive) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadGateway, "failed to send message: "+err.Error())
+		return
+	}
+	session.Logger.Info("Admin injected a system message", "respond", request.Respond)
+	writeJSON(w, http.StatusAccepted, newSessionView(session.Snapshot(), time.Now()))
+}
+
+// lookup returns the session named in the path, writing a 404 if it is not live.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request) *ai.Session {
+	session := h.Hub.Session(r.PathValue("id"))
+	if session == nil {
+		writeError(w, http.StatusNotFound, "session not found")
+	}
+	return session
+}
+
+func newSessionView(snapshot ai.SessionSnapshot, now time.Time) SessionView {
+	return SessionView{
+		SessionSnapshot: snapshot,
+		DurationSeconds: now.Sub(snapshot.StartedAt).Seconds(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write admin response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -1,26 +1,37 @@
 package ai
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
-	"os"
+	"log/slog"
+	"path/filepath"
+	"sync"
 	"time"
 
-	"interviews-ai/internal/ai/templates"
+	"interviews-ai/internal/ai/cassette"
+	"interviews-ai/internal/ai/editor"
+	"interviews-ai/internal/ai/tools"
 	"interviews-ai/internal/ai/types"
+	"interviews-ai/internal/ai/vad"
+	"interviews-ai/internal/metrics"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ServerEvent represents the structure of events exchanged with the server.
 type ServerEvent struct {
-	Type     string                 `json:"type"`
-	Response map[string]interface{} `json:"response,omitempty"`
-	Session  map[string]interface{} `json:"session,omitempty"`
-	Delta    string                 `json:"delta,omitempty"`
+	Type       string                 `json:"type"`
+	Response   map[string]interface{} `json:"response,omitempty"`
+	Session    map[string]interface{} `json:"session,omitempty"`
+	Item       map[string]interface{} `json:"item,omitempty"`
+	Delta      string                 `json:"delta,omitempty"`
+	CallID     string                 `json:"call_id,omitempty"`
+	Name       string                 `json:"name,omitempty"`
+	Arguments  string                 `json:"arguments,omitempty"`
+	Transcript string                 `json:"transcript,omitempty"`
 }
 
 // SessionUpdateEvent represents the session.update event structure.
@@ -49,23 +60,112 @@ type InputAudioBufferAppend struct {
 type AIClient struct {
 	AiClientId string
 	ClientId   string
-	Conn       *websocket.Conn
+	Conn       UpstreamConn
 	Send       chan types.Message
 	Hub        *Hub
+	Tools      *tools.Registry
+	Provider   Provider
+	Records    RecordStore
+	// Usage, if set, keeps the usage totals of the session's user.
+	Usage UsageStore
+	// UsageKey is who Usage and Budget count the session against, the session's
+	// user if empty.
+	UsageKey string
+	// Budget, if set, limits the usage of the session's user; it needs Usage.
+	Budget  *Budget
+	Session *Session
+	// Config is what the session started with; session.configure changes apply over it.
+	Config *Config
+	// Logger is set by the session; logger() falls back to the default.
+	Logger *slog.Logger
+
+	// writeMu serializes writes to Conn, which are made from both pumps and tool calls.
+	writeMu   sync.Mutex
+	callsOnce sync.Once
+	calls     *functionCalls
+
+	// model is the upstream's model, from session.created.
+	model  string
+	budget budgetState
+
+	// speechStoppedAt is when the user last stopped speaking, until the reply starts.
+	// It is only used by the read pump.
+	speechStoppedAt time.Time
+
+	editorOnce          sync.Once
+	editor              *editor.Document
+	editorSyncedVersion int
+
+	// settings are the browser's choices and ptt its push-to-talk turn, only used by
+	// the write pump.
+	settingsOnce sync.Once
+	settings     sessionSettings
+	ptt          pushToTalk
+	gateOnce     sync.Once
+	gate         *vad.Gate
+}
+
+func (c *AIClient) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+func (c *AIClient) functionCalls() *functionCalls {
+	c.callsOnce.Do(func() {
+		c.calls = newFunctionCalls()
+	})
+	return c.calls
+}
+
+// writeJSON marshals v and writes it to the AI websocket connection.
+func (c *AIClient) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json marshal error: %v", err)
+	}
+	return c.writeMessage(websocket.TextMessage, data)
+}
+
+func (c *AIClient) writeMessage(messageType int, data []byte) error {
+	span := c.Session.startSpan("upstream.write", attribute.Int("bytes", len(data)))
+	defer span.End()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	err := c.Conn.WriteMessage(messageType, data)
+	if err != nil {
+		failSpan(span, err)
+	}
+	return err
+}
+
+// closeConn closes the connection once no write is in flight.
+func (c *AIClient) closeConn() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Conn.Close()
 }
 
 // Constants for message types.
 const (
-	MsgTypeSessionUpdate                = "session.update"
-	MsgTypeAudioBufferAppend            = "input_audio_buffer.append"
-	MsgTypeAudioBufferCommit            = "input_audio_buffer.commit"
-	MsgTypeResponseCreate               = "response.create"
-	MsgTypeResponseDone                 = "response.done"
-	MsgTypeResponseError                = "error"
-	MsgTypeResponseAudioDelta           = "response.audio.delta"
-	MsgTypeResponseAudioTranscriptDelta = "response.audio_transcript.delta"
-	MsgTypeAudioTranscriptDelta         = "response.audio_transcript.delta"
-	MsgTypeResponseContentPartAdded     = "response.content_part.added"
+	MsgTypeSessionUpdate                    = "session.update"
+	MsgTypeAudioBufferAppend                = "input_audio_buffer.append"
+	MsgTypeAudioBufferCommit                = "input_audio_buffer.commit"
+	MsgTypeResponseCreate                   = "response.create"
+	MsgTypeResponseCreated                  = "response.created"
+	MsgTypeResponseDone                     = "response.done"
+	MsgTypeResponseError                    = "error"
+	MsgTypeResponseAudioDelta               = "response.audio.delta"
+	MsgTypeResponseAudioTranscriptDone      = "response.audio_transcript.done"
+	MsgTypeSpeechStarted                    = "input_audio_buffer.speech_started"
+	MsgTypeSpeechStopped                    = "input_audio_buffer.speech_stopped"
+	MsgTypeResponseAudioTranscriptDelta     = "response.audio_transcript.delta"
+	MsgTypeAudioTranscriptDelta             = "response.audio_transcript.delta"
+	MsgTypeResponseContentPartAdded         = "response.content_part.added"
+	MsgTypeInputAudioTranscriptionCompleted = "conversation.item.input_audio_transcription.completed"
 
 	// WebSocket timing constants
 	writeWait  = 10 * time.Second
@@ -88,6 +188,14 @@ type IncomingMessage struct {
 		Modalities   []Modality `json:"modalities"`
 		Instructions string     `json:"instructions"`
 	} `json:"response,omitempty"`
+
+	// session.configure fields
+	Session *SessionOptions `json:"session,omitempty"`
+
+	// editor.patch fields
+	BaseVersion int              `json:"base_version,omitempty"`
+	Ops         editor.Operation `json:"ops,omitempty"`
+	Language    string           `json:"language,omitempty"`
 }
 
 type AIMessageType string
@@ -98,64 +206,118 @@ const (
 	ResponseCreate      AIMessageType = "response.create"
 )
 
+// Config is what the AI side of the service needs at runtime. It is built by the
+// config package; zero values select the defaults below.
 type Config struct {
+	// Provider selects the Realtime API backend: azure (default), openai, mock, cascade or replay.
+	Provider string
 	APIKey   string
 	Endpoint string
+	Cascade  CascadeConfig
+	// RecordDir, if set, records every upstream session as a cassette in this directory.
+	RecordDir string
+	// ReplayCassette is the cassette served by the replay provider, at ReplaySpeed
+	// times real time; a speed of 0 replays as fast as possible.
+	ReplayCassette string
+	ReplaySpeed    float64
+	// RecordsDir is where session records are written; records are not kept when empty.
+	RecordsDir string
+	Tracing    TracingConfig
+	// Breaker guards upstream dials; zero values select the defaults.
+	Breaker BreakerConfig
+
+	// Voice, Temperature and TurnDetection are sent in the initial session.update.
+	Voice         string
+	Temperature   float64
+	TurnDetection TurnDetection
+	// DialTimeout bounds the upstream websocket handshake.
+	DialTimeout time.Duration
+	// SendBuffer is the capacity of each client's Send channel.
+	SendBuffer int
+	// MaxMessageBytes limits the size of a browser message; 0 means no limit.
+	MaxMessageBytes int64
+	// MaxSessionDuration ends sessions that run longer; 0 means no limit.
+	MaxSessionDuration time.Duration
+	// Prices convert token usage to cost, by model. PricingModel, if set, is used
+	// instead of the model the upstream reports.
+	Prices       PriceTable
+	PricingModel string
+	// NoiseGate, if set, drops silent audio from the browser before it is sent upstream.
+	NoiseGate *vad.Config
 }
 
-func LoadConfig() (*Config, error) {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("No .env file found. Proceeding with environment variables.")
-	}
-
-	apiKey := os.Getenv("AZURE_OPENAI_API_KEY")
-	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
+// TurnDetection configures voice activity detection. Nil fields leave the
+// upstream's defaults in place, so an explicit zero is still sent.
+type TurnDetection struct {
+	// Type is the Realtime turn_detection type, server_vad by default.
+	Type              string
+	Threshold         *float64
+	PrefixPaddingMs   *int
+	SilenceDurationMs *int
+}
 
-	if apiKey == "" || endpoint == "" {
-		return nil, fmt.Errorf("missing required environment variables")
-	}
+// Defaults of Config.
+const (
+	DefaultVoice       = "alloy"
+	DefaultTemperature = 0.8
+	DefaultSendBuffer  = 1024
+	DefaultDialTimeout = 10 * time.Second
+	TurnDetectionVAD   = "server_vad"
+)
 
-	return &Config{
-		APIKey:   apiKey,
-		Endpoint: endpoint,
-	}, nil
+// CascadeConfig configures the OpenAI compatible backends of the cascade provider.
+// The per-stage base URLs default to BaseURL.
+type CascadeConfig struct {
+	BaseURL     string
+	APIKey      string
+	STTBaseURL  string
+	STTModel    string
+	ChatBaseURL string
+	ChatModel   string
+	TTSBaseURL  string
+	TTSModel    string
 }
 
-// createAIWebSocketConnection establishes a WebSocket connection to Azure OpenAI's Realtime API.
-func CreateAIWebSocketConnection(config *Config) (*websocket.Conn, error) {
-	// Load environment variables from .env file
-	err := godotenv.Load()
+// createAIWebSocketConnection establishes a WebSocket connection to the provider's Realtime API.
+// Tools in the registry, if any, are advertised to the model in the initial session.update.
+func CreateAIWebSocketConnection(config *Config, provider Provider, registry *tools.Registry, instructions string) (UpstreamConn, error) {
+	start := time.Now()
+	conn, err := dialUpstream(config, provider, registry, instructions)
 	if err != nil {
-		log.Println("No .env file found. Proceeding with environment variables.")
+		metrics.UpstreamDialFailures.WithLabelValues(provider.Name()).Inc()
+		return nil, err
 	}
+	metrics.UpstreamDialSeconds.WithLabelValues(provider.Name()).Observe(time.Since(start).Seconds())
+	return conn, nil
+}
 
-	// Define WebSocket dialer
-	dialer := websocket.DefaultDialer
-	header := make(http.Header)
-
-	header.Set("api-key", config.APIKey) // Use Authorization header
-
+func dialUpstream(config *Config, provider Provider, registry *tools.Registry, instructions string) (UpstreamConn, error) {
 	// Connect to WebSocket server
-	conn, _, err := dialer.Dial(config.Endpoint, header)
+	conn, err := provider.Dial(config)
 	if err != nil {
-		return nil, fmt.Errorf("dial error: %v", err)
+		return nil, err
+	}
+
+	if config.RecordDir != "" {
+		path := filepath.Join(config.RecordDir, fmt.Sprintf("%s-%s.jsonl", time.Now().Format("20060102-150405"), uuid.New().String()[:8]))
+		recorder, err := cassette.Record(conn, path)
+		if err != nil {
+			slog.Warn("Not recording upstream session", "error", err)
+		} else {
+			slog.Info("Recording upstream session", "path", path)
+			conn = recorder
+		}
 	}
 
 	// Update the initial session to our desired task
 	sessionUpdate := SessionUpdateEvent{
-		Type: "session.update",
-		Session: map[string]interface{}{
-			"modalities":          []string{"audio", "text"},
-			"instructions":        templates.InterviewInstructions,
-			"temperature":         0.8,
-			"voice":               "alloy",
-			"input_audio_format":  "pcm16",
-			"output_audio_format": "pcm16",
-			"turn_detection": map[string]interface{}{
-				"type": "server_vad",
-			},
-		},
+		Type:    "session.update",
+		Session: provider.SessionDefaults(config),
+	}
+	sessionUpdate.Session["instructions"] = instructions
+	if registry.Len() > 0 {
+		sessionUpdate.Session["tools"] = registry.Definitions()
+		sessionUpdate.Session["tool_choice"] = "auto"
 	}
 	initialData, err := json.Marshal(sessionUpdate)
 	if err != nil {
@@ -163,221 +325,274 @@ func CreateAIWebSocketConnection(config *Config) (*websocket.Conn, error) {
 	}
 
 	if err := conn.WriteMessage(websocket.TextMessage, initialData); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("write initial message error: %v", err)
 	}
 
 	return conn, nil
 }
 
-func SendSessionUpdate(c *AIClient) {
-	// Send initial event (session.update)
-	sessionUpdate := SessionUpdateEvent{
-		Type: "session.update",
-		Session: map[string]interface{}{
-			"commit":          true,
-			"cancel_previous": true,
-			"instructions":    "Help me prepare for my upcoming Growth Engineering interview",
-			"modalities":      []string{"audio", "text"},
-		},
-	}
-	data, err := json.Marshal(sessionUpdate)
-	if err != nil {
-		log.Printf("Failed to marshal response.create event: %v", err)
-		return
-	}
-
-	if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Printf("Failed to send response.create event: %v", err)
-		return
-	}
-
-	log.Println("Sent response.create event to server.")
-}
-
-// sendResponseCreate sends a response.create event to the server.
-func SendResponseCreate(c *AIClient) {
-	responseCreate := ResponseCreateEvent{
-		Type: "response.create",
-		Response: map[string]interface{}{
-			"commit":          true,
-			"cancel_previous": true,
-			"instructions":    "Help me prepare for my upcoming Growth Engineering interview",
-			"modalities":      []string{"audio", "text"},
-		},
-	}
-	data, err := json.Marshal(responseCreate)
-	if err != nil {
-		log.Printf("Failed to marshal response.create event: %v", err)
-		return
-	}
-
-	if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Printf("Failed to send response.create event: %v", err)
-		return
-	}
-
-	log.Println("Sent response.create event to server.")
-}
-
-// handleAIResponse processes incoming server events.
-func handleAIResponse(c *AIClient, message []byte) {
+// handleAIResponse processes incoming server events. It reports whether the
+// session ends once the event has reached the browser.
+func handleAIResponse(c *AIClient, message []byte) (end bool) {
 	var event ServerEvent
 	if err := json.Unmarshal(message, &event); err != nil {
-		log.Printf("handleAIResponse JSON Parse error: %v. Message: %s", err, string(message))
-		return
+		c.logger().Error("Failed to parse AI event", "error", err, "bytes", len(message))
+		return false
 	}
 
 	eventType := event.Type
-	log.Printf("******Client event %v", eventType)
+	c.Session.noteEvent(metrics.FromUpstream, eventType)
+	c.Session.traceEvent(event)
 
 	switch eventType {
 	case "session.created":
-		log.Println("Session created successfully.")
-		SendSessionUpdate(c)
+		c.model, _ = event.Session["model"].(string)
+		c.logger().Info("Upstream session created", "model", c.model)
+		if _, ok := c.prices(); !ok && c.Config != nil && c.Config.Prices != nil {
+			c.logger().Warn("No prices for the model, response costs are not counted", "model", c.model)
+		}
 	case "session.updated":
 		//handleAudioDelta(c, event)
 	case MsgTypeResponseCreate:
-		log.Println("Response creation initiated.")
+		c.logger().Debug("Response creation initiated.")
 	case MsgTypeResponseDone:
-		handleAudioDone(c, event)
+		countResponse(c, event)
+		end = wrapUpDone(event)
+		handleFunctionCallEvent(c, event)
 	case MsgTypeResponseError:
-		errMsg, exists := event.Response["error"].(string)
-		if exists {
-			log.Printf("Received error from server: %v", errMsg)
-		} else {
-			log.Printf("Received error from server: <nil>")
-		}
+		errMsg, _ := event.Response["error"].(string)
+		c.logger().Error("Received error from server", "error", errMsg)
+	case MsgTypeSpeechStopped:
+		c.speechStoppedAt = time.Now()
 	case MsgTypeResponseAudioDelta:
-		//
-	case "response.created":
-		log.Println("Response created successfully.")
-	case "response.output_item.added":
-		log.Println("Response output item added.")
-	case "conversation.item.created":
-		log.Println("Conversation item created.")
-	case "response.audio_transcript.delta":
-		log.Println("AI event: response.audio_transcript.delta")
+		if !c.speechStoppedAt.IsZero() {
+			metrics.TimeToFirstAudio.Observe(time.Since(c.speechStoppedAt).Seconds())
+			c.speechStoppedAt = time.Time{}
+		}
+		c.Session.count(func(usage *SessionUsage) {
+			usage.AudioBytesOut += int64(base64.StdEncoding.DecodedLen(len(event.Delta)))
+		})
+	case MsgTypeInputAudioTranscriptionCompleted:
+		c.Session.addTranscript("user", event.Transcript)
+	case MsgTypeResponseAudioTranscriptDone:
+		c.Session.addTranscript("assistant", event.Transcript)
+	case MsgTypeResponseCreated:
+		handleFunctionCallEvent(c, event)
+	case MsgTypeResponseOutputItemAdded:
+		handleFunctionCallEvent(c, event)
+	case MsgTypeResponseOutputItemDone, MsgTypeFunctionCallArgumentsDelta, MsgTypeFunctionCallArgumentsDone:
+		handleFunctionCallEvent(c, event)
+	case "conversation.item.created", "response.audio_transcript.delta":
 	default:
-		log.Printf("Unknown AI client event type: %s", eventType)
+		c.logger().Debug("Unhandled AI event", "type", eventType)
 	}
+	return end
 }
 
-// handleAudioDone handles the response.audio.done event.
-func handleAudioDone(c *AIClient, event ServerEvent) {
-	log.Println("Handling response.audio.done event")
+// saveRecord persists what is kept about the session once the AI connection closes.
+func saveRecord(c *AIClient) {
+	if c.Records == nil {
+		return
+	}
+	snapshot := c.Session.Snapshot()
+	record := &SessionRecord{
+		SessionId:  snapshot.ID,
+		ClientId:   c.ClientId,
+		AiClientId: c.AiClientId,
+		UserID:     snapshot.UserID,
+		Template:   snapshot.Template,
+		StartedAt:  snapshot.StartedAt,
+		EndedAt:    time.Now(),
+		Usage:      snapshot.Usage,
+		Transcript: snapshot.Transcript,
+	}
+	if code := c.editorDocument().Snapshot(); code.Version > 0 {
+		record.Code = &code
+	}
+	if err := c.Records.SaveRecord(record); err != nil {
+		c.logger().Error("Failed to save session record", "error", err)
+	}
 }
 
 // handleAudioDelta handles the response.audio.delta event.
 func handleAudioDelta(c *AIClient, event ServerEvent) {
-	log.Printf("Played audio chunk of size: %d bytes")
+	c.logger().Debug("Played audio chunk", "bytes", len(event.Delta))
 }
 
 // aiClientReadPump listens for incoming messages from the AI WebSocket connection.
 func (c *AIClient) AiClientReadPump() {
 	defer func() {
-		log.Println("AiClientReadPump: closing connection.")
-		c.Hub.UnregisterAIClient <- c
-		c.Conn.Close()
+		c.logger().Debug("AiClientReadPump: closing connection.")
+		c.Session.Close()
 	}()
 
 	for {
 		messageType, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err) {
-				log.Println("Unexpected websocket close err: ", err)
+				c.logger().Warn("AI connection closed unexpectedly", "error", err)
 			}
 			break
 		}
 
+		if c.Provider != nil {
+			message = c.Provider.NormalizeEvent(message)
+		}
+
+		var end bool
 		switch messageType {
-		case websocket.TextMessage:
-			log.Println("Received text message from AI")
-			handleAIResponse(c, message)
-		case websocket.BinaryMessage:
-			log.Println("Received binary (audio) message from AI")
-			handleAIResponse(c, message)
+		case websocket.TextMessage, websocket.BinaryMessage:
+			end = handleAIResponse(c, message)
 		default:
-			log.Printf("Unknown message type: %d", messageType)
+			c.logger().Warn("Unknown message type from AI", "message_type", messageType)
 			continue
 		}
 
-		log.Printf("aiClientReadPump messageType: %v", messageType)
-		// write to the hub
-		c.Hub.HandleAIClientWrite <- types.Message{
+		// route to the browser
+		msg := types.Message{
 			SenderID:   c.AiClientId,
 			Payload:    message,
 			ReceiverID: c.ClientId,
 			Type:       types.TextMessage,
 		}
+		if !c.Session.toClient(msg) {
+			return
+		}
+		// the wrap-up's response.done goes out before session.ended
+		if end {
+			c.Session.End(SessionEndBudget)
+		}
 	}
 }
 
 // aiClientWritePump sends outgoing messages to the WebSocket connection.
 func (c *AIClient) AiClientWritePump() {
 	ticker := time.NewTicker(pingPeriod)
+	editorTicker := time.NewTicker(editorSyncPeriod)
 	defer func() {
-		log.Println("AiClientWritePump: closing connection.")
+		c.logger().Debug("AiClientWritePump: closing connection.")
 		ticker.Stop()
-		c.Conn.Close()
+		editorTicker.Stop()
+		c.Session.Close()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.Send:
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			// Parse incoming message
-			var incomingMsg IncomingMessage
-			if err := json.Unmarshal(message.Payload, &incomingMsg); err != nil {
-				log.Printf("Error unmarshalling message: %v", err)
-				continue
-			}
-
-			switch incomingMsg.Type {
-			case "input_audio_buffer.append":
-				// Forward audio to AI
-				audioMessage := InputAudioBufferAppend{
-					Type:  "input_audio_buffer.append",
-					Audio: incomingMsg.Audio, // base64-encoded
-				}
-				jsonData, err := json.Marshal(audioMessage)
-				if err != nil {
-					log.Printf("Error marshalling audio message: %v", err)
-					continue
-				}
-				if err := c.Conn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
-					log.Printf("Error writing audio to AI websocket: %v", err)
+		case <-c.Session.stop:
+			// forward what the browser sent before the session ended
+			for {
+				select {
+				case message := <-c.Send:
+					if !c.writeEvent(message) {
+						return
+					}
+				default:
+					c.writeMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 					return
 				}
+			}
 
-			case "response.create":
-				responseCreate := ResponseCreateEvent{
-					Type: "response.create",
-					Response: map[string]interface{}{
-						"modalities":   []string{"audio", "text"},
-						"instructions": incomingMsg.Response.Instructions,
-						"commit":       true,
-					},
-				}
-				jsonData, err := json.Marshal(responseCreate)
-				if err != nil {
-					log.Printf("Error marshalling text esponse create: %v", err)
-					continue
-				}
-				if err := c.Conn.WriteMessage(websocket.TextMessage, jsonData); err != nil {
-					log.Printf("Error writing text to AI websocket: %v", err)
-					return
-				}
+		case message := <-c.Send:
+			if !c.writeEvent(message) {
+				return
 			}
 
+		case <-editorTicker.C:
+			syncEditorContext(c)
+
 		case <-ticker.C:
+			c.writeMu.Lock()
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			err := c.Conn.WriteMessage(websocket.PingMessage, nil)
+			c.writeMu.Unlock()
+			if err != nil {
 				return
 			}
 		}
 	}
 }
+
+// writeEvent handles a message from the browser, forwarding what upstream needs,
+// and reports false if the pump should stop.
+func (c *AIClient) writeEvent(message types.Message) bool {
+	// Parse incoming message
+	var incomingMsg IncomingMessage
+	if err := json.Unmarshal(message.Payload, &incomingMsg); err != nil {
+		c.logger().Warn("Failed to decode client message", "error", err)
+		return true
+	}
+	c.Session.noteEvent(metrics.FromClient, incomingMsg.Type)
+	// a session wrapping up takes no new turns
+	if c.budget.wrappingUp.Load() && wrapUpIgnored[incomingMsg.Type] {
+		return true
+	}
+
+	switch incomingMsg.Type {
+	case "input_audio_buffer.append":
+		audioBytes := base64.StdEncoding.DecodedLen(len(incomingMsg.Audio))
+		c.Session.count(func(usage *SessionUsage) {
+			usage.AudioBytesIn += int64(audioBytes)
+		})
+		// Forward audio to AI, without the silence the noise gate drops
+		for _, audio := range gateAudio(c, incomingMsg.Audio) {
+			audioMessage := InputAudioBufferAppend{
+				Type:  "input_audio_buffer.append",
+				Audio: audio, // base64-encoded
+			}
+			jsonData, err := json.Marshal(audioMessage)
+			if err != nil {
+				c.logger().Error("Failed to marshal audio message", "error", err)
+				continue
+			}
+			if err := c.writeMessage(websocket.TextMessage, jsonData); err != nil {
+				c.logger().Error("Failed to write audio to AI websocket", "error", err)
+				return false
+			}
+			if c.ptt.talking {
+				c.ptt.audioBytes += base64.StdEncoding.DecodedLen(len(audio))
+			}
+		}
+
+	case "response.create":
+		responseCreate := ResponseCreateEvent{
+			Type: "response.create",
+			Response: map[string]interface{}{
+				"modalities":   []string{"audio", "text"},
+				"instructions": incomingMsg.Response.Instructions,
+				"commit":       true,
+			},
+		}
+		jsonData, err := json.Marshal(responseCreate)
+		if err != nil {
+			c.logger().Error("Failed to marshal response.create", "error", err)
+			return true
+		}
+		if err := c.writeMessage(websocket.TextMessage, jsonData); err != nil {
+			c.logger().Error("Failed to write response.create to AI websocket", "error", err)
+			return false
+		}
+
+	case MsgTypeSessionConfigure:
+		if err := handleSessionConfigure(c, incomingMsg); err != nil {
+			c.logger().Error("Failed to write session.update to AI websocket", "error", err)
+			return false
+		}
+
+	case MsgTypePTTStart:
+		if err := handlePTTStart(c); err != nil {
+			c.logger().Error("Failed to write input_audio_buffer.clear to AI websocket", "error", err)
+			return false
+		}
+
+	case MsgTypePTTStop:
+		if err := handlePTTStop(c); err != nil {
+			c.logger().Error("Failed to end push-to-talk turn on AI websocket", "error", err)
+			return false
+		}
+
+	case MsgTypeEditorPatch:
+		handleEditorPatch(c, incomingMsg)
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// Defaults of BreakerConfig.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned instead of dialing while the upstream is failing.
+var ErrCircuitOpen = errors.New("upstream circuit is open")
+
+// BreakerConfig configures the circuit breaker in front of upstream dials.
+type BreakerConfig struct {
+	// Threshold is how many dials in a row must fail to open the circuit.
+	Threshold int
+	// Cooldown is how long the circuit stays open before a trial dial is let through.
+	Cooldown time.Duration
+}
+
+// Breaker stops dialing the upstream after repeated failures, so new sessions fail
+// fast and readiness checks report the outage. Once Cooldown has passed a single
+// trial dial is let through: it closes the circuit if it succeeds and opens it
+// again if it fails.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func NewBreaker(config BreakerConfig) *Breaker {
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultBreakerThreshold
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultBreakerCooldown
+	}
+	return &Breaker{threshold: config.Threshold, cooldown: config.Cooldown, now: time.Now}
+}
+
+// State returns closed, open or half-open.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+func (b *Breaker) state() string {
+	switch {
+	case b.failures < b.threshold:
+		return CircuitClosed
+	case b.now().Sub(b.openedAt) < b.cooldown:
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// Allow reports whether a dial may be attempted, returning ErrCircuitOpen if not.
+// Every allowed dial must be followed by a call to Record.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Record reports the result of an allowed dial.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// Check fails while the circuit is open, for readiness checks.
+func (b *Breaker) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state := b.state(); state == CircuitOpen {
+		return fmt.Errorf("%w after %d failed dials", ErrCircuitOpen, b.failures)
+	}
+	return nil
+}
+
+// WithBreaker returns provider with its dials guarded by breaker.
+func WithBreaker(provider Provider, breaker *Breaker) Provider {
+	return breakerProvider{Provider: provider, breaker: breaker}
+}
+
+type breakerProvider struct {
+	Provider
+	breaker *Breaker
+}
+
+func (p breakerProvider) Dial(config *Config) (UpstreamConn, error) {
+	if err := p.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	conn, err := p.Provider.Dial(config)
+	p.breaker.Record(err)
+	return conn, err
+}
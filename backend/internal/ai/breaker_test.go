@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewBreaker(BreakerConfig{Threshold: 2, Cooldown: time.Minute})
+	breaker.now = func() time.Time { return now }
+	failure := errors.New("dial failed")
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("dial %d: Allow() = %v while closed", i, err)
+		}
+		breaker.Record(failure)
+	}
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("state after 2 failures = %s, want open", state)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() while open = %v, want ErrCircuitOpen", err)
+	}
+	if err := breaker.Check(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Check() while open = %v, want ErrCircuitOpen", err)
+	}
+
+	// after the cooldown a single trial is let through, and a failure reopens
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("trial Allow() = %v", err)
+	}
+	if err := breaker.Allow(); err == nil {
+		t.Fatal("a second dial was allowed during the trial")
+	}
+	breaker.Record(failure)
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("state after a failed trial = %s, want open", state)
+	}
+
+	now = now.Add(time.Minute)
+	breaker.Allow()
+	breaker.Record(nil)
+	if state := breaker.State(); state != CircuitClosed || breaker.Check() != nil {
+		t.Errorf("state after a successful trial = %s, want closed", state)
+	}
+}
@@ -0,0 +1,188 @@
+package ai
+
+import (
+	"sync/atomic"
+	"time"
+
+	"interviews-ai/internal/metrics"
+)
+
+// Constants for the budget events sent to the browser.
+const (
+	// MsgTypeBudgetWarning is sent once per session when the user nears a limit.
+	MsgTypeBudgetWarning = "budget.warning"
+	// MsgTypeBudgetExceeded is sent when the user reaches a limit; the model then
+	// wraps up the interview and the session is ended.
+	MsgTypeBudgetExceeded = "budget.exceeded"
+
+	// SessionEndBudget ends a session whose user reached a budget limit.
+	SessionEndBudget = "budget_exceeded"
+)
+
+// Defaults of Budget.
+const (
+	DefaultBudgetWarnAt  = 0.8
+	DefaultWrapUpTimeout = 30 * time.Second
+)
+
+// wrapUpPurpose is the metadata of the response that wraps up a session, so its
+// response.done can be told apart.
+const wrapUpPurpose = "budget_wrap_up"
+
+// WrapUpInstructions ask the model to end an interview whose user ran out of budget.
+var WrapUpInstructions = "The interview has to end now. Do not ask any more questions. " +
+	"Briefly thank the candidate, give them concise feedback on what went well and what to improve, and say goodbye."
+
+// Budget limits the usage of one user per day and per month, in UTC. Zero limits
+// are not enforced.
+type Budget struct {
+	// Plan names the budget in events and logs.
+	Plan          string
+	DailyUSD      float64
+	MonthlyUSD    float64
+	DailyTokens   int64
+	MonthlyTokens int64
+	// WarnAt is the share of a limit at which the browser is warned,
+	// DefaultBudgetWarnAt if zero.
+	WarnAt float64
+	// WrapUpTimeout bounds the wrap-up response, after which the session is ended
+	// anyway; DefaultWrapUpTimeout if zero.
+	WrapUpTimeout time.Duration
+}
+
+// BudgetStatus is the limit a user is closest to.
+type BudgetStatus struct {
+	// Period is daily or monthly, and Unit usd or tokens.
+	Period string  `json:"period"`
+	Unit   string  `json:"unit"`
+	Used   float64 `json:"used"`
+	Limit  float64 `json:"limit"`
+	// Share is Used over Limit.
+	Share float64 `json:"share"`
+	// ResetsAt is when the period ends.
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// BudgetEvent is the payload of budget.warning and budget.exceeded.
+type BudgetEvent struct {
+	Type string `json:"type"`
+	Plan string `json:"plan,omitempty"`
+	BudgetStatus
+}
+
+// Status returns the limit of b that usage is closest to at now. A budget without
+// limits has a zero status.
+func (b *Budget) Status(usage UserUsage, now time.Time) BudgetStatus {
+	now = now.UTC()
+	day, month := usage.Daily.in(now.Format(dayLayout)), usage.Monthly.in(now.Format(monthLayout))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var status BudgetStatus
+	for _, limit := range []BudgetStatus{
+		{Period: "daily", Unit: "usd", Used: day.CostUSD, Limit: b.DailyUSD, ResetsAt: today.AddDate(0, 0, 1)},
+		{Period: "monthly", Unit: "usd", Used: month.CostUSD, Limit: b.MonthlyUSD, ResetsAt: thisMonth.AddDate(0, 1, 0)},
+		{Period: "daily", Unit: "tokens", Used: float64(day.Tokens), Limit: float64(b.DailyTokens), ResetsAt: today.AddDate(0, 0, 1)},
+		{Period: "monthly", Unit: "tokens", Used: float64(month.Tokens), Limit: float64(b.MonthlyTokens), ResetsAt: thisMonth.AddDate(0, 1, 0)},
+	} {
+		if limit.Limit <= 0 {
+			continue
+		}
+		limit.Share = limit.Used / limit.Limit
+		if limit.closerThan(status) {
+			status = limit
+		}
+	}
+	return status
+}
+
+// closerThan reports whether s is a closer limit than other: the larger share, or
+// of limits both reached, the one lasting longer.
+func (s BudgetStatus) closerThan(other BudgetStatus) bool {
+	if s.Share >= 1 && other.Share >= 1 {
+		return s.ResetsAt.After(other.ResetsAt)
+	}
+	return s.Share > other.Share
+}
+
+func (b *Budget) warnAt() float64 {
+	if b.WarnAt > 0 {
+		return b.WarnAt
+	}
+	return DefaultBudgetWarnAt
+}
+
+func (b *Budget) wrapUpTimeout() time.Duration {
+	if b.WrapUpTimeout > 0 {
+		return b.WrapUpTimeout
+	}
+	return DefaultWrapUpTimeout
+}
+
+// budgetState tracks a session's budget events.
+type budgetState struct {
+	warned bool
+	// wrappingUp is set once the budget is exceeded; the write pump then takes no
+	// new turns from the browser.
+	wrappingUp atomic.Bool
+}
+
+// wrapUpIgnored are the browser events dropped while a session wraps up.
+var wrapUpIgnored = map[string]bool{
+	MsgTypeAudioBufferAppend: true,
+	MsgTypeAudioBufferCommit: true,
+	MsgTypeResponseCreate:    true,
+	MsgTypePTTStart:          true,
+	MsgTypePTTStop:           true,
+}
+
+// checkBudget warns the browser when its user nears the budget, and wraps up the
+// session once it is exceeded.
+func checkBudget(c *AIClient, usage UserUsage) {
+	if c.Budget == nil || c.budget.wrappingUp.Load() {
+		return
+	}
+	status := c.Budget.Status(usage, time.Now())
+	switch {
+	case status.Share >= 1:
+		wrapUp(c, status)
+	case status.Share >= c.Budget.warnAt() && !c.budget.warned:
+		c.budget.warned = true
+		metrics.BudgetEvents.WithLabelValues("warning").Inc()
+		c.logger().Info("User nearing budget", "plan", c.Budget.Plan, "period", status.Period, "unit", status.Unit, "share", status.Share)
+		sendToClient(c, BudgetEvent{Type: MsgTypeBudgetWarning, Plan: c.Budget.Plan, BudgetStatus: status})
+	}
+}
+
+// wrapUp asks the model to close the interview with feedback. The session ends
+// once that response is done, or after the wrap-up timeout.
+func wrapUp(c *AIClient, status BudgetStatus) {
+	c.budget.wrappingUp.Store(true)
+	metrics.BudgetEvents.WithLabelValues("exceeded").Inc()
+	c.logger().Warn("User exceeded budget, wrapping up the session", "plan", c.Budget.Plan, "period", status.Period, "unit", status.Unit, "used", status.Used)
+	sendToClient(c, BudgetEvent{Type: MsgTypeBudgetExceeded, Plan: c.Budget.Plan, BudgetStatus: status})
+
+	session := c.Session
+	time.AfterFunc(c.Budget.wrapUpTimeout(), func() { session.End(SessionEndBudget) })
+	err := c.writeJSON(systemMessageItem(WrapUpInstructions))
+	if err == nil {
+		err = c.writeJSON(ResponseCreateEvent{
+			Type: MsgTypeResponseCreate,
+			Response: map[string]interface{}{
+				"modalities": []string{"audio", "text"},
+				"metadata":   map[string]interface{}{"purpose": wrapUpPurpose},
+			},
+		})
+	}
+	if err != nil {
+		c.logger().Error("Failed to ask the model to wrap up", "error", err)
+		session.End(SessionEndBudget)
+	}
+}
+
+// wrapUpDone reports whether event is the end of the wrap-up response, after
+// which the session ends.
+func wrapUpDone(event ServerEvent) bool {
+	metadata, _ := event.Response["metadata"].(map[string]interface{})
+	return metadata["purpose"] == wrapUpPurpose
+}
@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetStatus(t *testing.T) {
+	now := time.Date(2026, 3, 31, 22, 0, 0, 0, time.UTC)
+	usage := UserUsage{
+		Daily:   PeriodUsage{Period: "2026-03-31", Tokens: 900, CostUSD: 1},
+		Monthly: PeriodUsage{Period: "2026-03", Tokens: 5000, CostUSD: 20},
+	}
+	for _, test := range []struct {
+		name   string
+		budget Budget
+		usage  UserUsage
+		want   BudgetStatus
+	}{
+		{name: "no limits", budget: Budget{}, usage: usage, want: BudgetStatus{}},
+		{
+			name:   "closest limit",
+			budget: Budget{DailyUSD: 4, MonthlyUSD: 25},
+			usage:  usage,
+			want:   BudgetStatus{Period: "monthly", Unit: "usd", Used: 20, Limit: 25, Share: 0.8, ResetsAt: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			// the month lasts as long as the day here, so the daily limit is kept
+			name:   "exceeded limits",
+			budget: Budget{DailyTokens: 900, MonthlyTokens: 4000},
+			usage:  usage,
+			want:   BudgetStatus{Period: "daily", Unit: "tokens", Used: 900, Limit: 900, Share: 1, ResetsAt: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "past periods",
+			budget: Budget{DailyTokens: 1000, MonthlyUSD: 10},
+			usage:  UserUsage{Daily: PeriodUsage{Period: "2026-03-30", Tokens: 5000}, Monthly: PeriodUsage{Period: "2026-02", CostUSD: 50}},
+			want:   BudgetStatus{},
+		},
+	} {
+		if got := test.budget.Status(test.usage, now); got != test.want {
+			t.Errorf("%s: Status = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
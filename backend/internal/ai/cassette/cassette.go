@@ -0,0 +1,142 @@
+// Package cassette records upstream Realtime sessions as JSONL cassettes and
+// replays them, so sessions seen in production can be reproduced offline.
+//
+// Each line of a cassette is a Frame. Frames are in the order they crossed the
+// connection; received frames are replayed only once the client has sent as many
+// frames as it had sent when they were recorded, which keeps replays deterministic
+// regardless of timing.
+package cassette
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Directions of a frame.
+const (
+	Send = "send"
+	Recv = "recv"
+)
+
+// Frame is one websocket message of a recorded session.
+type Frame struct {
+	// Offset is the time since the start of the recording, in milliseconds.
+	Offset int64  `json:"t"`
+	Dir    string `json:"dir"`
+	Type   int    `json:"type"`
+	// Data holds JSON text messages; other payloads are kept base64 encoded in Binary.
+	Data   json.RawMessage `json:"data,omitempty"`
+	Binary []byte          `json:"binary,omitempty"`
+}
+
+func (f Frame) payload() []byte {
+	if f.Data != nil {
+		return f.Data
+	}
+	return f.Binary
+}
+
+// Conn is the upstream connection surface that is recorded and replayed.
+type Conn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// Recorder wraps a connection and appends every frame to a cassette file.
+type Recorder struct {
+	Conn
+	start time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Record starts recording conn to a new cassette at path.
+func Record(conn Conn, path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create cassette: %v", err)
+	}
+	return &Recorder{Conn: conn, start: time.Now(), file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (r *Recorder) ReadMessage() (int, []byte, error) {
+	messageType, data, err := r.Conn.ReadMessage()
+	if err == nil {
+		r.record(Recv, messageType, data)
+	}
+	return messageType, data, err
+}
+
+func (r *Recorder) WriteMessage(messageType int, data []byte) error {
+	// control frames are not part of the conversation
+	if messageType == websocket.TextMessage || messageType == websocket.BinaryMessage {
+		r.record(Send, messageType, data)
+	}
+	return r.Conn.WriteMessage(messageType, data)
+}
+
+// Close closes the connection and the cassette file.
+func (r *Recorder) Close() error {
+	err := r.Conn.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	return err
+}
+
+func (r *Recorder) record(dir string, messageType int, data []byte) {
+	frame := Frame{
+		Offset: time.Since(r.start).Milliseconds(),
+		Dir:    dir,
+		Type:   messageType,
+	}
+	if messageType == websocket.TextMessage && json.Valid(data) {
+		frame.Data = append(json.RawMessage(nil), data...)
+	} else {
+		frame.Binary = append([]byte(nil), data...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	r.enc.Encode(frame)
+}
+
+// Load reads every frame of a cassette.
+func Load(path string) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %v", err)
+	}
+	defer file.Close()
+
+	var frames []Frame
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("cassette %s line %d: %v", path, line, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, scanner.Err()
+}
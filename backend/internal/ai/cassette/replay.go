@@ -0,0 +1,129 @@
+package cassette
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Player serves the received frames of a cassette as if they came from the upstream.
+type Player struct {
+	frames []Frame
+	// sendsBefore[i] is the number of frames the client had sent when frame i was recorded
+	sendsBefore []int
+	// Speed scales the recorded delays between frames; 1 is real time and 0 replays
+	// as fast as the client's sends allow.
+	Speed float64
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	next   int
+	sent   []Frame
+	closed bool
+	start  time.Time
+}
+
+// NewPlayer returns a player for the given frames.
+func NewPlayer(frames []Frame, speed float64) *Player {
+	p := &Player{frames: frames, Speed: speed, start: time.Now()}
+	p.cond = sync.NewCond(&p.mu)
+
+	p.sendsBefore = make([]int, len(frames))
+	sends := 0
+	for i, frame := range frames {
+		p.sendsBefore[i] = sends
+		if frame.Dir == Send {
+			sends++
+		}
+	}
+	return p
+}
+
+// Replay loads the cassette at path into a new player.
+func Replay(path string, speed float64) (*Player, error) {
+	frames, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlayer(frames, speed), nil
+}
+
+// ReadMessage returns the next received frame once the client has sent everything it
+// had sent before that frame was recorded. The end of the cassette reads as a normal close.
+func (p *Player) ReadMessage() (int, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.closed {
+			return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "replay closed"}
+		}
+
+		for p.next < len(p.frames) && p.frames[p.next].Dir != Recv {
+			p.next++
+		}
+		if p.next >= len(p.frames) {
+			p.closed = true
+			continue
+		}
+
+		if len(p.sent) < p.sendsBefore[p.next] {
+			p.cond.Wait()
+			continue
+		}
+
+		frame := p.frames[p.next]
+		p.next++
+		if p.Speed > 0 {
+			due := p.start.Add(time.Duration(float64(frame.Offset)/p.Speed) * time.Millisecond)
+			p.mu.Unlock()
+			time.Sleep(time.Until(due))
+			p.mu.Lock()
+		}
+		return frame.Type, frame.payload(), nil
+	}
+}
+
+// WriteMessage records a frame sent by the client.
+func (p *Player) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return p.Close()
+	}
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return websocket.ErrCloseSent
+	}
+	p.sent = append(p.sent, Frame{
+		Offset: time.Since(p.start).Milliseconds(),
+		Dir:    Send,
+		Type:   messageType,
+		Data:   append([]byte(nil), data...),
+	})
+	p.cond.Broadcast()
+	return nil
+}
+
+func (p *Player) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (p *Player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
+
+// Sent returns the frames the client has sent during the replay.
+func (p *Player) Sent() []Frame {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Frame(nil), p.sent...)
+}
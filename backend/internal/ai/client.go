@@ -2,7 +2,8 @@ package ai
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"interviews-ai/internal/ai/types"
@@ -16,28 +17,56 @@ type Client struct {
 	Conn       *websocket.Conn
 	Send       chan types.Message
 	Hub        *Hub
+	Session    *Session
+	// Logger is set by the session; logger() falls back to the default.
+	Logger *slog.Logger
+
+	// writeMu serializes writes to Conn, which are made from both pumps.
+	writeMu sync.Mutex
+}
+
+func (c *Client) writeMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
 }
 
-// Reads from the socket connection and sends the data to the hub's handleClientRead channel
+// closeConn closes the connection once no write is in flight.
+func (c *Client) closeConn() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Conn.Close()
+}
+
+// Reads from the socket connection and routes the data to the paired AI client
 func (c *Client) ClientReadPump() {
 	defer func() {
-		log.Println("ClientReadPump: closing client connection")
-		c.Hub.UnregisterClient <- c
-		c.Conn.Close()
+		c.logger().Debug("ClientReadPump: closing client connection")
+		c.Session.Close()
 	}()
 
 	for {
 		messageType, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err) {
-				c.Conn.WriteMessage(websocket.CloseGoingAway, []byte{})
+				c.logger().Warn("Client connection closed unexpectedly", "error", err)
+				c.writeMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
 			}
 			break
 		}
 
-		log.Println("Client read messageType: ", messageType)
-
-		c.Hub.HandleClientWrite <- types.Message{SenderID: c.ClientId, Payload: message, ReceiverID: c.AiClientId, Type: types.MessageType(messageType)}
+		msg := types.Message{SenderID: c.ClientId, Payload: message, ReceiverID: c.AiClientId, Type: types.MessageType(messageType)}
+		if !c.Session.toAI(msg) {
+			return
+		}
 	}
 
 }
@@ -45,42 +74,59 @@ func (c *Client) ClientReadPump() {
 func (c *Client) ClientWritePump() {
 	var ticker *time.Ticker = time.NewTicker(pingPeriod)
 	defer func() {
-		log.Println("ClientWritePump: closing connection")
+		c.logger().Debug("ClientWritePump: closing connection")
 		ticker.Stop()
-		c.Conn.Close()
+		c.Session.Close()
 	}()
 
 	for {
 		select {
-		// a message is sent via this specific client's send channel
-		case message, ok := <-c.Send:
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseGoingAway, []byte{})
-				return
-			}
-
-			// if it wasn't a message of type text, don't write it to the user
-			if message.Type != types.TextMessage {
-				log.Printf("\n*******Not sending to client because message type was %v", message.Type)
-				continue
+		case <-c.Session.stop:
+			// deliver what the AI said before the session ended
+			for {
+				select {
+				case message := <-c.Send:
+					if !c.writeEvent(message) {
+						return
+					}
+				default:
+					c.writeMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+					return
+				}
 			}
 
-			// the message can potentially contain binary data
-			var serverEvent ServerEvent
-			if err := json.Unmarshal(message.Payload, &serverEvent); err != nil {
-				log.Println("JSON Unmarshal error:", err)
+		// a message is sent via this specific client's send channel
+		case message := <-c.Send:
+			if !c.writeEvent(message) {
 				return
 			}
 
-			c.Conn.WriteMessage(websocket.TextMessage, message.Payload)
-
 		case <-ticker.C:
 			// periodically ping the client to ensure the client is listening
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.writeMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 
 	}
 }
+
+// writeEvent writes a message from the AI to the browser, reporting false if the
+// pump should stop.
+func (c *Client) writeEvent(message types.Message) bool {
+	// if it wasn't a message of type text, don't write it to the user
+	if message.Type != types.TextMessage {
+		c.logger().Warn("Not sending non-text message to client", "message_type", message.Type)
+		return true
+	}
+
+	// the message can potentially contain binary data
+	var serverEvent ServerEvent
+	if err := json.Unmarshal(message.Payload, &serverEvent); err != nil {
+		c.logger().Error("Failed to decode message for client", "error", err)
+		return false
+	}
+
+	c.writeMessage(websocket.TextMessage, message.Payload)
+	return true
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"interviews-ai/internal/ai/editor"
+	"interviews-ai/internal/ai/types"
+)
+
+// Constants for shared code editor event types.
+const (
+	MsgTypeEditorPatch = "editor.patch"
+	MsgTypeEditorAck   = "editor.ack"
+	MsgTypeEditorError = "editor.error"
+
+	// how often the latest code is shared with the interviewer
+	editorSyncPeriod = 20 * time.Second
+	// code longer than this is truncated when shared with the interviewer
+	maxEditorContextLen = 8000
+)
+
+// EditorAckEvent confirms a patch and carries the operation as the server applied it.
+type EditorAckEvent struct {
+	Type    string           `json:"type"`
+	Version int              `json:"version"`
+	Ops     editor.Operation `json:"ops"`
+}
+
+// EditorErrorEvent reports a rejected patch along with the authoritative state to resync from.
+type EditorErrorEvent struct {
+	Type  string          `json:"type"`
+	Error string          `json:"error"`
+	State editor.Snapshot `json:"state"`
+}
+
+func (c *AIClient) editorDocument() *editor.Document {
+	c.editorOnce.Do(func() {
+		c.editor = editor.NewDocument()
+	})
+	return c.editor
+}
+
+// handleEditorPatch applies a patch from the browser and acknowledges it.
+func handleEditorPatch(c *AIClient, incomingMsg IncomingMessage) {
+	doc := c.editorDocument()
+	if incomingMsg.Language != "" {
+		doc.SetLanguage(incomingMsg.Language)
+	}
+
+	applied, version, err := doc.Apply(incomingMsg.BaseVersion, incomingMsg.Ops)
+	if err != nil {
+		c.logger().Warn("Rejected editor patch", "base_version", incomingMsg.BaseVersion, "error", err)
+		sendToClient(c, EditorErrorEvent{
+			Type:  MsgTypeEditorError,
+			Error: err.Error(),
+			State: doc.Snapshot(),
+		})
+		return
+	}
+
+	sendToClient(c, EditorAckEvent{
+		Type:    MsgTypeEditorAck,
+		Version: version,
+		Ops:     applied,
+	})
+}
+
+// syncEditorContext shares the latest code with the interviewer if it changed since the last sync.
+func syncEditorContext(c *AIClient) {
+	snapshot := c.editorDocument().Snapshot()
+	if snapshot.Version == c.editorSyncedVersion {
+		return
+	}
+
+	code := []rune(snapshot.Text)
+	if len(code) > maxEditorContextLen {
+		code = append(code[:maxEditorContextLen], []rune("\n... [truncated]")...)
+	}
+	text := fmt.Sprintf("The candidate's code editor now contains:\n```%s\n%s\n```\nUse it as context for the conversation; do not read it aloud.",
+		snapshot.Language, string(code))
+
+	if err := c.writeJSON(systemMessageItem(text)); err != nil {
+		c.logger().Error("Failed to share editor contents with AI", "error", err)
+		return
+	}
+	c.editorSyncedVersion = snapshot.Version
+}
+
+// sendToClient routes a server generated event to the paired browser client.
+func sendToClient(c *AIClient, event interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		c.logger().Error("Failed to marshal event for client", "error", err)
+		return
+	}
+	c.Session.toClient(types.Message{
+		SenderID:   c.AiClientId,
+		Payload:    data,
+		ReceiverID: c.ClientId,
+		Type:       types.TextMessage,
+	})
+}
@@ -0,0 +1,88 @@
+package editor
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxDocumentLen caps the size of a shared code buffer, in runes.
+const MaxDocumentLen = 64 * 1024
+
+// Document is the authoritative state of a session's shared code buffer.
+// Patches are made against a version; patches based on an older version are
+// transformed against every operation applied since, so concurrent edits merge.
+type Document struct {
+	mu       sync.RWMutex
+	text     []rune
+	language string
+	history  []Operation
+}
+
+// Snapshot is a consistent copy of the document state.
+type Snapshot struct {
+	Version  int    `json:"version"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+func NewDocument() *Document {
+	return &Document{}
+}
+
+// Apply applies op, made against baseVersion, and returns the operation as it was
+// actually applied together with the new version.
+func (d *Document) Apply(baseVersion int, op Operation) (Operation, int, error) {
+	if err := op.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if baseVersion < 0 || baseVersion > len(d.history) {
+		return nil, 0, fmt.Errorf("%w: unknown base version %d", ErrInvalidOperation, baseVersion)
+	}
+
+	for _, concurrent := range d.history[baseVersion:] {
+		var err error
+		_, op, err = Transform(concurrent, op)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	text, err := op.Apply(d.text)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(text) > MaxDocumentLen {
+		return nil, 0, fmt.Errorf("%w: document would exceed %d characters", ErrInvalidOperation, MaxDocumentLen)
+	}
+
+	d.text = text
+	d.history = append(d.history, op)
+	return op, len(d.history), nil
+}
+
+// SetLanguage records the language the candidate is writing in.
+func (d *Document) SetLanguage(language string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.language = language
+}
+
+func (d *Document) Version() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.history)
+}
+
+func (d *Document) Snapshot() Snapshot {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return Snapshot{
+		Version:  len(d.history),
+		Language: d.language,
+		Text:     string(d.text),
+	}
+}
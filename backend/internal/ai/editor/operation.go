@@ -0,0 +1,228 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Component is one step of an operation: retain, insert or delete. Exactly one field is set.
+// Lengths are counted in runes (Unicode code points).
+type Component struct {
+	Retain int    `json:"retain,omitempty"`
+	Insert string `json:"insert,omitempty"`
+	Delete int    `json:"delete,omitempty"`
+}
+
+// Operation is a sequence of components that walks the whole document from start to end.
+type Operation []Component
+
+var ErrInvalidOperation = errors.New("invalid operation")
+
+func (c Component) isRetain() bool { return c.Retain > 0 }
+func (c Component) isInsert() bool { return c.Insert != "" }
+func (c Component) isDelete() bool { return c.Delete > 0 }
+
+// BaseLen is the length of the document the operation applies to.
+func (op Operation) BaseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLen is the length of the document after applying the operation.
+func (op Operation) TargetLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + len([]rune(c.Insert))
+	}
+	return n
+}
+
+// Validate checks that every component sets exactly one field, and is no longer
+// than a document can be, so lengths cannot overflow when summed.
+func (op Operation) Validate() error {
+	for i, c := range op {
+		set := 0
+		if c.isRetain() {
+			set++
+		}
+		if c.isInsert() {
+			set++
+		}
+		if c.isDelete() {
+			set++
+		}
+		if set != 1 || c.Retain < 0 || c.Delete < 0 {
+			return fmt.Errorf("%w: component %d must set exactly one of retain, insert or delete", ErrInvalidOperation, i)
+		}
+		if c.Retain > MaxDocumentLen || c.Delete > MaxDocumentLen || len(c.Insert) > 4*MaxDocumentLen {
+			return fmt.Errorf("%w: component %d is longer than a document", ErrInvalidOperation, i)
+		}
+	}
+	return nil
+}
+
+// Apply returns the document produced by applying op to doc.
+func (op Operation) Apply(doc []rune) ([]rune, error) {
+	if err := op.Validate(); err != nil {
+		return nil, err
+	}
+	if op.BaseLen() != len(doc) {
+		return nil, fmt.Errorf("%w: base length %d does not match document length %d", ErrInvalidOperation, op.BaseLen(), len(doc))
+	}
+
+	out := make([]rune, 0, op.TargetLen())
+	pos := 0
+	for i, c := range op {
+		if n := c.Retain + c.Delete; n < 0 || n > len(doc)-pos {
+			return nil, fmt.Errorf("%w: component %d goes past the end of the document", ErrInvalidOperation, i)
+		}
+		switch {
+		case c.isRetain():
+			out = append(out, doc[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.isInsert():
+			out = append(out, []rune(c.Insert)...)
+		case c.isDelete():
+			pos += c.Delete
+		}
+	}
+	return out, nil
+}
+
+// builder appends components while merging adjacent components of the same kind.
+type builder struct {
+	op Operation
+}
+
+func (b *builder) retain(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].isRetain() {
+		b.op[last].Retain += n
+		return
+	}
+	b.op = append(b.op, Component{Retain: n})
+}
+
+func (b *builder) insert(s string) {
+	if s == "" {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].isInsert() {
+		b.op[last].Insert += s
+		return
+	}
+	b.op = append(b.op, Component{Insert: s})
+}
+
+func (b *builder) delete(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].isDelete() {
+		b.op[last].Delete += n
+		return
+	}
+	b.op = append(b.op, Component{Delete: n})
+}
+
+// cursor walks the components of an operation, allowing them to be consumed partially.
+type cursor struct {
+	op  Operation
+	i   int
+	cur Component
+	ok  bool
+}
+
+func newCursor(op Operation) *cursor {
+	c := &cursor{op: op}
+	c.next()
+	return c
+}
+
+func (c *cursor) next() {
+	if c.i < len(c.op) {
+		c.cur = c.op[c.i]
+		c.i++
+		c.ok = true
+		return
+	}
+	c.cur = Component{}
+	c.ok = false
+}
+
+// Transform takes two operations a and b that apply to the same document and returns
+// a' and b' such that applying a then b' yields the same document as b then a'.
+// When both insert at the same position, a's insert goes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, fmt.Errorf("%w: concurrent operations have different base lengths", ErrInvalidOperation)
+	}
+
+	var aPrime, bPrime builder
+	ca, cb := newCursor(a), newCursor(b)
+
+	for ca.ok || cb.ok {
+		if ca.ok && ca.cur.isInsert() {
+			aPrime.insert(ca.cur.Insert)
+			bPrime.retain(len([]rune(ca.cur.Insert)))
+			ca.next()
+			continue
+		}
+		if cb.ok && cb.cur.isInsert() {
+			aPrime.retain(len([]rune(cb.cur.Insert)))
+			bPrime.insert(cb.cur.Insert)
+			cb.next()
+			continue
+		}
+		if !ca.ok || !cb.ok {
+			return nil, nil, fmt.Errorf("%w: operations are too short", ErrInvalidOperation)
+		}
+
+		x, y := ca.cur, cb.cur
+		switch {
+		case x.isRetain() && y.isRetain():
+			n := min(x.Retain, y.Retain)
+			aPrime.retain(n)
+			bPrime.retain(n)
+			consume(ca, n)
+			consume(cb, n)
+		case x.isDelete() && y.isDelete():
+			// both deleted the same text
+			n := min(x.Delete, y.Delete)
+			consume(ca, n)
+			consume(cb, n)
+		case x.isDelete() && y.isRetain():
+			n := min(x.Delete, y.Retain)
+			aPrime.delete(n)
+			consume(ca, n)
+			consume(cb, n)
+		case x.isRetain() && y.isDelete():
+			n := min(x.Retain, y.Delete)
+			bPrime.delete(n)
+			consume(ca, n)
+			consume(cb, n)
+		}
+	}
+	return aPrime.op, bPrime.op, nil
+}
+
+// consume advances the cursor by n runes of its current retain or delete component.
+func consume(c *cursor, n int) {
+	switch {
+	case c.cur.isRetain():
+		c.cur.Retain -= n
+		if c.cur.Retain == 0 {
+			c.next()
+		}
+	case c.cur.isDelete():
+		c.cur.Delete -= n
+		if c.cur.Delete == 0 {
+			c.next()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package editor
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		doc  string
+		op   Operation
+		want string
+		err  bool
+	}{
+		{name: "insert into empty", doc: "", op: Operation{{Insert: "fmt"}}, want: "fmt"},
+		{name: "retain insert delete", doc: "hello world", op: Operation{{Retain: 6}, {Delete: 5}, {Insert: "gopher"}}, want: "hello gopher"},
+		{name: "runes", doc: "héllo", op: Operation{{Retain: 1}, {Delete: 1}, {Insert: "e"}, {Retain: 3}}, want: "hello"},
+		{name: "short", doc: "hello", op: Operation{{Retain: 4}}, err: true},
+		{name: "long", doc: "hello", op: Operation{{Retain: 6}}, err: true},
+		{name: "two fields", doc: "a", op: Operation{{Retain: 1, Insert: "b"}}, err: true},
+		{name: "empty component", doc: "a", op: Operation{{Retain: 1}, {}}, err: true},
+		{name: "negative", doc: "a", op: Operation{{Retain: 2}, {Delete: -1}}, err: true},
+		// the lengths wrap around to the document length when summed
+		{name: "overflow", doc: "", op: Operation{{Retain: math.MaxInt}, {Retain: math.MaxInt}, {Retain: 2}}, err: true},
+	} {
+		got, err := test.op.Apply([]rune(test.doc))
+		if test.err {
+			if !errors.Is(err, ErrInvalidOperation) {
+				t.Errorf("%s: Apply = %q, %v, want ErrInvalidOperation", test.name, string(got), err)
+			}
+			continue
+		}
+		if err != nil || string(got) != test.want {
+			t.Errorf("%s: Apply = %q, %v, want %q", test.name, string(got), err, test.want)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		doc  string
+		a, b Operation
+		want string
+	}{
+		{name: "same position", doc: "ac", a: Operation{{Retain: 1}, {Insert: "x"}, {Retain: 1}}, b: Operation{{Retain: 1}, {Insert: "y"}, {Retain: 1}}, want: "axyc"},
+		{name: "apart", doc: "abc", a: Operation{{Insert: "<"}, {Retain: 3}}, b: Operation{{Retain: 3}, {Insert: ">"}}, want: "<abc>"},
+		{name: "same delete", doc: "abc", a: Operation{{Retain: 1}, {Delete: 1}, {Retain: 1}}, b: Operation{{Retain: 1}, {Delete: 1}, {Retain: 1}}, want: "ac"},
+		{name: "overlapping deletes", doc: "abcd", a: Operation{{Delete: 3}, {Retain: 1}}, b: Operation{{Retain: 1}, {Delete: 3}}, want: ""},
+		{name: "insert in deleted text", doc: "abcd", a: Operation{{Retain: 1}, {Delete: 2}, {Retain: 1}}, b: Operation{{Retain: 2}, {Insert: "x"}, {Retain: 2}}, want: "axd"},
+	} {
+		aPrime, bPrime, err := Transform(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: Transform: %v", test.name, err)
+			continue
+		}
+		// a then b' and b then a' converge
+		ab := apply(t, apply(t, []rune(test.doc), test.a), bPrime)
+		ba := apply(t, apply(t, []rune(test.doc), test.b), aPrime)
+		if string(ab) != test.want || string(ba) != test.want {
+			t.Errorf("%s: a then b' = %q, b then a' = %q, want %q", test.name, string(ab), string(ba), test.want)
+		}
+	}
+
+	if _, _, err := Transform(Operation{{Retain: 1}}, Operation{{Retain: 2}}); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Transform of different base lengths: %v", err)
+	}
+}
+
+func apply(t *testing.T, doc []rune, op Operation) []rune {
+	t.Helper()
+	out, err := op.Apply(doc)
+	if err != nil {
+		t.Fatalf("Apply %v to %q: %v", op, string(doc), err)
+	}
+	return out
+}
+
+func TestDocumentApply(t *testing.T) {
+	doc := NewDocument()
+	steps := []struct {
+		name        string
+		baseVersion int
+		op          Operation
+		applied     Operation
+		version     int
+		err         bool
+	}{
+		{name: "first", baseVersion: 0, op: Operation{{Insert: "func main() {}"}}, applied: Operation{{Insert: "func main() {}"}}, version: 1},
+		{name: "current", baseVersion: 1, op: Operation{{Retain: 13}, {Insert: "\n"}, {Retain: 1}}, applied: Operation{{Retain: 13}, {Insert: "\n"}, {Retain: 1}}, version: 2},
+		// made against version 1, so it is moved past the newline inserted since
+		{name: "stale", baseVersion: 1, op: Operation{{Insert: "package main\n"}, {Retain: 14}}, applied: Operation{{Insert: "package main\n"}, {Retain: 15}}, version: 3},
+		{name: "unknown version", baseVersion: 4, op: Operation{{Retain: 28}}, err: true},
+		{name: "wrong length", baseVersion: 3, op: Operation{{Retain: 1}}, err: true},
+		{name: "overflow", baseVersion: 3, op: Operation{{Retain: math.MaxInt}, {Retain: math.MaxInt}, {Retain: 30}}, err: true},
+		{name: "too long", baseVersion: 3, op: Operation{{Retain: 28}, {Insert: string(make([]rune, MaxDocumentLen))}}, err: true},
+	}
+	for _, step := range steps {
+		applied, version, err := doc.Apply(step.baseVersion, step.op)
+		if step.err {
+			if !errors.Is(err, ErrInvalidOperation) {
+				t.Errorf("%s: Apply = %v, %d, %v, want ErrInvalidOperation", step.name, applied, version, err)
+			}
+			continue
+		}
+		if err != nil || version != step.version || !reflect.DeepEqual(applied, step.applied) {
+			t.Errorf("%s: Apply = %v, %d, %v, want %v, %d", step.name, applied, version, err, step.applied, step.version)
+		}
+	}
+	if got := doc.Snapshot(); got.Version != 3 || got.Text != "package main\nfunc main() {\n}" {
+		t.Errorf("Snapshot = %+v", got)
+	}
+}
@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Constants for function calling event types.
+const (
+	MsgTypeFunctionCallArgumentsDelta = "response.function_call_arguments.delta"
+	MsgTypeFunctionCallArgumentsDone  = "response.function_call_arguments.done"
+	MsgTypeResponseOutputItemAdded    = "response.output_item.added"
+	MsgTypeResponseOutputItemDone     = "response.output_item.done"
+	MsgTypeConversationItemCreate     = "conversation.item.create"
+
+	itemTypeFunctionCall       = "function_call"
+	itemTypeFunctionCallOutput = "function_call_output"
+)
+
+// ConversationItemCreateEvent represents the conversation.item.create event structure.
+type ConversationItemCreateEvent struct {
+	Type string                 `json:"type"`
+	Item map[string]interface{} `json:"item"`
+}
+
+// systemMessageItem returns an event adding a system message to the conversation.
+func systemMessageItem(text string) ConversationItemCreateEvent {
+	return ConversationItemCreateEvent{
+		Type: MsgTypeConversationItemCreate,
+		Item: map[string]interface{}{
+			"type": "message",
+			"role": "system",
+			"content": []map[string]interface{}{
+				{"type": "input_text", "text": text},
+			},
+		},
+	}
+}
+
+// functionCalls tracks the tool calls made by the model during a response so that
+// a follow-up response.create is only sent once every call has produced an output.
+// dispatched maps each call to whether its output is posted; a call is forgotten once
+// both that and its response are done, as the later events of a response repeat it.
+type functionCalls struct {
+	mu            sync.Mutex
+	names         map[string]string
+	arguments     map[string]*strings.Builder
+	dispatched    map[string]bool
+	pending       int
+	responseDone  bool
+	outputsPosted bool
+}
+
+func newFunctionCalls() *functionCalls {
+	return &functionCalls{
+		names:      make(map[string]string),
+		arguments:  make(map[string]*strings.Builder),
+		dispatched: make(map[string]bool),
+	}
+}
+
+// handleFunctionCallEvent processes the function calling events of a response.
+func handleFunctionCallEvent(c *AIClient, event ServerEvent) {
+	if c.Tools.Len() == 0 {
+		return
+	}
+	calls := c.functionCalls()
+
+	switch event.Type {
+	case MsgTypeResponseOutputItemAdded:
+		if itemType, _ := event.Item["type"].(string); itemType == itemTypeFunctionCall {
+			callID, _ := event.Item["call_id"].(string)
+			name, _ := event.Item["name"].(string)
+			calls.mu.Lock()
+			calls.names[callID] = name
+			calls.mu.Unlock()
+		}
+	case MsgTypeFunctionCallArgumentsDelta:
+		calls.mu.Lock()
+		args, ok := calls.arguments[event.CallID]
+		if !ok {
+			args = &strings.Builder{}
+			calls.arguments[event.CallID] = args
+		}
+		args.WriteString(event.Delta)
+		calls.mu.Unlock()
+	case MsgTypeFunctionCallArgumentsDone:
+		name := event.Name
+		if name == "" {
+			calls.mu.Lock()
+			name = calls.names[event.CallID]
+			calls.mu.Unlock()
+		}
+		if name != "" {
+			dispatchFunctionCall(c, event.CallID, name, event.Arguments)
+		}
+	case MsgTypeResponseOutputItemDone:
+		if itemType, _ := event.Item["type"].(string); itemType == itemTypeFunctionCall {
+			callID, _ := event.Item["call_id"].(string)
+			name, _ := event.Item["name"].(string)
+			arguments, _ := event.Item["arguments"].(string)
+			dispatchFunctionCall(c, callID, name, arguments)
+		}
+	case "response.created":
+		calls.mu.Lock()
+		calls.responseDone = false
+		calls.mu.Unlock()
+	case MsgTypeResponseDone:
+		calls.mu.Lock()
+		calls.responseDone = true
+		for callID, posted := range calls.dispatched {
+			if posted {
+				delete(calls.dispatched, callID)
+			}
+		}
+		calls.mu.Unlock()
+		continueAfterFunctionCalls(c)
+	}
+}
+
+// dispatchFunctionCall invokes the tool in the background and posts its output back
+// to the conversation. Calls already dispatched for the same call_id are ignored.
+func dispatchFunctionCall(c *AIClient, callID string, name string, arguments string) {
+	calls := c.functionCalls()
+
+	calls.mu.Lock()
+	if _, ok := calls.dispatched[callID]; ok || callID == "" {
+		calls.mu.Unlock()
+		return
+	}
+	if arguments == "" {
+		if args, ok := calls.arguments[callID]; ok {
+			arguments = args.String()
+		}
+	}
+	calls.dispatched[callID] = false
+	delete(calls.arguments, callID)
+	delete(calls.names, callID)
+	calls.pending++
+	calls.mu.Unlock()
+
+	c.logger().Info("Invoking tool", "tool", name, "call_id", callID)
+
+	go func() {
+		// tool calls are abandoned when the session closes
+		output := c.Tools.Invoke(c.Session.Context(), name, json.RawMessage(arguments))
+
+		item := ConversationItemCreateEvent{
+			Type: MsgTypeConversationItemCreate,
+			Item: map[string]interface{}{
+				"type":    itemTypeFunctionCallOutput,
+				"call_id": callID,
+				"output":  output,
+			},
+		}
+		if err := c.writeJSON(item); err != nil {
+			c.logger().Error("Failed to send function_call_output", "call_id", callID, "error", err)
+		}
+
+		calls.mu.Lock()
+		calls.pending--
+		calls.outputsPosted = true
+		if calls.responseDone {
+			delete(calls.dispatched, callID)
+		} else {
+			calls.dispatched[callID] = true
+		}
+		calls.mu.Unlock()
+
+		continueAfterFunctionCalls(c)
+	}()
+}
+
+// continueAfterFunctionCalls asks the model to respond once the current response is
+// done and every dispatched tool call has posted its output.
+func continueAfterFunctionCalls(c *AIClient) {
+	calls := c.functionCalls()
+
+	calls.mu.Lock()
+	ready := calls.responseDone && calls.pending == 0 && calls.outputsPosted
+	if ready {
+		calls.outputsPosted = false
+		calls.responseDone = false
+	}
+	calls.mu.Unlock()
+
+	if !ready {
+		return
+	}
+	// the wrap-up response is already asked for, and upstream takes one at a time
+	if c.budget.wrappingUp.Load() {
+		c.logger().Info("Not continuing after tool calls while wrapping up the session")
+		return
+	}
+
+	responseCreate := ResponseCreateEvent{
+		Type: MsgTypeResponseCreate,
+		Response: map[string]interface{}{
+			"modalities": []string{"audio", "text"},
+		},
+	}
+	if err := c.writeJSON(responseCreate); err != nil {
+		c.logger().Error("Failed to send response.create after tool calls", "error", err)
+	}
+}
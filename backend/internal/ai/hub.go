@@ -1,97 +1,170 @@
 package ai
 
 import (
-	"interviews-ai/internal/ai/types"
-	"log"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"interviews-ai/internal/metrics"
+)
+
+// Hub event kinds reported to Hub.Observer.
+const (
+	HubEventRegister   = "register"
+	HubEventUnregister = "unregister"
+	HubEventEvict      = "evict"
 )
 
+// HubEvent describes a registration change made by the hub.
+type HubEvent struct {
+	Kind       string
+	SessionId  string
+	ClientId   string
+	AiClientId string
+}
+
+// hubShards spreads sessions over independently locked maps so registrations from
+// many connections do not contend on a single lock.
+const hubShards = 64
+
+// Hub keeps track of the live sessions. Messages do not pass through it: each
+// session routes directly between its browser and AI clients, so the hub is only
+// touched when sessions start, end or are looked up.
 type Hub struct {
-	Clients             map[string]*Client
-	AiClients           map[string]*AIClient
-	HandleClientWrite   chan types.Message
-	HandleAIClientWrite chan types.Message
-	RegisterClient      chan *Client
-	UnregisterClient    chan *Client
-	RegisterAIClient    chan *AIClient
-	UnregisterAIClient  chan *AIClient
+	// Observer, if set, is called for every registration change. It may be called
+	// from several goroutines at once.
+	Observer func(event HubEvent)
+
+	shards [hubShards]hubShard
+}
+
+type hubShard struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
 }
 
 func NewHub() *Hub {
-	return &Hub{
-		Clients:             make(map[string]*Client),
-		AiClients:           make(map[string]*AIClient),
-		HandleClientWrite:   make(chan types.Message),
-		HandleAIClientWrite: make(chan types.Message),
-		RegisterClient:      make(chan *Client),
-		UnregisterClient:    make(chan *Client),
-		RegisterAIClient:    make(chan *AIClient),
-		UnregisterAIClient:  make(chan *AIClient),
+	hub := &Hub{}
+	for i := range hub.shards {
+		hub.shards[i].sessions = make(map[string]*Session)
 	}
+	return hub
 }
 
-// this handles communication between the aiClient and the serverClient
-func (hub *Hub) Run() {
-	for {
-		select {
-		case client := <-hub.RegisterClient:
-			hub.Clients[client.ClientId] = client
-		case aiClient := <-hub.RegisterAIClient:
-			hub.AiClients[aiClient.AiClientId] = aiClient
-		case client := <-hub.UnregisterClient:
-			if client != nil {
-				_, ok := hub.Clients[client.ClientId]
-				if ok {
-					delete(hub.Clients, client.ClientId)
-					close(client.Send)
-				}
-				aiClient, ok := hub.AiClients[client.AiClientId]
-				if ok && aiClient != nil {
-					delete(hub.AiClients, aiClient.AiClientId)
-					close(aiClient.Send)
-				}
-			}
-		case aiClient := <-hub.UnregisterAIClient:
-			if aiClient != nil {
-				_, ok := hub.AiClients[aiClient.AiClientId]
-				if ok {
-					delete(hub.AiClients, aiClient.AiClientId)
-					close(aiClient.Send)
-				}
-				client, ok := hub.Clients[aiClient.ClientId]
-				if ok && client != nil {
-					delete(hub.Clients, client.ClientId)
-					close(client.Send)
-				}
-			}
-		case message := <-hub.HandleClientWrite:
-			aiClient, ok := hub.AiClients[message.ReceiverID]
-			if !ok {
-				log.Printf("Warning: Unknown AI receiver: %v", message.ReceiverID)
-				continue
-			}
-			log.Println("Got message from client")
-			select {
-			case aiClient.Send <- message:
-				log.Printf("Message sent from client %s to AI %s", message.SenderID, message.ReceiverID)
-			default:
-				log.Printf("Failed to send message to AI %s, channel full", message.ReceiverID)
-				hub.UnregisterAIClient <- aiClient
-			}
-
-		case message := <-hub.HandleAIClientWrite:
-			client, ok := hub.Clients[message.ReceiverID]
-			if !ok {
-				log.Printf("Warning: Unknown client receiver: %v", message.ReceiverID)
-				continue
-			}
-			select {
-			case client.Send <- message:
-				log.Printf("Message sent from AI %s to client %s", message.SenderID, message.ReceiverID)
-			default:
-				log.Printf("Failed to send message to client %s, channel full", message.ReceiverID)
-				hub.UnregisterClient <- client
-			}
+func (hub *Hub) shard(sessionId string) *hubShard {
+	h := fnv.New32a()
+	h.Write([]byte(sessionId))
+	return &hub.shards[h.Sum32()%hubShards]
+}
+
+// Register adds a session to the hub.
+func (hub *Hub) Register(s *Session) {
+	shard := hub.shard(s.ID)
+	shard.mu.Lock()
+	shard.sessions[s.ID] = s
+	shard.mu.Unlock()
+	metrics.SessionsActive.Inc()
+	hub.observe(HubEventRegister, s)
+}
+
+// Unregister removes a session from the hub. Removing a session that is not
+// registered does nothing.
+func (hub *Hub) Unregister(s *Session) {
+	shard := hub.shard(s.ID)
+	shard.mu.Lock()
+	removed := shard.sessions[s.ID] == s
+	if removed {
+		delete(shard.sessions, s.ID)
+	}
+	shard.mu.Unlock()
+	if removed {
+		metrics.SessionsActive.Dec()
+		hub.observe(HubEventUnregister, s)
+	}
+}
+
+// Session returns the live session with the given id, or nil.
+func (hub *Hub) Session(sessionId string) *Session {
+	shard := hub.shard(sessionId)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.sessions[sessionId]
+}
+
+// Sessions returns a snapshot of every live session, oldest first.
+func (hub *Hub) Sessions() []SessionSnapshot {
+	var sessions []*Session
+	for i := range hub.shards {
+		shard := &hub.shards[i]
+		shard.mu.RLock()
+		for _, s := range shard.sessions {
+			sessions = append(sessions, s)
 		}
+		shard.mu.RUnlock()
+	}
+
+	// take snapshots outside the shard locks so registrations are not held up
+	snapshots := make([]SessionSnapshot, len(sessions))
+	for i, s := range sessions {
+		snapshots[i] = s.Snapshot()
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].StartedAt.Before(snapshots[j].StartedAt)
+	})
+	return snapshots
+}
+
+// Len returns the number of live sessions.
+func (hub *Hub) Len() int {
+	n := 0
+	for i := range hub.shards {
+		shard := &hub.shards[i]
+		shard.mu.RLock()
+		n += len(shard.sessions)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// Ping takes and releases the lock of every shard, failing if that does not finish
+// before ctx is done. A stuck lock would otherwise hang every new session silently.
+func (hub *Hub) Ping(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		for i := range hub.shards {
+			hub.shards[i].mu.Lock()
+			hub.shards[i].mu.Unlock()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("hub registry is unresponsive: %w", ctx.Err())
+	}
+}
+
+// CloseAll closes every registered session.
+func (hub *Hub) CloseAll() {
+	for i := range hub.shards {
+		shard := &hub.shards[i]
+		shard.mu.RLock()
+		sessions := make([]*Session, 0, len(shard.sessions))
+		for _, s := range shard.sessions {
+			sessions = append(sessions, s)
+		}
+		shard.mu.RUnlock()
+		for _, s := range sessions {
+			s.Close()
+		}
+	}
+}
 
+func (hub *Hub) observe(kind string, s *Session) {
+	if hub.Observer != nil {
+		hub.Observer(HubEvent{Kind: kind, SessionId: s.ID, ClientId: s.Client.ClientId, AiClientId: s.AIClient.AiClientId})
 	}
 }
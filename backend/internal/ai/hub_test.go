@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai/types"
+)
+
+// testSession returns an unstarted session whose Send channels nobody reads.
+func testSession(hub *Hub, id string, buffer int) *Session {
+	client := &Client{ClientId: "client-" + id, AiClientId: "ai-" + id, Send: make(chan types.Message, buffer), Hub: hub}
+	aiClient := &AIClient{ClientId: client.ClientId, AiClientId: client.AiClientId, Send: make(chan types.Message, buffer), Hub: hub}
+	return NewSession(context.Background(), hub, client, aiClient)
+}
+
+func TestHubRegisterAndUnregister(t *testing.T) {
+	hub := NewHub()
+	var events []string
+	hub.Observer = func(event HubEvent) { events = append(events, event.Kind+":"+event.ClientId) }
+
+	a := testSession(hub, "a", 1)
+	hub.Register(a)
+	if got := hub.Session(a.ID); got != a {
+		t.Fatalf("Session(%q) = %v, want the registered session", a.ID, got)
+	}
+
+	// a stale session with the same id does not remove the live one
+	stale := testSession(hub, "a", 1)
+	stale.ID = a.ID
+	hub.Unregister(stale)
+	if hub.Len() != 1 {
+		t.Fatalf("Len() = %d after unregistering a stale session, want 1", hub.Len())
+	}
+
+	hub.Unregister(a)
+	hub.Unregister(a)
+	if hub.Len() != 0 || hub.Session(a.ID) != nil {
+		t.Fatal("session is still registered")
+	}
+
+	want := []string{"register:client-a", "unregister:client-a"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestHubConcurrentRegistration(t *testing.T) {
+	hub := NewHub()
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := testSession(hub, fmt.Sprint(i), 1)
+			hub.Register(s)
+			hub.Session(s.ID)
+			if i%2 == 0 {
+				hub.Unregister(s)
+			}
+		}()
+	}
+	wg.Wait()
+	if hub.Len() != 500 {
+		t.Errorf("Len() = %d, want 500", hub.Len())
+	}
+}
+
+func TestHubSessionsSnapshot(t *testing.T) {
+	hub := NewHub()
+	first := testSession(hub, "first", 1)
+	second := testSession(hub, "second", 1)
+	second.StartedAt = first.StartedAt.Add(time.Second)
+	second.UserID = "user-1"
+	hub.Register(second)
+	hub.Register(first)
+
+	second.toAI(types.Message{})
+	second.addTranscript("user", "hello")
+	second.Close()
+
+	snapshots := hub.Sessions()
+	if len(snapshots) != 2 || snapshots[0].ID != first.ID || snapshots[1].ID != second.ID {
+		t.Fatalf("Sessions() = %+v, want first then second", snapshots)
+	}
+	got := snapshots[1]
+	if got.UserID != "user-1" || got.State != SessionDraining || got.Usage.MessagesIn != 1 || len(got.Transcript) != 1 {
+		t.Errorf("snapshot = %+v", got)
+	}
+	if snapshots[0].State != SessionConnecting {
+		t.Errorf("unstarted session state = %s, want %s", snapshots[0].State, SessionConnecting)
+	}
+
+	// snapshots do not share the transcript with the live session
+	got.Transcript[0].Text = "changed"
+	if second.Snapshot().Transcript[0].Text != "hello" {
+		t.Error("snapshot transcript aliases the session's")
+	}
+}
+
+func BenchmarkHubRegister(b *testing.B) {
+	hub := NewHub()
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s := testSession(hub, fmt.Sprint(next.Add(1)), 0)
+			hub.Register(s)
+			hub.Unregister(s)
+		}
+	})
+}
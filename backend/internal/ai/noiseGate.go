@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"encoding/base64"
+	"time"
+
+	"interviews-ai/internal/ai/vad"
+	"interviews-ai/internal/metrics"
+)
+
+const (
+	// defaultSilenceDurationMs is the upstream's silence_duration_ms when none is set.
+	defaultSilenceDurationMs = 500
+	// gateHangoverMargin is added to silence_duration_ms, so the noise gate never
+	// cuts off the silence that ends a turn.
+	gateHangoverMargin = 300 * time.Millisecond
+)
+
+// noiseGate returns the session's noise gate, or nil when it is off. It is only
+// used by the write pump.
+func (c *AIClient) noiseGate() *vad.Gate {
+	c.gateOnce.Do(func() {
+		if c.Config == nil || c.Config.NoiseGate == nil {
+			return
+		}
+		c.gate = vad.NewGate(*c.Config.NoiseGate)
+		c.updateGateHangover()
+	})
+	return c.gate
+}
+
+// updateGateHangover makes the gate's hangover outlast the session's silence_duration_ms.
+func (c *AIClient) updateGateHangover() {
+	if c.gate == nil {
+		return
+	}
+	hangover := c.Config.NoiseGate.Hangover
+	if hangover <= 0 {
+		hangover = vad.DefaultHangover
+	}
+	silenceMs := defaultSilenceDurationMs
+	if ms := c.sessionSettings().TurnDetection.SilenceDurationMs; ms != nil && *ms > 0 {
+		silenceMs = *ms
+	}
+	c.gate.SetHangover(max(hangover, time.Duration(silenceMs)*time.Millisecond+gateHangoverMargin))
+}
+
+// gateAudio returns the base64 audio to send upstream in place of audio from the
+// browser: all of it without a noise gate, nothing while silent, and the held back
+// pre-roll along with it once speech starts.
+func gateAudio(c *AIClient, audio string) []string {
+	gate := c.noiseGate()
+	if gate == nil {
+		return []string{audio}
+	}
+	pcm, err := base64.StdEncoding.DecodeString(audio)
+	if err != nil {
+		// the upstream reports invalid audio to the browser
+		return []string{audio}
+	}
+
+	suppressed := gate.Stats().SuppressedMs
+	chunks := gate.Process(pcm)
+	if stats := gate.Stats(); stats.SuppressedMs > suppressed {
+		metrics.SuppressedAudioSeconds.Add(float64(stats.SuppressedMs-suppressed) / 1000)
+		c.Session.count(func(usage *SessionUsage) {
+			usage.SuppressedAudioMs = stats.SuppressedMs
+		})
+	}
+
+	if len(chunks) == 1 {
+		return []string{audio}
+	}
+	encoded := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		encoded[i] = base64.StdEncoding.EncodeToString(chunk)
+	}
+	return encoded
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import "context"
+
+// Audio exchanged with the backends is 16-bit little-endian mono PCM at SampleRate,
+// the pcm16 format of the Realtime API.
+const SampleRate = 24000
+
+// SpeechToText transcribes a user turn.
+type SpeechToText interface {
+	Transcribe(ctx context.Context, pcm []byte) (string, error)
+}
+
+// ChatMessage is one message of the conversation sent to the chat model.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest is a single chat completion request.
+type ChatRequest struct {
+	Messages    []ChatMessage
+	Temperature float64
+}
+
+// ChatModel streams a chat completion, calling onDelta for each chunk of text.
+type ChatModel interface {
+	StreamChat(ctx context.Context, req ChatRequest, onDelta func(delta string) error) error
+}
+
+// TextToSpeech synthesizes a piece of text into PCM audio.
+type TextToSpeech interface {
+	Synthesize(ctx context.Context, text string, voice string) ([]byte, error)
+}
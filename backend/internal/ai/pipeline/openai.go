@@ -0,0 +1,209 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// The backends below speak the OpenAI HTTP API, which is also served by many
+// self-hosted model servers, so each stage can point at a different base URL.
+
+// OpenAIEndpoint is an OpenAI compatible API base URL such as https://api.openai.com/v1.
+type OpenAIEndpoint struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+func (e OpenAIEndpoint) client() *http.Client {
+	if e.Client != nil {
+		return e.Client
+	}
+	return http.DefaultClient
+}
+
+func (e OpenAIEndpoint) post(ctx context.Context, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(e.BaseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	resp, err := e.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// OpenAITranscriber implements SpeechToText with the /audio/transcriptions endpoint.
+type OpenAITranscriber struct {
+	OpenAIEndpoint
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, pcm []byte) (string, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("model", t.Model)
+	file, err := form.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if err := writeWAV(file, pcm); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := t.post(ctx, "/audio/transcriptions", form.FormDataContentType(), body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode transcription: %v", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// OpenAIChat implements ChatModel with the streaming /chat/completions endpoint.
+type OpenAIChat struct {
+	OpenAIEndpoint
+}
+
+func (c *OpenAIChat) StreamChat(ctx context.Context, req ChatRequest, onDelta func(delta string) error) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"model":       c.Model,
+		"messages":    req.Messages,
+		"temperature": req.Temperature,
+		"stream":      true,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.post(ctx, "/chat/completions", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the stream is a series of server-sent events terminated by "data: [DONE]"
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode chat chunk: %v", err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// OpenAISpeech implements TextToSpeech with the /audio/speech endpoint.
+type OpenAISpeech struct {
+	OpenAIEndpoint
+}
+
+func (s *OpenAISpeech) Synthesize(ctx context.Context, text string, voice string) ([]byte, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"model":           s.Model,
+		"input":           text,
+		"voice":           voice,
+		"response_format": "pcm",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.post(ctx, "/audio/speech", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// writeWAV wraps PCM samples in a WAV container, which transcription endpoints expect.
+func writeWAV(w io.Writer, pcm []byte) error {
+	const channels, bitsPerSample = 1, 16
+	header := struct {
+		ChunkID       [4]byte
+		ChunkSize     uint32
+		Format        [4]byte
+		Subchunk1ID   [4]byte
+		Subchunk1Size uint32
+		AudioFormat   uint16
+		NumChannels   uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Subchunk2ID   [4]byte
+		Subchunk2Size uint32
+	}{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(36 + len(pcm)),
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1,
+		NumChannels:   channels,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate * channels * bitsPerSample / 8,
+		BlockAlign:    channels * bitsPerSample / 8,
+		BitsPerSample: bitsPerSample,
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: uint32(len(pcm)),
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	_, err := w.Write(pcm)
+	return err
+}
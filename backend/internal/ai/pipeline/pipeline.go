@@ -0,0 +1,603 @@
+// Package pipeline emulates the Realtime API event stream in-process on top of
+// separate speech-to-text, chat completion and text-to-speech backends.
+//
+// Conn implements the same ReadMessage/WriteMessage surface as the upstream
+// websocket, so the AIClient pumps and the browser are unaware that a cascaded
+// pipeline is answering instead of a speech-to-speech model. Function calling is
+// not supported in this mode; tools advertised in session.update are ignored.
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// size of the response.audio.delta chunks sent to the browser
+	audioChunkMs = 100
+	// completed turns waiting to be transcribed or answered
+	workQueueSize = 16
+	// server events not yet read; a reader this far behind is stuck, and the
+	// session is closed rather than buffering without end
+	maxPendingEvents = 4096
+	// input audio kept before a commit; older audio is dropped, as a client that
+	// streams this long without a turn ending is only sending silence
+	maxBufferMs = 5 * 60 * 1000
+)
+
+// Config selects the backends of the pipeline.
+type Config struct {
+	STT  SpeechToText
+	Chat ChatModel
+	TTS  TextToSpeech
+}
+
+type sessionState struct {
+	Modalities        []string `json:"modalities"`
+	Instructions      string   `json:"instructions"`
+	Voice             string   `json:"voice"`
+	Temperature       float64  `json:"temperature"`
+	InputAudioFormat  string   `json:"input_audio_format"`
+	OutputAudioFormat string   `json:"output_audio_format"`
+	TurnDetection     *vadMode `json:"turn_detection"`
+}
+
+type vadMode struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold,omitempty"`
+	PrefixPaddingMs   *int    `json:"prefix_padding_ms,omitempty"`
+	SilenceDurationMs int     `json:"silence_duration_ms,omitempty"`
+}
+
+// clientEvent holds the fields of the client events the pipeline understands.
+type clientEvent struct {
+	Type     string                     `json:"type"`
+	Audio    string                     `json:"audio,omitempty"`
+	Session  map[string]json.RawMessage `json:"session,omitempty"`
+	Item     *conversationItem          `json:"item,omitempty"`
+	Response *struct {
+		Modalities   []string `json:"modalities,omitempty"`
+		Instructions string   `json:"instructions,omitempty"`
+	} `json:"response,omitempty"`
+}
+
+type conversationItem struct {
+	Type    string `json:"type"`
+	Role    string `json:"role,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text,omitempty"`
+	} `json:"content,omitempty"`
+}
+
+// Conn is an in-process Realtime connection backed by a cascaded pipeline.
+type Conn struct {
+	cfg    Config
+	ctx    context.Context
+	cancel context.CancelFunc
+	work   chan func()
+
+	// emit queues events here rather than blocking: WriteMessage is called with
+	// the client's write lock held, which its read pump also needs
+	eventsMu sync.Mutex
+	events   [][]byte
+	ready    chan struct{}
+
+	mu             sync.Mutex
+	session        sessionState
+	history        []ChatMessage
+	buffer         []byte
+	received       int
+	speechStartMs  int
+	detector       *turnDetector
+	responseCancel context.CancelFunc
+}
+
+// New starts a pipeline session and queues the session.created event.
+func New(cfg Config) (*Conn, error) {
+	if cfg.STT == nil || cfg.Chat == nil || cfg.TTS == nil {
+		return nil, errors.New("pipeline requires speech-to-text, chat and text-to-speech backends")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Conn{
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+		ready:  make(chan struct{}, 1),
+		work:   make(chan func(), workQueueSize),
+		session: sessionState{
+			Modalities:        []string{"audio", "text"},
+			Voice:             "alloy",
+			Temperature:       0.8,
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+			TurnDetection:     &vadMode{Type: "server_vad"},
+		},
+	}
+	c.detector = newTurnDetector(defaultVADThreshold, defaultSilenceDurationMs)
+
+	go c.worker()
+	c.emit(map[string]interface{}{"type": "session.created", "session": c.session})
+	return c, nil
+}
+
+// ReadMessage returns the next server event.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	for {
+		c.eventsMu.Lock()
+		if len(c.events) > 0 {
+			event := c.events[0]
+			c.events[0] = nil
+			c.events = c.events[1:]
+			c.eventsMu.Unlock()
+			return websocket.TextMessage, event, nil
+		}
+		c.eventsMu.Unlock()
+
+		select {
+		case <-c.ready:
+		case <-c.ctx.Done():
+			return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "pipeline closed"}
+		}
+	}
+}
+
+// WriteMessage handles a client event.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if c.ctx.Err() != nil {
+		return websocket.ErrCloseSent
+	}
+	switch messageType {
+	case websocket.CloseMessage:
+		return c.Close()
+	case websocket.TextMessage:
+	default:
+		return nil
+	}
+
+	var event clientEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		c.emitError("invalid_request_error", fmt.Sprintf("invalid event: %v", err))
+		return nil
+	}
+
+	switch event.Type {
+	case "session.update":
+		c.updateSession(event.Session)
+	case "input_audio_buffer.append":
+		c.appendAudio(event.Audio)
+	case "input_audio_buffer.commit":
+		c.mu.Lock()
+		empty := len(c.buffer) == 0
+		c.mu.Unlock()
+		if empty {
+			c.emitError("invalid_request_error", "input audio buffer is empty")
+			return nil
+		}
+		c.commit(false, 0)
+	case "input_audio_buffer.clear":
+		c.mu.Lock()
+		c.buffer = nil
+		c.detector.reset()
+		c.mu.Unlock()
+		c.emit(map[string]interface{}{"type": "input_audio_buffer.cleared"})
+	case "conversation.item.create":
+		c.createItem(event.Item)
+	case "response.create":
+		var instructions string
+		modalities := c.sessionModalities()
+		if event.Response != nil {
+			instructions = event.Response.Instructions
+			if len(event.Response.Modalities) > 0 {
+				modalities = event.Response.Modalities
+			}
+		}
+		c.enqueue(func() { c.respond(instructions, modalities) })
+	case "response.cancel":
+		c.cancelResponse()
+	default:
+		slog.Debug("pipeline: ignoring unsupported client event", "type", event.Type)
+	}
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *Conn) Close() error {
+	c.cancel()
+	return nil
+}
+
+func (c *Conn) updateSession(fields map[string]json.RawMessage) {
+	c.mu.Lock()
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "modalities":
+			err = json.Unmarshal(value, &c.session.Modalities)
+		case "instructions":
+			err = json.Unmarshal(value, &c.session.Instructions)
+		case "voice":
+			err = json.Unmarshal(value, &c.session.Voice)
+		case "temperature":
+			err = json.Unmarshal(value, &c.session.Temperature)
+		case "turn_detection":
+			var mode *vadMode
+			if err = json.Unmarshal(value, &mode); err == nil {
+				c.session.TurnDetection = mode
+				if mode != nil {
+					c.detector = newTurnDetector(mode.Threshold, mode.SilenceDurationMs)
+				}
+			}
+		}
+		if err != nil {
+			slog.Warn("pipeline: invalid session field", "field", key, "error", err)
+		}
+	}
+	session := c.session
+	c.mu.Unlock()
+
+	c.emit(map[string]interface{}{"type": "session.updated", "session": session})
+}
+
+func (c *Conn) appendAudio(audio string) {
+	pcm, err := base64.StdEncoding.DecodeString(audio)
+	if err != nil {
+		c.emitError("invalid_request_error", "audio is not valid base64")
+		return
+	}
+
+	c.mu.Lock()
+	c.buffer = append(c.buffer, pcm...)
+	c.received += len(pcm)
+	var turns []turnEvent
+	keep := msToBytes(maxBufferMs)
+	if c.session.TurnDetection != nil {
+		turns = c.detector.process(pcm)
+		if !c.detector.speaking && len(turns) == 0 {
+			// outside speech only the prefix padding of the next turn is needed,
+			// plus the audio the detector has not framed yet
+			keep = msToBytes(c.prefixPaddingMs() + frameMs)
+		}
+	}
+	if len(c.buffer) > keep {
+		c.buffer = append(c.buffer[:0], c.buffer[len(c.buffer)-keep:]...)
+	}
+	c.mu.Unlock()
+
+	for _, turn := range turns {
+		if turn.started {
+			c.mu.Lock()
+			c.speechStartMs = turn.audioMs
+			c.mu.Unlock()
+			// the user talking over the assistant interrupts it
+			c.cancelResponse()
+			c.emit(map[string]interface{}{"type": "input_audio_buffer.speech_started", "audio_start_ms": turn.audioMs})
+			continue
+		}
+		c.emit(map[string]interface{}{"type": "input_audio_buffer.speech_stopped", "audio_end_ms": turn.audioMs})
+		c.commit(true, turn.audioMs)
+	}
+}
+
+// commit turns the input audio buffer into a user message and transcribes it.
+// Turns detected by the server pass the speech end offset; the audio is trimmed to
+// the speech plus prefix padding, and the turn is answered once transcribed.
+func (c *Conn) commit(autoRespond bool, speechEndMs int) {
+	c.mu.Lock()
+	audio := c.buffer
+	c.buffer = nil
+	if autoRespond {
+		// offset of the first buffered byte in the input audio stream
+		start := c.received - len(audio)
+		// keep audio received after the end of speech for the next turn
+		if end := msToBytes(speechEndMs) - start; end > 0 && end < len(audio) {
+			c.buffer = append([]byte(nil), audio[end:]...)
+			audio = audio[:end]
+		}
+		// drop the silence before the speech, keeping the configured prefix padding
+		if skip := msToBytes(c.speechStartMs-c.prefixPaddingMs()) - start; skip > 0 && skip < len(audio) {
+			audio = audio[skip:]
+		}
+	}
+	modalities := c.session.Modalities
+	c.mu.Unlock()
+
+	itemID := newID("item")
+	c.emit(map[string]interface{}{"type": "input_audio_buffer.committed", "item_id": itemID})
+	c.emit(map[string]interface{}{
+		"type": "conversation.item.created",
+		"item": map[string]interface{}{
+			"id":   itemID,
+			"type": "message",
+			"role": "user",
+			"content": []map[string]interface{}{
+				{"type": "input_audio", "transcript": nil},
+			},
+		},
+	})
+
+	c.enqueue(func() {
+		transcript, err := c.cfg.STT.Transcribe(c.ctx, audio)
+		if err != nil {
+			c.emit(map[string]interface{}{
+				"type":          "conversation.item.input_audio_transcription.failed",
+				"item_id":       itemID,
+				"content_index": 0,
+				"error":         map[string]interface{}{"type": "transcription_error", "message": err.Error()},
+			})
+			return
+		}
+		c.emit(map[string]interface{}{
+			"type":          "conversation.item.input_audio_transcription.completed",
+			"item_id":       itemID,
+			"content_index": 0,
+			"transcript":    transcript,
+		})
+		if transcript == "" {
+			return
+		}
+
+		c.mu.Lock()
+		c.history = append(c.history, ChatMessage{Role: "user", Content: transcript})
+		c.mu.Unlock()
+
+		if autoRespond {
+			c.respond("", modalities)
+		}
+	})
+}
+
+func (c *Conn) createItem(item *conversationItem) {
+	if item == nil {
+		c.emitError("invalid_request_error", "missing item")
+		return
+	}
+
+	message := ChatMessage{Role: item.Role}
+	switch item.Type {
+	case "message":
+		var texts []string
+		for _, content := range item.Content {
+			if content.Text != "" {
+				texts = append(texts, content.Text)
+			}
+		}
+		message.Content = strings.Join(texts, "\n")
+	case "function_call_output":
+		message.Role = "system"
+		message.Content = "Tool output: " + item.Output
+	default:
+		c.emitError("invalid_request_error", fmt.Sprintf("unsupported item type %q", item.Type))
+		return
+	}
+	if message.Role == "" {
+		message.Role = "user"
+	}
+
+	c.mu.Lock()
+	c.history = append(c.history, message)
+	c.mu.Unlock()
+
+	c.emit(map[string]interface{}{
+		"type": "conversation.item.created",
+		"item": map[string]interface{}{"id": newID("item"), "type": item.Type, "role": message.Role},
+	})
+}
+
+// respond generates an assistant response from the conversation so far,
+// emitting the same event sequence as a Realtime response.
+func (c *Conn) respond(instructions string, modalities []string) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.mu.Lock()
+	c.responseCancel = cancel
+	var messages []ChatMessage
+	if c.session.Instructions != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: c.session.Instructions})
+	}
+	messages = append(messages, c.history...)
+	if instructions != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: instructions})
+	}
+	voice := c.session.Voice
+	temperature := c.session.Temperature
+	c.mu.Unlock()
+	defer cancel()
+
+	withAudio := false
+	for _, modality := range modalities {
+		if modality == "audio" {
+			withAudio = true
+		}
+	}
+
+	responseID := newID("resp")
+	itemID := newID("item")
+	part := "text"
+	if withAudio {
+		part = "audio"
+	}
+	ids := map[string]interface{}{"response_id": responseID, "item_id": itemID, "output_index": 0, "content_index": 0}
+	withIDs := func(event map[string]interface{}) map[string]interface{} {
+		for key, value := range ids {
+			event[key] = value
+		}
+		return event
+	}
+
+	c.emit(map[string]interface{}{
+		"type":     "response.created",
+		"response": map[string]interface{}{"id": responseID, "object": "realtime.response", "status": "in_progress", "output": []interface{}{}},
+	})
+	item := map[string]interface{}{"id": itemID, "type": "message", "role": "assistant", "status": "in_progress", "content": []interface{}{}}
+	c.emit(map[string]interface{}{"type": "response.output_item.added", "response_id": responseID, "output_index": 0, "item": item})
+	c.emit(map[string]interface{}{"type": "conversation.item.created", "item": item})
+	c.emit(withIDs(map[string]interface{}{"type": "response.content_part.added", "part": map[string]interface{}{"type": part}}))
+
+	var transcript strings.Builder
+	var sentence strings.Builder
+	flush := func() error {
+		text := sentence.String()
+		sentence.Reset()
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		if !withAudio {
+			c.emit(withIDs(map[string]interface{}{"type": "response.text.delta", "delta": text}))
+			return nil
+		}
+		c.emit(withIDs(map[string]interface{}{"type": "response.audio_transcript.delta", "delta": text}))
+		pcm, err := c.cfg.TTS.Synthesize(ctx, strings.TrimSpace(text), voice)
+		if err != nil {
+			return fmt.Errorf("text-to-speech: %v", err)
+		}
+		chunk := msToBytes(audioChunkMs)
+		for start := 0; start < len(pcm); start += chunk {
+			end := min(start+chunk, len(pcm))
+			c.emit(withIDs(map[string]interface{}{"type": "response.audio.delta", "delta": base64.StdEncoding.EncodeToString(pcm[start:end])}))
+		}
+		return nil
+	}
+
+	// speak sentence by sentence so audio starts before the completion finishes
+	err := c.cfg.Chat.StreamChat(ctx, ChatRequest{Messages: messages, Temperature: temperature}, func(delta string) error {
+		transcript.WriteString(delta)
+		sentence.WriteString(delta)
+		if strings.ContainsAny(delta, ".!?\n") {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	status := "completed"
+	switch {
+	case ctx.Err() != nil:
+		status = "cancelled"
+	case err != nil:
+		status = "failed"
+		c.emitError("server_error", err.Error())
+	}
+
+	text := transcript.String()
+	if text != "" {
+		c.mu.Lock()
+		c.history = append(c.history, ChatMessage{Role: "assistant", Content: text})
+		c.mu.Unlock()
+	}
+
+	content := map[string]interface{}{"type": part}
+	if withAudio {
+		content["transcript"] = text
+		c.emit(withIDs(map[string]interface{}{"type": "response.audio.done"}))
+		c.emit(withIDs(map[string]interface{}{"type": "response.audio_transcript.done", "transcript": text}))
+	} else {
+		content["text"] = text
+		c.emit(withIDs(map[string]interface{}{"type": "response.text.done", "text": text}))
+	}
+	c.emit(withIDs(map[string]interface{}{"type": "response.content_part.done", "part": content}))
+
+	item = map[string]interface{}{"id": itemID, "type": "message", "role": "assistant", "status": status, "content": []interface{}{content}}
+	c.emit(map[string]interface{}{"type": "response.output_item.done", "response_id": responseID, "output_index": 0, "item": item})
+	c.emit(map[string]interface{}{
+		"type":     "response.done",
+		"response": map[string]interface{}{"id": responseID, "object": "realtime.response", "status": status, "output": []interface{}{item}},
+	})
+}
+
+func (c *Conn) cancelResponse() {
+	c.mu.Lock()
+	cancel := c.responseCancel
+	c.responseCancel = nil
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// prefixPaddingMs is the audio kept before the start of speech. c.mu must be held.
+func (c *Conn) prefixPaddingMs() int {
+	if c.session.TurnDetection != nil && c.session.TurnDetection.PrefixPaddingMs != nil {
+		return *c.session.TurnDetection.PrefixPaddingMs
+	}
+	return defaultPrefixPaddingMs
+}
+
+func (c *Conn) sessionModalities() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session.Modalities
+}
+
+// enqueue schedules turn work; it runs in order on the worker goroutine.
+func (c *Conn) enqueue(fn func()) {
+	select {
+	case c.work <- fn:
+	case <-c.ctx.Done():
+	}
+}
+
+func (c *Conn) worker() {
+	for {
+		select {
+		case fn := <-c.work:
+			fn()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Conn) emit(event map[string]interface{}) {
+	event["event_id"] = newID("event")
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("pipeline: failed to marshal event", "type", event["type"], "error", err)
+		return
+	}
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	c.eventsMu.Lock()
+	if len(c.events) >= maxPendingEvents {
+		c.eventsMu.Unlock()
+		slog.Error("pipeline: server events are not being read, closing the session", "pending", maxPendingEvents)
+		c.Close()
+		return
+	}
+	c.events = append(c.events, data)
+	c.eventsMu.Unlock()
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Conn) emitError(errType string, message string) {
+	c.emit(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": errType, "message": message},
+	})
+}
+
+func newID(prefix string) string {
+	return prefix + "_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:20]
+}
@@ -0,0 +1,248 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSTT struct {
+	mu    sync.Mutex
+	audio []int
+}
+
+func (f *fakeSTT) Transcribe(ctx context.Context, pcm []byte) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.audio = append(f.audio, len(pcm))
+	return "hello", nil
+}
+
+type fakeChat struct {
+	mu       sync.Mutex
+	deltas   []string
+	requests []ChatRequest
+}
+
+func (f *fakeChat) StreamChat(ctx context.Context, req ChatRequest, onDelta func(delta string) error) error {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	for _, delta := range f.deltas {
+		if err := onDelta(delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fakeTTS speaks every sentence for 250ms.
+type fakeTTS struct{}
+
+func (fakeTTS) Synthesize(ctx context.Context, text string, voice string) ([]byte, error) {
+	return make([]byte, msToBytes(250)), nil
+}
+
+func newTestConn(t *testing.T, chat *fakeChat, stt *fakeSTT) *Conn {
+	t.Helper()
+	c, err := New(Config{STT: stt, Chat: chat, TTS: fakeTTS{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func send(t *testing.T, c *Conn, event map[string]interface{}) {
+	t.Helper()
+	data, _ := json.Marshal(event)
+	if err := c.WriteMessage(1, data); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+}
+
+// readUntil returns the events up to and including the first of type last.
+func readUntil(t *testing.T, c *Conn, last string) []map[string]interface{} {
+	t.Helper()
+	timer := time.AfterFunc(5*time.Second, func() { c.Close() })
+	defer timer.Stop()
+	var events []map[string]interface{}
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("no %s event: %v", last, err)
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+		if event["type"] == last {
+			return events
+		}
+	}
+}
+
+func count(events []map[string]interface{}, eventType string) int {
+	n := 0
+	for _, event := range events {
+		if event["type"] == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// audio returns ms milliseconds of a tone, or of silence if amplitude is 0.
+func audio(ms int, amplitude float64) string {
+	pcm := make([]byte, msToBytes(ms))
+	for i := 0; i < len(pcm)/2; i++ {
+		v := amplitude * math.Sin(2*math.Pi*200*float64(i)/SampleRate)
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(v*math.MaxInt16)))
+	}
+	return base64.StdEncoding.EncodeToString(pcm)
+}
+
+func TestTextResponse(t *testing.T) {
+	chat := &fakeChat{deltas: []string{"Hello", ". How", " are you?"}}
+	c := newTestConn(t, chat, &fakeSTT{})
+	readUntil(t, c, "session.created")
+
+	send(t, c, map[string]interface{}{"type": "session.update", "session": map[string]interface{}{"instructions": "Be brief.", "modalities": []string{"text"}}})
+	send(t, c, map[string]interface{}{"type": "conversation.item.create", "item": map[string]interface{}{
+		"type": "message", "role": "user", "content": []map[string]interface{}{{"type": "input_text", "text": "hi"}},
+	}})
+	send(t, c, map[string]interface{}{"type": "response.create"})
+	events := readUntil(t, c, "response.done")
+
+	if n := count(events, "response.text.delta"); n != 2 {
+		t.Errorf("%d text deltas, want one per sentence", n)
+	}
+	if count(events, "response.audio.delta") != 0 {
+		t.Error("a text response has audio")
+	}
+	for _, event := range events {
+		if event["type"] == "response.text.done" && event["text"] != "Hello. How are you?" {
+			t.Errorf("text = %q", event["text"])
+		}
+	}
+	if status := events[len(events)-1]["response"].(map[string]interface{})["status"]; status != "completed" {
+		t.Errorf("status = %v", status)
+	}
+	want := []ChatMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}
+	if !reflect.DeepEqual(chat.requests[0].Messages, want) {
+		t.Errorf("chat messages = %+v, want %+v", chat.requests[0].Messages, want)
+	}
+}
+
+func TestVoiceTurn(t *testing.T) {
+	chat := &fakeChat{deltas: []string{"Hi there."}}
+	stt := &fakeSTT{}
+	c := newTestConn(t, chat, stt)
+	readUntil(t, c, "session.created")
+
+	// a second of silence, half a second of speech and the silence that ends the turn
+	for i := 0; i < 10; i++ {
+		send(t, c, map[string]interface{}{"type": "input_audio_buffer.append", "audio": audio(100, 0)})
+	}
+	c.mu.Lock()
+	buffered := len(c.buffer)
+	c.mu.Unlock()
+	if buffered > msToBytes(defaultPrefixPaddingMs+frameMs) {
+		t.Errorf("%dms of silence buffered, want only the prefix padding", bytesToMs(buffered))
+	}
+	for i := 0; i < 5; i++ {
+		send(t, c, map[string]interface{}{"type": "input_audio_buffer.append", "audio": audio(100, 0.3)})
+	}
+	for i := 0; i < 7; i++ {
+		send(t, c, map[string]interface{}{"type": "input_audio_buffer.append", "audio": audio(100, 0)})
+	}
+
+	events := readUntil(t, c, "response.done")
+	var types []string
+	for _, event := range events {
+		switch event["type"] {
+		case "input_audio_buffer.speech_started", "input_audio_buffer.speech_stopped", "input_audio_buffer.committed",
+			"conversation.item.input_audio_transcription.completed", "response.created":
+			types = append(types, event["type"].(string))
+		}
+	}
+	want := []string{"input_audio_buffer.speech_started", "input_audio_buffer.speech_stopped", "input_audio_buffer.committed",
+		"conversation.item.input_audio_transcription.completed", "response.created"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	// 250ms of speech in 100ms chunks
+	if n := count(events, "response.audio.delta"); n != 3 {
+		t.Errorf("%d audio deltas, want 3", n)
+	}
+
+	// the speech, its prefix padding and the silence that ended it
+	if ms := bytesToMs(stt.audio[0]); ms < 500 || ms > 1400 {
+		t.Errorf("transcribed %dms of audio", ms)
+	}
+	if got := chat.requests[0].Messages; len(got) != 1 || got[0] != (ChatMessage{Role: "user", Content: "hello"}) {
+		t.Errorf("chat messages = %+v", got)
+	}
+}
+
+func TestBufferCap(t *testing.T) {
+	stt := &fakeSTT{}
+	c := newTestConn(t, &fakeChat{}, stt)
+	send(t, c, map[string]interface{}{"type": "session.update", "session": map[string]interface{}{"turn_detection": nil}})
+
+	chunk := audio(10_000, 0.3)
+	for ms := 0; ms <= maxBufferMs; ms += 10_000 {
+		send(t, c, map[string]interface{}{"type": "input_audio_buffer.append", "audio": chunk})
+	}
+	send(t, c, map[string]interface{}{"type": "input_audio_buffer.commit"})
+	readUntil(t, c, "conversation.item.input_audio_transcription.completed")
+	if got := stt.audio[0]; got != msToBytes(maxBufferMs) {
+		t.Errorf("committed %dms of audio, want the last %dms", bytesToMs(got), maxBufferMs)
+	}
+}
+
+// The AIClient writes with a lock its read pump needs, so writing must not wait
+// for the events to be read.
+func TestWriteDoesNotWaitForReads(t *testing.T) {
+	c := newTestConn(t, &fakeChat{}, &fakeSTT{})
+	update, _ := json.Marshal(map[string]interface{}{"type": "session.update", "session": map[string]interface{}{"voice": "echo"}})
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < maxPendingEvents/2; i++ {
+			if err := c.WriteMessage(1, update); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WriteMessage blocked while no one read the events")
+	}
+
+	events := readUntil(t, c, "session.updated")
+	if len(events) != 2 || events[1]["session"].(map[string]interface{})["voice"] != "echo" {
+		t.Errorf("events = %v", events)
+	}
+
+	// a reader that never catches up gets the session closed
+	for i := 0; i < maxPendingEvents; i++ {
+		c.WriteMessage(1, update)
+	}
+	if err := c.WriteMessage(1, update); err == nil {
+		t.Error("the session is still open with the events piling up")
+	}
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import "interviews-ai/internal/ai/vad"
+
+// Defaults matching the Realtime API's server_vad turn detection.
+const (
+	defaultVADThreshold       = 0.5
+	defaultPrefixPaddingMs    = 300
+	defaultSilenceDurationMs  = 500
+	frameMs                   = 20
+	samplesPerFrame           = SampleRate * frameMs / 1000
+	maxSpeechRMSForThreshold1 = 0.04
+)
+
+// turnDetector emulates server_vad with a simple energy detector over 20ms frames.
+// The Realtime threshold (0-1) is mapped linearly onto an RMS level, so the default
+// of 0.5 corresponds to roughly -34 dBFS.
+type turnDetector struct {
+	rmsThreshold   float64
+	silenceFrames  int
+	speaking       bool
+	silentFrames   int
+	pending        []byte
+	processedBytes int
+}
+
+type turnEvent struct {
+	started bool
+	// offset of the event from the start of the input audio, in milliseconds
+	audioMs int
+}
+
+func newTurnDetector(threshold float64, silenceDurationMs int) *turnDetector {
+	if threshold <= 0 {
+		threshold = defaultVADThreshold
+	}
+	if silenceDurationMs <= 0 {
+		silenceDurationMs = defaultSilenceDurationMs
+	}
+	return &turnDetector{
+		rmsThreshold:  threshold * maxSpeechRMSForThreshold1,
+		silenceFrames: silenceDurationMs / frameMs,
+	}
+}
+
+// process consumes PCM audio and returns the speech start and stop events it contains.
+func (d *turnDetector) process(pcm []byte) []turnEvent {
+	var events []turnEvent
+	d.pending = append(d.pending, pcm...)
+
+	frameBytes := samplesPerFrame * 2
+	for len(d.pending) >= frameBytes {
+		frame := d.pending[:frameBytes]
+		d.pending = d.pending[frameBytes:]
+		d.processedBytes += frameBytes
+		audioMs := bytesToMs(d.processedBytes)
+
+		loud := vad.RMS(frame) >= d.rmsThreshold
+		switch {
+		case loud && !d.speaking:
+			d.speaking = true
+			d.silentFrames = 0
+			events = append(events, turnEvent{started: true, audioMs: audioMs - frameMs})
+		case loud:
+			d.silentFrames = 0
+		case d.speaking:
+			d.silentFrames++
+			if d.silentFrames >= d.silenceFrames {
+				d.speaking = false
+				events = append(events, turnEvent{started: false, audioMs: audioMs})
+			}
+		}
+	}
+	return events
+}
+
+func (d *turnDetector) reset() {
+	d.speaking = false
+	d.silentFrames = 0
+	d.pending = nil
+}
+
+func bytesToMs(n int) int {
+	return n / 2 * 1000 / SampleRate
+}
+
+func msToBytes(ms int) int {
+	return ms * SampleRate / 1000 * 2
+}
@@ -0,0 +1,297 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"interviews-ai/internal/ai/cassette"
+	"interviews-ai/internal/ai/pipeline"
+
+	"github.com/gorilla/websocket"
+)
+
+// Supported values of Config.Provider.
+const (
+	ProviderAzure  = "azure"
+	ProviderOpenAI = "openai"
+	ProviderMock   = "mock"
+	// ProviderCascade emulates the Realtime API with separate speech-to-text,
+	// chat completion and text-to-speech backends.
+	ProviderCascade = "cascade"
+	// ProviderReplay serves a recorded cassette instead of calling an upstream.
+	ProviderReplay = "replay"
+)
+
+// UpstreamConn is the connection to a Realtime API backend. *websocket.Conn implements it,
+// and backends emulating the Realtime protocol in-process can provide their own.
+type UpstreamConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// Provider hides the differences between Realtime API backends.
+type Provider interface {
+	Name() string
+	// Headers returns the authentication headers for the upstream connection.
+	Headers(config *Config) http.Header
+	// Dial opens the upstream websocket connection.
+	Dial(config *Config) (UpstreamConn, error)
+	// SessionDefaults returns the session fields sent in the initial session.update.
+	SessionDefaults(config *Config) map[string]interface{}
+	// NormalizeEvent rewrites an upstream event into the dialect the rest of the service
+	// and the browser expect. Events that need no changes are returned as is.
+	NormalizeEvent(message []byte) []byte
+}
+
+// NewProvider returns the provider selected by config.Provider.
+func NewProvider(config *Config) (Provider, error) {
+	switch config.Provider {
+	case ProviderAzure, "":
+		return azureProvider{}, nil
+	case ProviderOpenAI:
+		return openAIProvider{}, nil
+	case ProviderMock:
+		return mockProvider{}, nil
+	case ProviderCascade:
+		return cascadeProvider{}, nil
+	case ProviderReplay:
+		return replayProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", config.Provider)
+	}
+}
+
+func baseSessionDefaults(config *Config) map[string]interface{} {
+	voice := config.Voice
+	if voice == "" {
+		voice = DefaultVoice
+	}
+	temperature := config.Temperature
+	if temperature == 0 {
+		temperature = DefaultTemperature
+	}
+	return map[string]interface{}{
+		"modalities":          []string{"audio", "text"},
+		"temperature":         temperature,
+		"voice":               voice,
+		"input_audio_format":  "pcm16",
+		"output_audio_format": "pcm16",
+		"turn_detection":      config.TurnDetection.event(),
+	}
+}
+
+// withInputTranscription has the user's audio transcribed, for the transcripts shown
+// in the browser and kept in session records.
+func withInputTranscription(session map[string]interface{}) map[string]interface{} {
+	session["input_audio_transcription"] = map[string]interface{}{
+		"model": "whisper-1",
+	}
+	return session
+}
+
+// event returns the turn_detection field of a session.update, which is null when
+// turn detection is off.
+func (t TurnDetection) event() map[string]interface{} {
+	if t.Type == TurnDetectionNone {
+		return nil
+	}
+	turnDetection := map[string]interface{}{"type": TurnDetectionVAD}
+	if t.Type != "" {
+		turnDetection["type"] = t.Type
+	}
+	if t.Threshold != nil {
+		turnDetection["threshold"] = *t.Threshold
+	}
+	if t.PrefixPaddingMs != nil {
+		turnDetection["prefix_padding_ms"] = *t.PrefixPaddingMs
+	}
+	if t.SilenceDurationMs != nil {
+		turnDetection["silence_duration_ms"] = *t.SilenceDurationMs
+	}
+	return turnDetection
+}
+
+func dial(p Provider, config *Config) (UpstreamConn, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: config.DialTimeout,
+	}
+	if dialer.HandshakeTimeout <= 0 {
+		dialer.HandshakeTimeout = DefaultDialTimeout
+	}
+	conn, _, err := dialer.Dial(config.Endpoint, p.Headers(config))
+	if err != nil {
+		return nil, fmt.Errorf("%s dial error: %v", p.Name(), err)
+	}
+	return conn, nil
+}
+
+// azureProvider talks to an Azure OpenAI realtime deployment.
+type azureProvider struct{}
+
+func (azureProvider) Name() string { return ProviderAzure }
+
+func (azureProvider) Headers(config *Config) http.Header {
+	header := make(http.Header)
+	header.Set("api-key", config.APIKey)
+	return header
+}
+
+func (p azureProvider) Dial(config *Config) (UpstreamConn, error) {
+	return dial(p, config)
+}
+
+func (azureProvider) SessionDefaults(config *Config) map[string]interface{} {
+	return withInputTranscription(baseSessionDefaults(config))
+}
+
+func (azureProvider) NormalizeEvent(message []byte) []byte {
+	return message
+}
+
+// openAIProvider talks to the OpenAI Realtime API.
+type openAIProvider struct{}
+
+func (openAIProvider) Name() string { return ProviderOpenAI }
+
+func (openAIProvider) Headers(config *Config) http.Header {
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+config.APIKey)
+	header.Set("OpenAI-Beta", "realtime=v1")
+	return header
+}
+
+func (p openAIProvider) Dial(config *Config) (UpstreamConn, error) {
+	return dial(p, config)
+}
+
+func (openAIProvider) SessionDefaults(config *Config) map[string]interface{} {
+	return withInputTranscription(baseSessionDefaults(config))
+}
+
+// openAIEventRenames maps event types of newer OpenAI Realtime API versions onto
+// the names used by the preview API that the browser understands.
+var openAIEventRenames = map[string]string{
+	"response.output_audio.delta":            MsgTypeResponseAudioDelta,
+	"response.output_audio.done":             "response.audio.done",
+	"response.output_audio_transcript.delta": MsgTypeResponseAudioTranscriptDelta,
+	"response.output_audio_transcript.done":  "response.audio_transcript.done",
+	"response.output_text.delta":             "response.text.delta",
+	"response.output_text.done":              "response.text.done",
+}
+
+func (openAIProvider) NormalizeEvent(message []byte) []byte {
+	return renameEventType(message, openAIEventRenames)
+}
+
+// mockProvider talks to a local mock Realtime server and needs no credentials.
+type mockProvider struct{}
+
+func (mockProvider) Name() string { return ProviderMock }
+
+func (mockProvider) Headers(config *Config) http.Header {
+	return make(http.Header)
+}
+
+func (p mockProvider) Dial(config *Config) (UpstreamConn, error) {
+	return dial(p, config)
+}
+
+func (mockProvider) SessionDefaults(config *Config) map[string]interface{} {
+	return baseSessionDefaults(config)
+}
+
+func (mockProvider) NormalizeEvent(message []byte) []byte {
+	return message
+}
+
+// cascadeProvider runs an in-process pipeline that speaks the Realtime protocol.
+type cascadeProvider struct{}
+
+func (cascadeProvider) Name() string { return ProviderCascade }
+
+func (cascadeProvider) Headers(config *Config) http.Header {
+	return make(http.Header)
+}
+
+func (cascadeProvider) Dial(config *Config) (UpstreamConn, error) {
+	cascade := config.Cascade
+	endpoint := func(baseURL string, model string) pipeline.OpenAIEndpoint {
+		if baseURL == "" {
+			baseURL = cascade.BaseURL
+		}
+		return pipeline.OpenAIEndpoint{BaseURL: baseURL, APIKey: cascade.APIKey, Model: model}
+	}
+
+	conn, err := pipeline.New(pipeline.Config{
+		STT:  &pipeline.OpenAITranscriber{OpenAIEndpoint: endpoint(cascade.STTBaseURL, cascade.STTModel)},
+		Chat: &pipeline.OpenAIChat{OpenAIEndpoint: endpoint(cascade.ChatBaseURL, cascade.ChatModel)},
+		TTS:  &pipeline.OpenAISpeech{OpenAIEndpoint: endpoint(cascade.TTSBaseURL, cascade.TTSModel)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cascade dial error: %v", err)
+	}
+	return conn, nil
+}
+
+func (cascadeProvider) SessionDefaults(config *Config) map[string]interface{} {
+	return baseSessionDefaults(config)
+}
+
+func (cascadeProvider) NormalizeEvent(message []byte) []byte {
+	return message
+}
+
+// replayProvider replays the upstream side of a recorded session.
+type replayProvider struct{}
+
+func (replayProvider) Name() string { return ProviderReplay }
+
+func (replayProvider) Headers(config *Config) http.Header {
+	return make(http.Header)
+}
+
+func (replayProvider) Dial(config *Config) (UpstreamConn, error) {
+	player, err := cassette.Replay(config.ReplayCassette, config.ReplaySpeed)
+	if err != nil {
+		return nil, fmt.Errorf("replay dial error: %v", err)
+	}
+	return player, nil
+}
+
+func (replayProvider) SessionDefaults(config *Config) map[string]interface{} {
+	return baseSessionDefaults(config)
+}
+
+func (replayProvider) NormalizeEvent(message []byte) []byte {
+	return message
+}
+
+// renameEventType rewrites the type of an event if it appears in renames.
+func renameEventType(message []byte, renames map[string]string) []byte {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return message
+	}
+	renamed, ok := renames[header.Type]
+	if !ok {
+		return message
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(message, &event); err != nil {
+		return message
+	}
+	event["type"] = renamed
+	data, err := json.Marshal(event)
+	if err != nil {
+		return message
+	}
+	return data
+}
@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	for name, want := range map[string]string{
+		"":              ProviderAzure,
+		ProviderAzure:   ProviderAzure,
+		ProviderOpenAI:  ProviderOpenAI,
+		ProviderMock:    ProviderMock,
+		ProviderCascade: ProviderCascade,
+		ProviderReplay:  ProviderReplay,
+	} {
+		provider, err := NewProvider(&Config{Provider: name})
+		if err != nil || provider.Name() != want {
+			t.Errorf("NewProvider(%q) = %v, %v, want %s", name, provider, err, want)
+		}
+	}
+	if _, err := NewProvider(&Config{Provider: "gemini"}); err == nil {
+		t.Error("NewProvider accepted an unknown provider")
+	}
+}
+
+func TestProviderHeaders(t *testing.T) {
+	config := &Config{APIKey: "sk-test"}
+	for _, test := range []struct {
+		provider Provider
+		want     http.Header
+	}{
+		{azureProvider{}, http.Header{"Api-Key": {"sk-test"}}},
+		{openAIProvider{}, http.Header{"Authorization": {"Bearer sk-test"}, "Openai-Beta": {"realtime=v1"}}},
+		// these never send the key anywhere
+		{mockProvider{}, http.Header{}},
+		{cascadeProvider{}, http.Header{}},
+		{replayProvider{}, http.Header{}},
+	} {
+		if got := test.provider.Headers(config); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Headers = %v, want %v", test.provider.Name(), got, test.want)
+		}
+	}
+}
+
+func TestSessionDefaults(t *testing.T) {
+	session := azureProvider{}.SessionDefaults(&Config{})
+	if session["voice"] != DefaultVoice || session["temperature"] != DefaultTemperature {
+		t.Errorf("voice, temperature = %v, %v, want the defaults", session["voice"], session["temperature"])
+	}
+	if want := map[string]interface{}{"type": TurnDetectionVAD}; !reflect.DeepEqual(session["turn_detection"], want) {
+		t.Errorf("turn_detection = %v, want %v", session["turn_detection"], want)
+	}
+
+	config := &Config{Voice: "verse", Temperature: 0.6, TurnDetection: TurnDetection{Threshold: ref(0.7), SilenceDurationMs: ref(800)}}
+	session = azureProvider{}.SessionDefaults(config)
+	if session["voice"] != "verse" || session["temperature"] != 0.6 {
+		t.Errorf("voice, temperature = %v, %v, want the configured ones", session["voice"], session["temperature"])
+	}
+	if want := map[string]interface{}{"type": TurnDetectionVAD, "threshold": 0.7, "silence_duration_ms": 800}; !reflect.DeepEqual(session["turn_detection"], want) {
+		t.Errorf("turn_detection = %v, want %v", session["turn_detection"], want)
+	}
+	session = azureProvider{}.SessionDefaults(&Config{TurnDetection: TurnDetection{Type: TurnDetectionNone}})
+	if turnDetection, _ := session["turn_detection"].(map[string]interface{}); turnDetection != nil {
+		t.Errorf("turn_detection = %v, want null when turned off", turnDetection)
+	}
+
+	// the hosted APIs transcribe the user's audio
+	for _, provider := range []Provider{azureProvider{}, openAIProvider{}} {
+		if _, ok := provider.SessionDefaults(&Config{})["input_audio_transcription"]; !ok {
+			t.Errorf("%s: input audio is not transcribed", provider.Name())
+		}
+	}
+}
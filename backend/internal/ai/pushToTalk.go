@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"fmt"
+)
+
+// Constants for push-to-talk event types.
+const (
+	// MsgTypePTTStart and MsgTypePTTStop are sent by the browser when the user presses
+	// and releases the talk button of a session without turn detection.
+	MsgTypePTTStart = "ptt.start"
+	MsgTypePTTStop  = "ptt.stop"
+	// MsgTypePTTError reports a push-to-talk event that was ignored.
+	MsgTypePTTError = "ptt.error"
+
+	MsgTypeAudioBufferClear = "input_audio_buffer.clear"
+
+	// MinPushToTalkMs is the least audio a turn needs to be committed; the upstream
+	// rejects shorter buffers.
+	MinPushToTalkMs = 100
+	// pcm16 at 24kHz
+	audioBytesPerMs = 48
+)
+
+// PTTErrorEvent reports why a push-to-talk event was ignored.
+type PTTErrorEvent struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// pushToTalk tracks the turn the user is talking in. It is only used by the write pump.
+type pushToTalk struct {
+	talking bool
+	// audioBytes is the audio appended since the talk button was pressed.
+	audioBytes int
+}
+
+// handlePTTStart starts a turn: anything already in the input buffer is dropped.
+func handlePTTStart(c *AIClient) error {
+	if mode := c.sessionSettings().TurnDetection.Type; mode != TurnDetectionNone {
+		sendToClient(c, PTTErrorEvent{Type: MsgTypePTTError, Error: fmt.Sprintf("push-to-talk needs turn_detection none, the session uses %s", mode)})
+		return nil
+	}
+	if err := c.writeJSON(map[string]interface{}{"type": MsgTypeAudioBufferClear}); err != nil {
+		return err
+	}
+	c.ptt = pushToTalk{talking: true}
+	return nil
+}
+
+// handlePTTStop ends a turn: the input buffer is committed and a response requested,
+// unless too little audio was sent, in which case it is cleared.
+func handlePTTStop(c *AIClient) error {
+	if !c.ptt.talking {
+		sendToClient(c, PTTErrorEvent{Type: MsgTypePTTError, Error: "ptt.stop without ptt.start"})
+		return nil
+	}
+	turn := c.ptt
+	c.ptt = pushToTalk{}
+
+	if ms := turn.audioBytes / audioBytesPerMs; ms < MinPushToTalkMs {
+		c.logger().Debug("Dropped a push-to-talk turn that was too short", "audio_ms", ms)
+		sendToClient(c, PTTErrorEvent{Type: MsgTypePTTError, Error: fmt.Sprintf("%dms of audio is too short, at least %dms is needed", ms, MinPushToTalkMs)})
+		return c.writeJSON(map[string]interface{}{"type": MsgTypeAudioBufferClear})
+	}
+	if err := c.writeJSON(map[string]interface{}{"type": MsgTypeAudioBufferCommit}); err != nil {
+		return err
+	}
+	return c.writeJSON(ResponseCreateEvent{Type: MsgTypeResponseCreate})
+}
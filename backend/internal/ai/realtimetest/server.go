@@ -0,0 +1,268 @@
+// Package realtimetest provides a mock Realtime API server for offline development
+// and deterministic tests of the AI client and hub.
+//
+// The server answers session.update with session.updated, simulates server VAD on
+// appended audio, and answers each response with scripted or synthesized transcript
+// and audio deltas. Latency, error events, rejected dials and disconnects can be
+// injected through Options or at runtime.
+package realtimetest
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Model is the model the mock server reports in session.created.
+const Model = "gpt-4o-realtime-preview"
+
+// Options configures the behaviour of a mock server.
+type Options struct {
+	// Script lists the responses to give, in order. Once exhausted, responses are synthesized.
+	Script []ScriptedResponse
+	// Latency delays every server event.
+	Latency time.Duration
+	// DialDelay delays the websocket handshake.
+	DialDelay time.Duration
+	// RejectStatus, if set, rejects every connection with this HTTP status.
+	RejectStatus int
+	// FailOn maps client event types to an error message sent back instead of handling the event.
+	FailOn map[string]string
+	// DisconnectAfter closes a connection after this many client events. Zero never disconnects.
+	DisconnectAfter int
+	// RealTime paces audio deltas at playback speed instead of sending them as fast as possible.
+	RealTime bool
+	// VADThreshold is the peak amplitude (0-1) above which an audio chunk counts as speech.
+	VADThreshold float64
+	// SilenceDuration is how much silent audio ends a detected turn.
+	SilenceDuration time.Duration
+	// InputTranscript is reported as the transcription of every committed user turn.
+	InputTranscript string
+	// Record keeps every client event for Received, ReceivedTypes and WaitFor. It is
+	// meant for tests; a long-running server would keep them forever.
+	Record bool
+}
+
+// ScriptedResponse describes one response of the mock model.
+type ScriptedResponse struct {
+	// Transcript is spoken word by word as transcript deltas.
+	Transcript string `json:"transcript,omitempty"`
+	// AudioMs is the length of synthesized audio; it defaults to 100ms per word.
+	AudioMs int `json:"audio_ms,omitempty"`
+	// FunctionCall, if set, makes the response a tool call instead of speech.
+	FunctionCall *FunctionCall `json:"function_call,omitempty"`
+	// FunctionCalls are further tool calls made in the same response, after FunctionCall.
+	FunctionCalls []FunctionCall `json:"function_calls,omitempty"`
+	// Error, if set, is sent as an error event instead of a response.
+	Error string `json:"error,omitempty"`
+	// Usage overrides the token usage reported in response.done.
+	Usage map[string]interface{} `json:"usage,omitempty"`
+}
+
+// FunctionCall is a scripted tool call.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ClientEvent is an event received from a client, kept for assertions.
+type ClientEvent struct {
+	SessionID string
+	Type      string
+	Raw       json.RawMessage
+}
+
+const (
+	defaultTranscript      = "This is a mock response from the interviewer."
+	defaultVADThreshold    = 0.02
+	defaultSilenceDuration = 500 * time.Millisecond
+	audioChunkMs           = 100
+)
+
+// Server is a mock Realtime API server.
+type Server struct {
+	opts     Options
+	upgrader websocket.Upgrader
+
+	mu         sync.Mutex
+	httpServer *httptest.Server
+	sessions   map[string]*session
+	received   []ClientEvent
+	scriptPos  int
+	notify     chan struct{}
+}
+
+// New returns a mock server that is not listening; use Handler to serve it.
+func New(opts Options) *Server {
+	if opts.VADThreshold <= 0 {
+		opts.VADThreshold = defaultVADThreshold
+	}
+	if opts.SilenceDuration <= 0 {
+		opts.SilenceDuration = defaultSilenceDuration
+	}
+	return &Server{
+		opts:     opts,
+		sessions: make(map[string]*session),
+		notify:   make(chan struct{}),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// NewServer starts a mock server on a local port. Close it when done.
+func NewServer(opts Options) *Server {
+	s := New(opts)
+	s.httpServer = httptest.NewServer(s.Handler())
+	return s
+}
+
+// URL is the websocket URL of a server started with NewServer.
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.httpServer.URL, "http") + "/realtime"
+}
+
+// Close disconnects every session and stops a server started with NewServer.
+func (s *Server) Close() {
+	s.DisconnectAll()
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// Handler serves the Realtime protocol on any path.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.serveWs)
+}
+
+func (s *Server) serveWs(w http.ResponseWriter, r *http.Request) {
+	if s.opts.DialDelay > 0 {
+		time.Sleep(s.opts.DialDelay)
+	}
+	if s.opts.RejectStatus != 0 {
+		http.Error(w, http.StatusText(s.opts.RejectStatus), s.opts.RejectStatus)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("realtimetest: upgrade error", "error", err)
+		return
+	}
+
+	sess := newSession(s, conn)
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+
+	sess.run()
+
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+}
+
+// Sessions returns the number of connected sessions.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Received returns a copy of every client event received so far, if the server records them.
+func (s *Server) Received() []ClientEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ClientEvent(nil), s.received...)
+}
+
+// ReceivedTypes returns the types of the client events received so far.
+func (s *Server) ReceivedTypes() []string {
+	events := s.Received()
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+// WaitFor blocks until a client event of the given type has been received or the
+// timeout elapses, and reports whether it arrived.
+func (s *Server) WaitFor(eventType string, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for _, event := range s.received {
+			if event.Type == eventType {
+				s.mu.Unlock()
+				return true
+			}
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// InjectError sends an error event to every connected session.
+func (s *Server) InjectError(message string) {
+	for _, sess := range s.snapshot() {
+		sess.sendError("server_error", message)
+	}
+}
+
+// DisconnectAll abruptly closes every session's connection.
+func (s *Server) DisconnectAll() {
+	for _, sess := range s.snapshot() {
+		sess.conn.Close()
+	}
+}
+
+func (s *Server) snapshot() []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+func (s *Server) record(event ClientEvent) {
+	if !s.opts.Record {
+		return
+	}
+	s.mu.Lock()
+	s.received = append(s.received, event)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// nextResponse returns the next scripted response, or a synthesized one.
+func (s *Server) nextResponse() ScriptedResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scriptPos < len(s.opts.Script) {
+		response := s.opts.Script[s.scriptPos]
+		s.scriptPos++
+		return response
+	}
+	return ScriptedResponse{Transcript: defaultTranscript}
+}
+
+func newID(prefix string) string {
+	return prefix + "_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:20]
+}
@@ -0,0 +1,412 @@
+package realtimetest
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const sampleRate = 24000
+
+// session is one client connection to the mock server.
+type session struct {
+	id     string
+	server *Server
+	conn   *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu             sync.Mutex
+	config         map[string]interface{}
+	events         int
+	speaking       bool
+	silentMs       int
+	receivedMs     int
+	bufferedBytes  int
+	inputTokens    int
+	cancelResponse chan struct{}
+}
+
+func newSession(server *Server, conn *websocket.Conn) *session {
+	return &session{
+		id:     newID("sess"),
+		server: server,
+		conn:   conn,
+		config: map[string]interface{}{
+			"model":               Model,
+			"modalities":          []string{"audio", "text"},
+			"voice":               "alloy",
+			"input_audio_format":  "pcm16",
+			"output_audio_format": "pcm16",
+			"turn_detection":      map[string]interface{}{"type": "server_vad"},
+		},
+	}
+}
+
+func (s *session) run() {
+	defer s.conn.Close()
+
+	s.send(map[string]interface{}{"type": "session.created", "session": s.sessionConfig()})
+
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			s.cancel()
+			return
+		}
+
+		var event struct {
+			Type     string                 `json:"type"`
+			Audio    string                 `json:"audio"`
+			Session  map[string]interface{} `json:"session"`
+			Item     map[string]interface{} `json:"item"`
+			Response map[string]interface{} `json:"response"`
+		}
+		if err := json.Unmarshal(message, &event); err != nil {
+			s.sendError("invalid_request_error", "invalid JSON")
+			continue
+		}
+		s.server.record(ClientEvent{SessionID: s.id, Type: event.Type, Raw: append(json.RawMessage(nil), message...)})
+
+		s.mu.Lock()
+		s.events++
+		disconnect := s.server.opts.DisconnectAfter > 0 && s.events >= s.server.opts.DisconnectAfter
+		s.mu.Unlock()
+		if disconnect {
+			s.cancel()
+			return
+		}
+
+		if msg, fail := s.server.opts.FailOn[event.Type]; fail {
+			s.sendError("invalid_request_error", msg)
+			continue
+		}
+
+		switch event.Type {
+		case "session.update":
+			s.mu.Lock()
+			for key, value := range event.Session {
+				s.config[key] = value
+			}
+			s.mu.Unlock()
+			s.send(map[string]interface{}{"type": "session.updated", "session": s.sessionConfig()})
+		case "input_audio_buffer.append":
+			s.appendAudio(event.Audio)
+		case "input_audio_buffer.commit":
+			s.mu.Lock()
+			empty := s.bufferedBytes == 0
+			s.mu.Unlock()
+			if empty {
+				s.sendError("invalid_request_error", "Error committing input audio buffer: buffer too small.")
+				continue
+			}
+			s.commit()
+		case "input_audio_buffer.clear":
+			s.mu.Lock()
+			s.bufferedBytes = 0
+			s.speaking = false
+			s.mu.Unlock()
+			s.send(map[string]interface{}{"type": "input_audio_buffer.cleared"})
+		case "conversation.item.create":
+			item := event.Item
+			if item == nil {
+				item = map[string]interface{}{}
+			}
+			item["id"] = newID("item")
+			s.send(map[string]interface{}{"type": "conversation.item.created", "item": item})
+		case "response.create":
+			metadata, _ := event.Response["metadata"].(map[string]interface{})
+			s.startResponse(metadata)
+		case "response.cancel":
+			s.cancel()
+		}
+	}
+}
+
+func (s *session) sessionConfig() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config := map[string]interface{}{"id": s.id, "object": "realtime.session"}
+	for key, value := range s.config {
+		config[key] = value
+	}
+	return config
+}
+
+// appendAudio simulates server VAD: a chunk whose peak exceeds the threshold is speech,
+// and SilenceDuration of silent audio after speech ends the turn.
+func (s *session) appendAudio(audio string) {
+	pcm, err := base64.StdEncoding.DecodeString(audio)
+	if err != nil {
+		s.sendError("invalid_request_error", "Invalid audio: not base64")
+		return
+	}
+	chunkMs := len(pcm) / 2 * 1000 / sampleRate
+	loud := peak(pcm) >= s.server.opts.VADThreshold
+
+	s.mu.Lock()
+	start := s.receivedMs
+	s.receivedMs += chunkMs
+	s.bufferedBytes += len(pcm)
+	_, vad := s.config["turn_detection"].(map[string]interface{})
+	started, stopped := false, false
+	if vad {
+		switch {
+		case loud && !s.speaking:
+			s.speaking = true
+			s.silentMs = 0
+			started = true
+		case loud:
+			s.silentMs = 0
+		case s.speaking:
+			s.silentMs += chunkMs
+			if s.silentMs >= int(s.server.opts.SilenceDuration.Milliseconds()) {
+				s.speaking = false
+				stopped = true
+			}
+		}
+	}
+	end := s.receivedMs
+	s.mu.Unlock()
+
+	if started {
+		s.cancel()
+		s.send(map[string]interface{}{"type": "input_audio_buffer.speech_started", "audio_start_ms": start})
+	}
+	if stopped {
+		s.send(map[string]interface{}{"type": "input_audio_buffer.speech_stopped", "audio_end_ms": end})
+		s.commit()
+		s.startResponse(nil)
+	}
+}
+
+func (s *session) commit() {
+	s.mu.Lock()
+	// roughly 10 audio tokens per second of input
+	s.inputTokens += s.bufferedBytes / 2 / (sampleRate / 10)
+	s.bufferedBytes = 0
+	s.mu.Unlock()
+
+	itemID := newID("item")
+	s.send(map[string]interface{}{"type": "input_audio_buffer.committed", "item_id": itemID})
+	s.send(map[string]interface{}{
+		"type": "conversation.item.created",
+		"item": map[string]interface{}{
+			"id": itemID, "type": "message", "role": "user",
+			"content": []map[string]interface{}{{"type": "input_audio", "transcript": nil}},
+		},
+	})
+	if transcript := s.server.opts.InputTranscript; transcript != "" {
+		s.send(map[string]interface{}{
+			"type":    "conversation.item.input_audio_transcription.completed",
+			"item_id": itemID, "content_index": 0, "transcript": transcript,
+		})
+	}
+}
+
+// startResponse answers with the next response. Its metadata, if any, is echoed in
+// response.created and response.done.
+func (s *session) startResponse(metadata map[string]interface{}) {
+	cancel := make(chan struct{})
+	s.mu.Lock()
+	if s.cancelResponse != nil {
+		close(s.cancelResponse)
+	}
+	s.cancelResponse = cancel
+	inputTokens := s.inputTokens
+	s.inputTokens = 0
+	s.mu.Unlock()
+
+	go s.respond(s.server.nextResponse(), inputTokens, metadata, cancel)
+}
+
+// cancel stops the response in progress, if any.
+func (s *session) cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelResponse != nil {
+		close(s.cancelResponse)
+		s.cancelResponse = nil
+	}
+}
+
+func (s *session) respond(script ScriptedResponse, inputTokens int, metadata map[string]interface{}, cancel chan struct{}) {
+	if script.Error != "" {
+		s.sendError("server_error", script.Error)
+		return
+	}
+
+	responseID := newID("resp")
+	itemID := newID("item")
+	cancelled := func() bool {
+		select {
+		case <-cancel:
+			return true
+		default:
+			return false
+		}
+	}
+
+	s.send(map[string]interface{}{
+		"type":     "response.created",
+		"response": map[string]interface{}{"id": responseID, "object": "realtime.response", "status": "in_progress", "output": []interface{}{}, "metadata": metadata},
+	})
+
+	calls := script.FunctionCalls
+	if script.FunctionCall != nil {
+		calls = append([]FunctionCall{*script.FunctionCall}, calls...)
+	}
+
+	var item map[string]interface{}
+	var output []interface{}
+	outputText, outputAudio := 0, 0
+	if len(calls) > 0 {
+		for i, call := range calls {
+			if i > 0 {
+				itemID = newID("item")
+			}
+			callID := newID("call")
+			item = map[string]interface{}{"id": itemID, "type": "function_call", "status": "in_progress", "call_id": callID, "name": call.Name, "arguments": ""}
+			s.send(map[string]interface{}{"type": "response.output_item.added", "response_id": responseID, "output_index": i, "item": item})
+			s.send(map[string]interface{}{"type": "response.function_call_arguments.delta", "response_id": responseID, "item_id": itemID, "output_index": i, "call_id": callID, "delta": call.Arguments})
+			s.send(map[string]interface{}{"type": "response.function_call_arguments.done", "response_id": responseID, "item_id": itemID, "output_index": i, "call_id": callID, "name": call.Name, "arguments": call.Arguments})
+			item = map[string]interface{}{"id": itemID, "type": "function_call", "status": "completed", "call_id": callID, "name": call.Name, "arguments": call.Arguments}
+			if i < len(calls)-1 {
+				s.send(map[string]interface{}{"type": "response.output_item.done", "response_id": responseID, "output_index": i, "item": item})
+				output = append(output, item)
+			}
+			outputText += len(strings.Fields(call.Arguments)) + 1
+		}
+	} else {
+		item = map[string]interface{}{"id": itemID, "type": "message", "role": "assistant", "status": "in_progress", "content": []interface{}{}}
+		s.send(map[string]interface{}{"type": "response.output_item.added", "response_id": responseID, "output_index": 0, "item": item})
+		s.send(map[string]interface{}{"type": "conversation.item.created", "item": item})
+		ids := func(event map[string]interface{}) map[string]interface{} {
+			event["response_id"] = responseID
+			event["item_id"] = itemID
+			event["output_index"] = 0
+			event["content_index"] = 0
+			return event
+		}
+		s.send(ids(map[string]interface{}{"type": "response.content_part.added", "part": map[string]interface{}{"type": "audio", "transcript": ""}}))
+
+		words := strings.Fields(script.Transcript)
+		audioMs := script.AudioMs
+		if audioMs <= 0 {
+			audioMs = 100 * len(words)
+		}
+		audio := synthesize(audioMs)
+		chunk := audioChunkMs * sampleRate / 1000 * 2
+		chunks := (len(audio) + chunk - 1) / chunk
+
+		// interleave transcript and audio deltas like the real API
+		var spoken []string
+		for i := 0; i < max(len(words), chunks) && !cancelled(); i++ {
+			if i < len(words) {
+				delta := words[i]
+				if i > 0 {
+					delta = " " + delta
+				}
+				spoken = append(spoken, words[i])
+				s.send(ids(map[string]interface{}{"type": "response.audio_transcript.delta", "delta": delta}))
+			}
+			if i < chunks {
+				end := min((i+1)*chunk, len(audio))
+				s.send(ids(map[string]interface{}{"type": "response.audio.delta", "delta": base64.StdEncoding.EncodeToString(audio[i*chunk : end])}))
+				if s.server.opts.RealTime {
+					time.Sleep(audioChunkMs * time.Millisecond)
+				}
+			}
+		}
+
+		transcript := strings.Join(spoken, " ")
+		outputText = len(spoken)
+		outputAudio = audioMs / 50
+		s.send(ids(map[string]interface{}{"type": "response.audio.done"}))
+		s.send(ids(map[string]interface{}{"type": "response.audio_transcript.done", "transcript": transcript}))
+		content := map[string]interface{}{"type": "audio", "transcript": transcript}
+		s.send(ids(map[string]interface{}{"type": "response.content_part.done", "part": content}))
+		item = map[string]interface{}{"id": itemID, "type": "message", "role": "assistant", "status": "completed", "content": []interface{}{content}}
+	}
+
+	status := "completed"
+	if cancelled() {
+		status = "cancelled"
+		item["status"] = "incomplete"
+	}
+	s.send(map[string]interface{}{"type": "response.output_item.done", "response_id": responseID, "output_index": len(output), "item": item})
+	output = append(output, item)
+
+	usage := script.Usage
+	if usage == nil {
+		usage = map[string]interface{}{
+			"total_tokens":  inputTokens + outputText + outputAudio,
+			"input_tokens":  inputTokens,
+			"output_tokens": outputText + outputAudio,
+			"input_token_details": map[string]interface{}{
+				"cached_tokens": 0, "text_tokens": 0, "audio_tokens": inputTokens,
+			},
+			"output_token_details": map[string]interface{}{
+				"text_tokens": outputText, "audio_tokens": outputAudio,
+			},
+		}
+	}
+	s.send(map[string]interface{}{
+		"type": "response.done",
+		"response": map[string]interface{}{
+			"id": responseID, "object": "realtime.response", "status": status,
+			"output": output, "usage": usage, "metadata": metadata,
+		},
+	})
+}
+
+func (s *session) send(event map[string]interface{}) {
+	if s.server.opts.Latency > 0 {
+		time.Sleep(s.server.opts.Latency)
+	}
+	event["event_id"] = newID("event")
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s *session) sendError(errType string, message string) {
+	s.send(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": errType, "code": errType, "message": message},
+	})
+}
+
+// synthesize returns ms milliseconds of a 440Hz tone as pcm16.
+func synthesize(ms int) []byte {
+	samples := ms * sampleRate / 1000
+	pcm := make([]byte, samples*2)
+	for i := 0; i < samples; i++ {
+		value := 0.3 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(value*math.MaxInt16)))
+	}
+	return pcm
+}
+
+// peak returns the largest absolute sample of pcm16 audio, normalized to 0-1.
+func peak(pcm []byte) float64 {
+	var highest float64
+	for i := 0; i+1 < len(pcm); i += 2 {
+		sample := math.Abs(float64(int16(binary.LittleEndian.Uint16(pcm[i:]))) / math.MaxInt16)
+		if sample > highest {
+			highest = sample
+		}
+	}
+	return highest
+}
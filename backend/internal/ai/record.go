@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"interviews-ai/internal/ai/editor"
+)
+
+// SessionRecord is what is kept about a session once it ends.
+type SessionRecord struct {
+	SessionId  string            `json:"session_id"`
+	ClientId   string            `json:"client_id"`
+	AiClientId string            `json:"ai_client_id"`
+	UserID     string            `json:"user_id,omitempty"`
+	Template   string            `json:"template,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	EndedAt    time.Time         `json:"ended_at"`
+	Usage      SessionUsage      `json:"usage"`
+	Transcript []TranscriptEntry `json:"transcript,omitempty"`
+	Code       *editor.Snapshot  `json:"code,omitempty"`
+}
+
+// RecordStore persists session records.
+type RecordStore interface {
+	SaveRecord(record *SessionRecord) error
+}
+
+// FileRecordStore writes each session record as a JSON file in Dir, and the usage
+// totals of each user as a JSON file in Dir/users.
+type FileRecordStore struct {
+	Dir string
+
+	// usageMu serializes updates of the user usage files.
+	usageMu sync.Mutex
+}
+
+func NewFileRecordStore(dir string) (*FileRecordStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create records dir: %v", err)
+	}
+	return &FileRecordStore{Dir: dir}, nil
+}
+
+func (s *FileRecordStore) SaveRecord(record *SessionRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json marshal error: %v", err)
+	}
+	return writeFileAtomic(filepath.Join(s.Dir, record.AiClientId+".json"), data)
+}
+
+// AddUsage adds usage to the totals kept in the file of user.
+func (s *FileRecordStore) AddUsage(user string, usage TokenUsage) (UserUsage, error) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	total, err := s.readUsage(user)
+	if err != nil {
+		return UserUsage{}, err
+	}
+	total = addUserUsage(total, user, usage)
+	data, err := json.MarshalIndent(total, "", "  ")
+	if err != nil {
+		return UserUsage{}, fmt.Errorf("json marshal error: %v", err)
+	}
+	path := s.usagePath(user)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return UserUsage{}, err
+	}
+	return total, writeFileAtomic(path, data)
+}
+
+// UserUsage returns the totals kept in the file of user.
+func (s *FileRecordStore) UserUsage(user string) (UserUsage, error) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	return s.readUsage(user)
+}
+
+func (s *FileRecordStore) readUsage(user string) (UserUsage, error) {
+	var total UserUsage
+	data, err := os.ReadFile(s.usagePath(user))
+	if errors.Is(err, fs.ErrNotExist) {
+		return total, nil
+	}
+	if err != nil {
+		return total, err
+	}
+	if err := json.Unmarshal(data, &total); err != nil {
+		return total, fmt.Errorf("read usage of %s: %v", user, err)
+	}
+	return total, nil
+}
+
+// usagePath returns the file of user. User ids come from the browser; escaping
+// keeps them inside the directory.
+func (s *FileRecordStore) usagePath(user string) string {
+	return filepath.Join(s.Dir, "users", url.PathEscape(user)+".json")
+}
+
+// writeFileAtomic writes to a temp file first so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Check verifies that records can still be written to Dir.
+func (s *FileRecordStore) Check() error {
+	file, err := os.CreateTemp(s.Dir, ".check-*")
+	if err != nil {
+		return fmt.Errorf("records dir is not writable: %v", err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
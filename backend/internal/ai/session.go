@@ -0,0 +1,412 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"interviews-ai/internal/ai/types"
+	"interviews-ai/internal/logging"
+	"interviews-ai/internal/metrics"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SessionState is where a session is in its lifecycle. States only move forward.
+type SessionState string
+
+const (
+	SessionConnecting SessionState = "connecting"
+	SessionActive     SessionState = "active"
+	SessionDraining   SessionState = "draining"
+	SessionClosed     SessionState = "closed"
+)
+
+var sessionStateOrder = []SessionState{SessionConnecting, SessionActive, SessionDraining, SessionClosed}
+
+// SessionUsage counts the traffic of a session.
+type SessionUsage struct {
+	// MessagesIn and MessagesOut count messages from the browser and from the AI.
+	MessagesIn  int64 `json:"messages_in"`
+	MessagesOut int64 `json:"messages_out"`
+	// AudioBytesIn and AudioBytesOut count decoded pcm16 audio in each direction.
+	AudioBytesIn  int64 `json:"audio_bytes_in"`
+	AudioBytesOut int64 `json:"audio_bytes_out"`
+	// SuppressedAudioMs is browser audio the noise gate did not send upstream.
+	SuppressedAudioMs int64 `json:"suppressed_audio_ms"`
+	Responses         int64 `json:"responses"`
+	// TokenUsage adds up the usage of every response.
+	TokenUsage
+}
+
+// TranscriptEntry is one spoken turn of the conversation.
+type TranscriptEntry struct {
+	Role string    `json:"role"`
+	Text string    `json:"text"`
+	At   time.Time `json:"at"`
+}
+
+// SessionSnapshot is a copy of a session's state at one point in time.
+type SessionSnapshot struct {
+	ID         string       `json:"id"`
+	ClientId   string       `json:"client_id"`
+	AiClientId string       `json:"ai_client_id"`
+	UserID     string       `json:"user_id"`
+	Template   string       `json:"template"`
+	StartedAt  time.Time    `json:"started_at"`
+	State      SessionState `json:"state"`
+	Usage      SessionUsage `json:"usage"`
+	// LastEvent is the type of the last event seen in either direction.
+	LastEvent   string            `json:"last_event,omitempty"`
+	LastEventAt time.Time         `json:"last_event_at,omitempty"`
+	Transcript  []TranscriptEntry `json:"transcript,omitempty"`
+}
+
+// Session pairs the browser and AI connections of one conversation, owns the four
+// pumps serving them and keeps what is known about the conversation. It is the only
+// place either connection is closed.
+//
+// Messages are routed directly between the two clients' Send channels. A client that
+// falls so far behind that its Send channel fills up gets the whole session evicted.
+//
+// Closing a session cancels its context, which stops the read pumps from routing and
+// abandons tool calls. The pair is then unregistered from the hub, after which the
+// write pumps flush what was already routed to them, send their close frames and stop.
+// Both connections are closed next, which ends the read pumps, and finally the session
+// record is saved. Send channels are never closed, so a read pump can route to a
+// closing session safely.
+type Session struct {
+	ID       string
+	Client   *Client
+	AIClient *AIClient
+	Hub      *Hub
+
+	// UserID and Template are set before the session connects.
+	UserID    string
+	Template  string
+	StartedAt time.Time
+	// Logger carries the session's correlation IDs and is shared with both clients.
+	Logger *slog.Logger
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	// stop is closed once the session is unregistered, telling the write pumps to flush and exit
+	stop chan struct{}
+	done chan struct{}
+
+	writers sync.WaitGroup
+	readers sync.WaitGroup
+	sampler *logging.Sampler
+	turns   turnTrace
+	// deadline ends the session after Config.MaxSessionDuration.
+	deadline *time.Timer
+
+	mu          sync.Mutex
+	state       SessionState
+	usage       SessionUsage
+	lastEvent   string
+	lastEventAt time.Time
+	transcript  []TranscriptEntry
+}
+
+// NewSession ties client and aiClient to a new session derived from parent.
+func NewSession(parent context.Context, hub *Hub, client *Client, aiClient *AIClient) *Session {
+	ctx, cancel := context.WithCancel(parent)
+	id := "SES_" + uuid.New().String()
+	s := &Session{
+		ID:        id,
+		Client:    client,
+		AIClient:  aiClient,
+		Hub:       hub,
+		StartedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		state:     SessionConnecting,
+		sampler:   logging.NewSampler(logging.SampleEvery),
+	}
+	s.setLogger(slog.Default().With("session_id", id, "client_id", client.ClientId, "ai_client_id", aiClient.AiClientId))
+	client.Session = s
+	aiClient.Session = s
+	return s
+}
+
+// Connect registers the session, dials the AI upstream and starts the pumps. If the
+// dial fails the session is unregistered and closed and the error is returned.
+func (s *Session) Connect(dial func() (UpstreamConn, error)) error {
+	s.setLogger(s.Logger.With("user_id", s.UserID, "template", s.Template))
+	s.Hub.Register(s)
+
+	conn, err := dial()
+	if err != nil {
+		s.Logger.Error("Failed to connect to AI upstream", "error", err)
+		s.Hub.Unregister(s)
+		s.Close()
+		s.advance(SessionClosed)
+		close(s.done)
+		return err
+	}
+	s.AIClient.Conn = conn
+	s.advance(SessionActive)
+
+	s.writers.Add(2)
+	go func() {
+		defer s.writers.Done()
+		s.Client.ClientWritePump()
+	}()
+	go func() {
+		defer s.writers.Done()
+		s.AIClient.AiClientWritePump()
+	}()
+
+	s.readers.Add(2)
+	go func() {
+		defer s.readers.Done()
+		s.Client.ClientReadPump()
+	}()
+	go func() {
+		defer s.readers.Done()
+		s.AIClient.AiClientReadPump()
+	}()
+
+	s.startDeadline()
+	go s.shutdown()
+	return nil
+}
+
+// Context is cancelled when the session starts closing.
+func (s *Session) Context() context.Context {
+	if s == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Close starts tearing the session down. It does not block and is safe to call any
+// number of times, from any goroutine, including on a nil session.
+func (s *Session) Close() {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		s.Logger.Info("Closing session")
+		s.advance(SessionDraining)
+		s.cancel()
+	})
+}
+
+// Done is closed once the session has been fully torn down.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) shutdown() {
+	<-s.ctx.Done()
+	if s.deadline != nil {
+		s.deadline.Stop()
+	}
+
+	s.Hub.Unregister(s)
+	close(s.stop)
+
+	s.writers.Wait()
+	s.Client.closeConn()
+	s.AIClient.closeConn()
+	s.readers.Wait()
+
+	s.turns.finish()
+	saveRecord(s.AIClient)
+	s.advance(SessionClosed)
+	close(s.done)
+}
+
+// State returns where the session is in its lifecycle.
+func (s *Session) State() SessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Snapshot returns a copy of the session's state.
+func (s *Session) Snapshot() SessionSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SessionSnapshot{
+		ID:          s.ID,
+		ClientId:    s.Client.ClientId,
+		AiClientId:  s.AIClient.AiClientId,
+		UserID:      s.UserID,
+		Template:    s.Template,
+		StartedAt:   s.StartedAt,
+		State:       s.state,
+		Usage:       s.usage,
+		LastEvent:   s.lastEvent,
+		LastEventAt: s.lastEventAt,
+		Transcript:  append([]TranscriptEntry{}, s.transcript...),
+	}
+}
+
+// advance moves the session to state unless it is already past it.
+func (s *Session) advance(state SessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.Index(sessionStateOrder, state) > slices.Index(sessionStateOrder, s.state) {
+		s.state = state
+	}
+}
+
+// count updates the usage counters of a session, which may be nil.
+func (s *Session) count(update func(usage *SessionUsage)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.usage)
+}
+
+// noteEvent counts an event seen in direction and remembers it as the session's
+// last event. The session may be nil.
+func (s *Session) noteEvent(direction string, eventType string) {
+	if eventType == "" {
+		return
+	}
+	metrics.CountEvent(direction, eventType)
+	if s == nil {
+		return
+	}
+	s.logEvent(direction, eventType)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastEvent = eventType
+	s.lastEventAt = time.Now()
+}
+
+// highFrequencyEvents arrive many times a second during a conversation, so only one
+// in every logging.SampleEvery of them is logged.
+var highFrequencyEvents = map[string]bool{
+	MsgTypeAudioBufferAppend:                 true,
+	MsgTypeResponseAudioDelta:                true,
+	"response.audio_transcript.delta":        true,
+	"response.text.delta":                    true,
+	"response.function_call_arguments.delta": true,
+}
+
+// logEvent logs an event at debug level, sampling high-frequency ones.
+func (s *Session) logEvent(direction string, eventType string) {
+	if !s.Logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	if !highFrequencyEvents[eventType] {
+		s.Logger.Debug("Event", "direction", direction, "type", eventType)
+		return
+	}
+	if ok, count := s.sampler.Allow(direction + " " + eventType); ok {
+		s.Logger.Debug("Event (sampled)", "direction", direction, "type", eventType, "count", count)
+	}
+}
+
+// traceEvent feeds an upstream event to the trace of the current turn. The session
+// may be nil.
+func (s *Session) traceEvent(event ServerEvent) {
+	if s == nil {
+		return
+	}
+	s.turns.observe(s, event)
+}
+
+// startSpan starts a child span of the current turn. The session may be nil.
+func (s *Session) startSpan(name string, attributes ...attribute.KeyValue) trace.Span {
+	if s == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+	return s.turns.startSpan(name, attributes...)
+}
+
+// setLogger replaces the logger of the session and both of its clients.
+func (s *Session) setLogger(logger *slog.Logger) {
+	s.Logger = logger
+	s.Client.Logger = logger
+	s.AIClient.Logger = logger
+}
+
+// addTranscript records a spoken turn, ignoring empty ones.
+func (s *Session) addTranscript(role string, text string) {
+	if s == nil || text == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcript = append(s.transcript, TranscriptEntry{Role: role, Text: text, At: time.Now()})
+}
+
+// ErrSessionNotActive is returned when acting on a session that is not active.
+var ErrSessionNotActive = errors.New("session is not active")
+
+// InjectSystemMessage adds a system message to the conversation, and asks the model to
+// respond to it if respond is set.
+func (s *Session) InjectSystemMessage(text string, respond bool) error {
+	if s.State() != SessionActive {
+		return ErrSessionNotActive
+	}
+	if err := s.AIClient.writeJSON(systemMessageItem(text)); err != nil {
+		return err
+	}
+	if !respond {
+		return nil
+	}
+	return s.AIClient.writeJSON(ResponseCreateEvent{
+		Type: MsgTypeResponseCreate,
+		Response: map[string]interface{}{
+			"modalities": []string{"audio", "text"},
+		},
+	})
+}
+
+// toAI routes a message from the browser to the AI client.
+func (s *Session) toAI(message types.Message) bool {
+	if !s.route(s.AIClient.Send, "ai", message) {
+		return false
+	}
+	s.count(func(usage *SessionUsage) { usage.MessagesIn++ })
+	return true
+}
+
+// toClient routes a message from the AI client to the browser.
+func (s *Session) toClient(message types.Message) bool {
+	if !s.route(s.Client.Send, "client", message) {
+		return false
+	}
+	s.count(func(usage *SessionUsage) { usage.MessagesOut++ })
+	return true
+}
+
+// route hands a message to a write pump without blocking, evicting the session if
+// the pump is too far behind. It reports whether the message was queued.
+func (s *Session) route(send chan types.Message, side string, message types.Message) bool {
+	if s.ctx.Err() != nil {
+		metrics.DroppedMessages.WithLabelValues("closed").Inc()
+		return false
+	}
+	metrics.SendQueueDepth.WithLabelValues(side).Observe(float64(len(send)))
+	span := s.turns.startSpan("hub.route", attribute.String("side", side), attribute.Int("queued", len(send)))
+	defer span.End()
+	select {
+	case send <- message:
+		return true
+	default:
+		metrics.DroppedMessages.WithLabelValues("full").Inc()
+		span.SetAttributes(attribute.Bool("dropped", true))
+		s.Logger.Warn("Evicting session, send channel full", "side", side, "queued", len(send))
+		s.Hub.observe(HubEventEvict, s)
+		s.Close()
+		return false
+	}
+}
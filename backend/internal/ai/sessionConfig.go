@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Constants for session configuration event types.
+const (
+	// MsgTypeSessionConfigure is sent by the browser to change the voice, temperature
+	// or turn detection of its session.
+	MsgTypeSessionConfigure = "session.configure"
+	// MsgTypeSessionConfigureError rejects a session.configure; nothing is changed.
+	MsgTypeSessionConfigureError = "session.configure.error"
+
+	// TurnDetectionNone turns voice activity detection off, so turns end only when
+	// the browser commits the audio buffer (push-to-talk).
+	TurnDetectionNone = "none"
+)
+
+// Voices are the voices a session may use.
+var Voices = []string{"alloy", "ash", "ballad", "coral", "echo", "sage", "shimmer", "verse"}
+
+// Bounds of the settings a browser may choose with session.configure.
+const (
+	MinTemperature       = 0.6
+	MaxTemperature       = 1.2
+	MaxPrefixPaddingMs   = 2000
+	MinSilenceDurationMs = 100
+	MaxSilenceDurationMs = 5000
+)
+
+// SessionOptions are the fields of a session.configure event. Fields left out keep
+// their current values.
+type SessionOptions struct {
+	Voice         string                `json:"voice,omitempty"`
+	Temperature   *float64              `json:"temperature,omitempty"`
+	TurnDetection *TurnDetectionOptions `json:"turn_detection,omitempty"`
+}
+
+// TurnDetectionOptions choose server_vad, with optional tuning, or none for push-to-talk.
+type TurnDetectionOptions struct {
+	Type              string   `json:"type"`
+	Threshold         *float64 `json:"threshold,omitempty"`
+	PrefixPaddingMs   *int     `json:"prefix_padding_ms,omitempty"`
+	SilenceDurationMs *int     `json:"silence_duration_ms,omitempty"`
+}
+
+// SessionConfigureErrorEvent reports why a session.configure was rejected.
+type SessionConfigureErrorEvent struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// sessionSettings are the settings of a session the browser may change.
+type sessionSettings struct {
+	Voice         string
+	Temperature   float64
+	TurnDetection TurnDetection
+}
+
+// newSessionSettings returns the settings a session starts with under config.
+func newSessionSettings(config *Config) sessionSettings {
+	settings := sessionSettings{Voice: DefaultVoice, Temperature: DefaultTemperature, TurnDetection: TurnDetection{Type: TurnDetectionVAD}}
+	if config == nil {
+		return settings
+	}
+	if config.Voice != "" {
+		settings.Voice = config.Voice
+	}
+	if config.Temperature != 0 {
+		settings.Temperature = config.Temperature
+	}
+	settings.TurnDetection = config.TurnDetection
+	if settings.TurnDetection.Type == "" {
+		settings.TurnDetection.Type = TurnDetectionVAD
+	}
+	return settings
+}
+
+// apply returns settings with options applied, or every reason options are out of bounds.
+func (options SessionOptions) apply(settings sessionSettings) (sessionSettings, error) {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if options.Voice != "" {
+		check(slices.Contains(Voices, options.Voice), "voice must be one of %v, got %q", Voices, options.Voice)
+		settings.Voice = options.Voice
+	}
+	if t := options.Temperature; t != nil {
+		check(*t >= MinTemperature && *t <= MaxTemperature, "temperature must be between %v and %v, got %v", MinTemperature, MaxTemperature, *t)
+		settings.Temperature = *t
+	}
+	if vad := options.TurnDetection; vad != nil {
+		switch vad.Type {
+		case TurnDetectionNone:
+			check(vad.Threshold == nil && vad.PrefixPaddingMs == nil && vad.SilenceDurationMs == nil,
+				"turn_detection none takes no threshold, prefix_padding_ms or silence_duration_ms")
+			settings.TurnDetection = TurnDetection{Type: TurnDetectionNone}
+		case TurnDetectionVAD:
+			// switching back from push-to-talk starts from the upstream's defaults
+			if settings.TurnDetection.Type != TurnDetectionVAD {
+				settings.TurnDetection = TurnDetection{Type: TurnDetectionVAD}
+			}
+			if t := vad.Threshold; t != nil {
+				check(*t > 0 && *t <= 1, "turn_detection.threshold must be above 0 and at most 1, got %v", *t)
+				settings.TurnDetection.Threshold = t
+			}
+			if ms := vad.PrefixPaddingMs; ms != nil {
+				check(*ms >= 0 && *ms <= MaxPrefixPaddingMs, "turn_detection.prefix_padding_ms must be between 0 and %d, got %d", MaxPrefixPaddingMs, *ms)
+				settings.TurnDetection.PrefixPaddingMs = ms
+			}
+			if ms := vad.SilenceDurationMs; ms != nil {
+				check(*ms >= MinSilenceDurationMs && *ms <= MaxSilenceDurationMs,
+					"turn_detection.silence_duration_ms must be between %d and %d, got %d", MinSilenceDurationMs, MaxSilenceDurationMs, *ms)
+				settings.TurnDetection.SilenceDurationMs = ms
+			}
+		default:
+			check(false, "turn_detection.type must be %s or %s, got %q", TurnDetectionVAD, TurnDetectionNone, vad.Type)
+		}
+	}
+	return settings, errors.Join(errs...)
+}
+
+// event returns the session.update fields of the settings.
+func (settings sessionSettings) event() map[string]interface{} {
+	return map[string]interface{}{
+		"voice":          settings.Voice,
+		"temperature":    settings.Temperature,
+		"turn_detection": settings.TurnDetection.event(),
+	}
+}
+
+// sessionSettings returns the current settings of the session.
+func (c *AIClient) sessionSettings() sessionSettings {
+	c.settingsOnce.Do(func() {
+		c.settings = newSessionSettings(c.Config)
+	})
+	return c.settings
+}
+
+// handleSessionConfigure validates a session.configure from the browser and sends
+// the resulting settings upstream as a session.update. The upstream's
+// session.updated confirms it to the browser.
+func handleSessionConfigure(c *AIClient, incomingMsg IncomingMessage) error {
+	if incomingMsg.Session == nil {
+		sendToClient(c, SessionConfigureErrorEvent{Type: MsgTypeSessionConfigureError, Error: "session is required"})
+		return nil
+	}
+	settings, err := incomingMsg.Session.apply(c.sessionSettings())
+	if err != nil {
+		c.logger().Warn("Rejected session configuration", "error", err)
+		sendToClient(c, SessionConfigureErrorEvent{Type: MsgTypeSessionConfigureError, Error: err.Error()})
+		return nil
+	}
+
+	if err := c.writeJSON(SessionUpdateEvent{Type: MsgTypeSessionUpdate, Session: settings.event()}); err != nil {
+		return err
+	}
+	c.settings = settings
+	if settings.TurnDetection.Type != TurnDetectionNone {
+		c.ptt = pushToTalk{}
+	}
+	c.updateGateHangover()
+	c.logger().Info("Session configured", "voice", settings.Voice, "temperature", settings.Temperature, "turn_detection", settings.TurnDetection.Type)
+	return nil
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ref returns a pointer to v.
+func ref[T any](v T) *T {
+	return &v
+}
+
+func TestSessionOptionsApply(t *testing.T) {
+	start := newSessionSettings(&Config{Voice: "verse", TurnDetection: TurnDetection{Threshold: ref(0.5)}})
+
+	for _, test := range []struct {
+		name    string
+		options string
+		want    sessionSettings
+		errors  []string
+	}{
+		{
+			name:    "partial update keeps the rest",
+			options: `{"temperature": 1.0, "turn_detection": {"type": "server_vad", "silence_duration_ms": 800}}`,
+			want:    sessionSettings{Voice: "verse", Temperature: 1.0, TurnDetection: TurnDetection{Type: TurnDetectionVAD, Threshold: ref(0.5), SilenceDurationMs: ref(800)}},
+		},
+		{
+			name:    "explicit zero",
+			options: `{"turn_detection": {"type": "server_vad", "prefix_padding_ms": 0}}`,
+			want:    sessionSettings{Voice: "verse", Temperature: DefaultTemperature, TurnDetection: TurnDetection{Type: TurnDetectionVAD, Threshold: ref(0.5), PrefixPaddingMs: ref(0)}},
+		},
+		{
+			name:    "push-to-talk",
+			options: `{"voice": "sage", "turn_detection": {"type": "none"}}`,
+			want:    sessionSettings{Voice: "sage", Temperature: DefaultTemperature, TurnDetection: TurnDetection{Type: TurnDetectionNone}},
+		},
+		{
+			name:    "out of bounds",
+			options: `{"voice": "robot", "temperature": 2, "turn_detection": {"type": "server_vad", "threshold": 0, "prefix_padding_ms": -1, "silence_duration_ms": 10}}`,
+			errors:  []string{"voice", "temperature", "threshold", "prefix_padding_ms", "silence_duration_ms"},
+		},
+		{
+			name:    "unknown turn detection",
+			options: `{"turn_detection": {"type": "semantic"}}`,
+			errors:  []string{"turn_detection.type"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var options SessionOptions
+			if err := json.Unmarshal([]byte(test.options), &options); err != nil {
+				t.Fatal(err)
+			}
+			got, err := options.apply(start)
+			if len(test.errors) == 0 {
+				if err != nil {
+					t.Fatalf("apply() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, test.want) {
+					t.Errorf("apply() = %+v, want %+v", got, test.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("apply() accepted out of bounds options")
+			}
+			for _, want := range test.errors {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionSettingsEvent(t *testing.T) {
+	data, err := json.Marshal(sessionSettings{Voice: "sage", Temperature: 0.9, TurnDetection: TurnDetection{Type: TurnDetectionNone}}.event())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"temperature":0.9,"turn_detection":null,"voice":"sage"}`; string(data) != want {
+		t.Errorf("event = %s, want %s", data, want)
+	}
+
+	// an explicit zero is sent, unset fields are left to the upstream
+	data, err = json.Marshal(sessionSettings{Voice: "sage", Temperature: 0.9, TurnDetection: TurnDetection{Type: TurnDetectionVAD, PrefixPaddingMs: ref(0)}}.event())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"temperature":0.9,"turn_detection":{"prefix_padding_ms":0,"type":"server_vad"},"voice":"sage"}`; string(data) != want {
+		t.Errorf("event = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"encoding/json"
+	"time"
+
+	"interviews-ai/internal/ai/types"
+)
+
+// Constants for the events telling the browser the server refused or ended its session.
+const (
+	// MsgTypeSessionRejected is sent instead of connecting a session that is over a
+	// limit, just before the connection is closed.
+	MsgTypeSessionRejected = "session.rejected"
+	// MsgTypeSessionEnded is sent when the server ends a session, before it is closed.
+	MsgTypeSessionEnded = "session.ended"
+
+	// SessionEndMaxDuration ends a session that ran for Config.MaxSessionDuration.
+	SessionEndMaxDuration = "max_duration"
+)
+
+// SessionRejectedEvent tells the browser why its session was refused.
+type SessionRejectedEvent struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+	// RetryAfterMs is how long until a new attempt may succeed, when known.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+// SessionEndedEvent tells the browser why the server ended its session.
+type SessionEndedEvent struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// End tells the browser why its session is ending, and closes it. It does nothing
+// once the session is closing.
+func (s *Session) End(reason string) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	data, err := json.Marshal(SessionEndedEvent{Type: MsgTypeSessionEnded, Reason: reason})
+	if err != nil {
+		s.Logger.Error("Failed to marshal session.ended", "error", err)
+	} else {
+		s.toClient(types.Message{
+			SenderID:   s.AIClient.AiClientId,
+			Payload:    data,
+			ReceiverID: s.Client.ClientId,
+			Type:       types.TextMessage,
+		})
+	}
+	s.Logger.Info("Ending session", "reason", reason)
+	s.Close()
+}
+
+// startDeadline ends the session once it has run for Config.MaxSessionDuration.
+func (s *Session) startDeadline() {
+	config := s.AIClient.Config
+	if config == nil || config.MaxSessionDuration <= 0 {
+		return
+	}
+	s.deadline = time.AfterFunc(config.MaxSessionDuration, func() {
+		s.End(SessionEndMaxDuration)
+	})
+}
@@ -0,0 +1,230 @@
+package ai
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai/types"
+
+	"github.com/gorilla/websocket"
+)
+
+const sessionTimeout = 2 * time.Second
+
+// closedWithin fails the test unless the session starts closing in time.
+func closedWithin(t *testing.T, session *Session) {
+	t.Helper()
+	select {
+	case <-session.Context().Done():
+	case <-time.After(sessionTimeout):
+		t.Fatalf("session %s was not closed", session.Client.ClientId)
+	}
+}
+
+func TestSessionEvictsWhenPeerFallsBehind(t *testing.T) {
+	hub := NewHub()
+	var mu sync.Mutex
+	var evicted []string
+	hub.Observer = func(event HubEvent) {
+		if event.Kind == HubEventEvict {
+			mu.Lock()
+			evicted = append(evicted, event.ClientId)
+			mu.Unlock()
+		}
+	}
+
+	slow := testSession(hub, "slow", 1)
+	fast := testSession(hub, "fast", 1)
+	hub.Register(slow)
+	hub.Register(fast)
+
+	// the second message overflows the slow AI client's Send channel
+	if !slow.toAI(types.Message{}) {
+		t.Fatal("first message was not queued")
+	}
+	if slow.toAI(types.Message{}) {
+		t.Fatal("message was queued past a full Send channel")
+	}
+	closedWithin(t, slow)
+	if slow.toClient(types.Message{}) {
+		t.Error("message was routed to a closed session")
+	}
+
+	// other sessions are unaffected
+	if !fast.toAI(types.Message{}) || !fast.toClient(types.Message{}) {
+		t.Fatal("healthy session did not route")
+	}
+	if fast.Context().Err() != nil {
+		t.Error("healthy session was closed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evicted) != 1 || evicted[0] != slow.Client.ClientId {
+		t.Errorf("evicted = %v, want only %s", evicted, slow.Client.ClientId)
+	}
+}
+
+func TestSessionCloseIsIdempotent(t *testing.T) {
+	var nilSession *Session
+	nilSession.Close()
+
+	session := testSession(NewHub(), "a", 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session.Close()
+		}()
+	}
+	wg.Wait()
+	closedWithin(t, session)
+}
+
+// recordingConn is an upstream connection that keeps the messages written to it.
+type recordingConn struct {
+	mu      sync.Mutex
+	written []int
+	events  []string
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) { select {} }
+func (c *recordingConn) SetWriteDeadline(time.Time) error  { return nil }
+func (c *recordingConn) Close() error                      { return nil }
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var event struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &event)
+	c.written = append(c.written, messageType)
+	c.events = append(c.events, event.Type)
+	return nil
+}
+
+func TestAIWritePumpDrainsOnStop(t *testing.T) {
+	session := testSession(NewHub(), "a", 2)
+	conn := &recordingConn{}
+	session.AIClient.Conn = conn
+
+	// what the browser sent before the session stopped still goes upstream
+	session.AIClient.Send <- types.Message{Payload: []byte(`{"type":"response.create","response":{}}`)}
+	close(session.stop)
+	session.AIClient.AiClientWritePump()
+
+	if want := []string{"response.create", ""}; !reflect.DeepEqual(conn.events, want) {
+		t.Errorf("upstream received %v, want %v", conn.events, want)
+	}
+	if last := conn.written[len(conn.written)-1]; last != websocket.CloseMessage {
+		t.Errorf("last message type = %d, want a close frame", last)
+	}
+}
+
+// BenchmarkRouting measures browser to AI routing with every session sending at once,
+// reporting throughput and p99 latency from routing to the write pump receiving it.
+// The central variant funnels every message through one goroutine, as a single
+// shared hub would, for comparison.
+func BenchmarkRouting(b *testing.B) {
+	for _, sessions := range []int{1000, 5000} {
+		b.Run(fmt.Sprintf("direct/sessions=%d", sessions), func(b *testing.B) {
+			benchmarkRouting(b, sessions, func(s *Session, message types.Message) bool {
+				return s.toAI(message)
+			})
+		})
+		b.Run(fmt.Sprintf("central/sessions=%d", sessions), func(b *testing.B) {
+			funnel := make(chan func())
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				for {
+					select {
+					case route := <-funnel:
+						route()
+					case <-done:
+						return
+					}
+				}
+			}()
+			benchmarkRouting(b, sessions, func(s *Session, message types.Message) bool {
+				funnel <- func() { s.toAI(message) }
+				return true
+			})
+		})
+	}
+}
+
+// benchmarkRouting sends b.N messages spread over the given number of sessions.
+func benchmarkRouting(b *testing.B, sessions int, route func(*Session, types.Message) bool) {
+	// each producer keeps at most window messages in flight so no session is evicted
+	const window = 64
+	perSession := max(b.N/sessions, 1)
+	latencies := make([][]time.Duration, sessions)
+
+	hub := NewHub()
+	all := make([]*Session, sessions)
+	for i := range all {
+		all[i] = testSession(hub, fmt.Sprint(i), window)
+		hub.Register(all[i])
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, s := range all {
+		credits := make(chan struct{}, window)
+		for j := 0; j < window; j++ {
+			credits <- struct{}{}
+		}
+
+		// the AI write pump
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			samples := make([]time.Duration, 0, perSession)
+			for j := 0; j < perSession; j++ {
+				message := <-s.AIClient.Send
+				sent := int64(binary.LittleEndian.Uint64(message.Payload))
+				samples = append(samples, time.Duration(time.Now().UnixNano()-sent))
+				credits <- struct{}{}
+			}
+			latencies[i] = samples
+		}()
+
+		// the browser read pump
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSession; j++ {
+				<-credits
+				payload := make([]byte, 8)
+				binary.LittleEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+				if !route(s, types.Message{Payload: payload}) {
+					b.Error("session was evicted")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	var merged []time.Duration
+	for _, samples := range latencies {
+		merged = append(merged, samples...)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+	if len(merged) > 0 {
+		b.ReportMetric(float64(merged[len(merged)*99/100].Microseconds()), "p99-µs")
+	}
+	b.ReportMetric(float64(len(merged))/elapsed.Seconds(), "msgs/s")
+}
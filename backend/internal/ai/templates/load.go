@@ -0,0 +1,59 @@
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Extensions are the file extensions read as templates by Load.
+var Extensions = []string{".md", ".txt"}
+
+// Load returns the built-in templates overlaid with the files in dir, each named
+// after its file without the extension. An empty dir returns the built-ins.
+func Load(dir string) (map[string]string, error) {
+	loaded := make(map[string]string, len(Instructions))
+	for name, instructions := range Instructions {
+		loaded[name] = instructions
+	}
+	if dir == "" {
+		return loaded, nil
+	}
+
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read template: %v", err)
+		}
+		instructions := strings.TrimSpace(string(data))
+		if instructions == "" {
+			return nil, fmt.Errorf("template %s is empty", path)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		loaded[name] = instructions
+	}
+	return loaded, nil
+}
+
+// Files lists the template files in dir.
+func Files(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read template dir: %v", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !slices.Contains(Extensions, ext) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
@@ -22,7 +22,7 @@ In this mock interview, we will cover topics such as:
    Questions designed to evaluate your knowledge of full-stack technologies, tools, and frameworks. Sample areas may include modern JavaScript, React, Node.js, backend strategies, REST/GraphQL API design, and cloud services.
 
 2. **Coding**:  
-   Problem-solving exercises in algorithms and data structures, asked in a clear textual format. You will need to write pseudocode or explain your approach step-by-step.
+   Problem-solving exercises in algorithms and data structures, asked in a clear textual format. You will need to write pseudocode or explain your approach step-by-step. When the candidate writes runnable code in Go, Python or JavaScript and the run_code tool is available, run it with a few test cases and discuss the results.
 
 3. **Behavioral**:  
    Open-ended questions to assess your soft skills, leadership, adaptability, and technical communication ability.
@@ -57,4 +57,12 @@ In this mock interview, we will cover topics such as:
 [Strengths and areas for improvement with examples on delivering clear, concise responses.]
 
 #### Overall Comments:  
-[Summary of performance and actionable tips to improve for real-life interviews.]`
\ No newline at end of file
+[Summary of performance and actionable tips to improve for real-life interviews.]`
+
+// DefaultTemplate is used when a session does not ask for a template.
+const DefaultTemplate = "interview"
+
+// Instructions maps template names to the instructions given to the model.
+var Instructions = map[string]string{
+	DefaultTemplate: InterviewInstructions,
+}
@@ -0,0 +1,190 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxTestCases = 10
+
+// replyMargin is kept from the tool's timeout to report the results.
+const replyMargin = 500 * time.Millisecond
+
+// TestCase is a single input/expected output pair to check the program against.
+type TestCase struct {
+	Name           string `json:"name,omitempty"`
+	Stdin          string `json:"stdin,omitempty"`
+	ExpectedStdout string `json:"expected_stdout"`
+}
+
+type runCodeArgs struct {
+	Language string     `json:"language"`
+	Code     string     `json:"code"`
+	Stdin    string     `json:"stdin,omitempty"`
+	Tests    []TestCase `json:"tests,omitempty"`
+}
+
+type testResult struct {
+	Name   string  `json:"name"`
+	Passed bool    `json:"passed"`
+	Result *Result `json:"result"`
+}
+
+type runCodeOutput struct {
+	Language string       `json:"language"`
+	Error    string       `json:"error,omitempty"`
+	Run      *Result      `json:"run,omitempty"`
+	Tests    []testResult `json:"tests,omitempty"`
+	Passed   int          `json:"passed"`
+	Failed   int          `json:"failed"`
+}
+
+// RunCodeTool lets the interviewer execute the candidate's code in the sandbox.
+type RunCodeTool struct {
+	Runtimes map[string]*Runtime
+	Limits   Limits
+}
+
+// NewRunCodeTool returns a run_code tool for the runtimes installed on this host.
+func NewRunCodeTool(limits Limits) (*RunCodeTool, error) {
+	if err := Available(); err != nil {
+		return nil, fmt.Errorf("sandbox unavailable: %v", err)
+	}
+	runtimes := DetectRuntimes()
+	if len(runtimes) == 0 {
+		return nil, fmt.Errorf("no supported language toolchains found")
+	}
+	return &RunCodeTool{Runtimes: runtimes, Limits: limits}, nil
+}
+
+func (t *RunCodeTool) Name() string {
+	return "run_code"
+}
+
+func (t *RunCodeTool) Description() string {
+	return "Run the candidate's code in an isolated sandbox without network access and return stdout, stderr and test case results. " +
+		"Use it to check a coding answer once the candidate has finished writing it. Supported languages: " +
+		strings.Join(t.languages(), ", ") + "."
+}
+
+func (t *RunCodeTool) Parameters() json.RawMessage {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"language": map[string]interface{}{
+				"type": "string",
+				"enum": t.languages(),
+			},
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "Complete program source. It should read input from stdin and print results to stdout.",
+			},
+			"stdin": map[string]interface{}{
+				"type":        "string",
+				"description": "Input for a single run when no tests are given.",
+			},
+			"tests": map[string]interface{}{
+				"type":     "array",
+				"maxItems": maxTestCases,
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":            map[string]interface{}{"type": "string"},
+						"stdin":           map[string]interface{}{"type": "string"},
+						"expected_stdout": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"expected_stdout"},
+				},
+			},
+		},
+		"required": []string{"language", "code"},
+	}
+	data, _ := json.Marshal(schema)
+	return data
+}
+
+func (t *RunCodeTool) Invoke(ctx context.Context, rawArgs json.RawMessage) (string, error) {
+	var args runCodeArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	runtime, ok := t.Runtimes[strings.ToLower(args.Language)]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q, expected one of: %s", args.Language, strings.Join(t.languages(), ", "))
+	}
+	if len(args.Tests) > maxTestCases {
+		args.Tests = args.Tests[:maxTestCases]
+	}
+
+	output := runCodeOutput{Language: runtime.Language}
+
+	dir, command, cleanup, err := runtime.Prepare(ctx, args.Code, t.Limits)
+	if err != nil {
+		// compilation errors are reported to the model rather than treated as tool failures
+		output.Error = err.Error()
+		return marshalOutput(output)
+	}
+	defer cleanup()
+
+	if len(args.Tests) == 0 {
+		result, err := Run(ctx, dir, command, args.Stdin, t.runLimits(ctx, 1))
+		if err != nil {
+			return "", err
+		}
+		output.Run = result
+		return marshalOutput(output)
+	}
+
+	for i, test := range args.Tests {
+		result, err := Run(ctx, dir, command, test.Stdin, t.runLimits(ctx, len(args.Tests)-i))
+		if err != nil {
+			return "", err
+		}
+		name := test.Name
+		if name == "" {
+			name = fmt.Sprintf("test %d", i+1)
+		}
+		passed := result.ExitCode == 0 && !result.TimedOut &&
+			strings.TrimSpace(result.Stdout) == strings.TrimSpace(test.ExpectedStdout)
+		if passed {
+			output.Passed++
+		} else {
+			output.Failed++
+		}
+		output.Tests = append(output.Tests, testResult{Name: name, Passed: passed, Result: result})
+	}
+	return marshalOutput(output)
+}
+
+// runLimits returns the limits of the next of runs left. The runs share what is
+// left of the tool's timeout, so a slow program cannot make the tool time out
+// before it reports the tests that ran.
+func (t *RunCodeTool) runLimits(ctx context.Context, runs int) Limits {
+	limits := t.Limits
+	if deadline, ok := ctx.Deadline(); ok {
+		limits.Timeout = min(limits.Timeout, (time.Until(deadline)-replyMargin)/time.Duration(runs))
+	}
+	return limits
+}
+
+func (t *RunCodeTool) languages() []string {
+	languages := make([]string, 0, len(t.Runtimes))
+	for language := range t.Runtimes {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+func marshalOutput(output runCodeOutput) (string, error) {
+	data, err := json.Marshal(output)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
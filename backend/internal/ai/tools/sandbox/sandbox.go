@@ -0,0 +1,242 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Limits bounds the resources a single program run may use.
+type Limits struct {
+	// Timeout is the wall clock limit for a single run.
+	Timeout time.Duration
+	// CPUSeconds is the CPU time limit for a single run.
+	CPUSeconds int
+	// MemoryBytes caps the address space of the program.
+	MemoryBytes int64
+	// Processes caps the processes and threads the program may run at once.
+	Processes int
+	// MaxOutputBytes truncates stdout and stderr.
+	MaxOutputBytes int
+	// CompileTimeout bounds compilation for compiled languages.
+	CompileTimeout time.Duration
+}
+
+var DefaultLimits = Limits{
+	Timeout:        5 * time.Second,
+	CPUSeconds:     5,
+	MemoryBytes:    1 << 30,
+	Processes:      64,
+	MaxOutputBytes: 16 * 1024,
+	CompileTimeout: 20 * time.Second,
+}
+
+// Runtime describes how to build and run a program in one language.
+type Runtime struct {
+	Language string
+	FileName string
+	// Compile, if set, builds the source in dir and returns the command line to run.
+	Compile func(ctx context.Context, dir string) ([]string, error)
+	// Command is the command line used to run interpreted programs.
+	Command []string
+}
+
+// Result is the outcome of a single run.
+type Result struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Duration int64  `json:"duration_ms"`
+}
+
+var ErrUnsupported = errors.New("sandboxed execution is not supported on this platform")
+
+// DetectRuntimes returns the runtimes whose toolchains are installed on this host.
+func DetectRuntimes() map[string]*Runtime {
+	runtimes := make(map[string]*Runtime)
+
+	if goBin, err := exec.LookPath("go"); err == nil {
+		// compiling runs none of the candidate's code, so it shares the service's build cache
+		cache := ""
+		if out, err := exec.Command(goBin, "env", "GOCACHE").Output(); err == nil {
+			cache = strings.TrimSpace(string(out))
+		}
+		runtimes["go"] = &Runtime{
+			Language: "go",
+			FileName: "main.go",
+			Compile: func(ctx context.Context, dir string) ([]string, error) {
+				cmd := exec.CommandContext(ctx, goBin, "build", "-o", "prog", "main.go")
+				cmd.Dir = dir
+				cmd.Env = compileEnv(dir, cache)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					if ctx.Err() != nil {
+						return nil, fmt.Errorf("compilation timed out")
+					}
+					return nil, fmt.Errorf("compilation failed: %s", strings.TrimSpace(string(out)))
+				}
+				return []string{filepath.Join(dir, "prog")}, nil
+			},
+		}
+	}
+
+	for _, name := range []string{"python3", "python"} {
+		if bin, err := exec.LookPath(name); err == nil {
+			runtimes["python"] = &Runtime{Language: "python", FileName: "main.py", Command: []string{pythonExecutable(bin), "main.py"}}
+			break
+		}
+	}
+
+	if bin, err := exec.LookPath("node"); err == nil {
+		runtimes["javascript"] = &Runtime{Language: "javascript", FileName: "main.js", Command: []string{bin, "main.js"}}
+	}
+
+	return runtimes
+}
+
+// pythonExecutable returns the interpreter bin runs, which differs when bin is a
+// shim such as pyenv's; the sandbox only has the interpreter's own install.
+func pythonExecutable(bin string) string {
+	out, err := exec.Command(bin, "-c", "import sys; print(sys.executable)").Output()
+	if executable := strings.TrimSpace(string(out)); err == nil && filepath.IsAbs(executable) {
+		return executable
+	}
+	return bin
+}
+
+// compileEnv is the environment of compilers. It has none of the service's
+// variables, so no secrets; cache is the Go build cache, in dir if empty.
+func compileEnv(dir, cache string) []string {
+	if cache == "" {
+		cache = filepath.Join(dir, ".cache")
+	}
+	return []string{
+		"PATH=" + sandboxPath,
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"GOCACHE=" + cache,
+		"GOPATH=" + filepath.Join(dir, "go"),
+		"GOENV=off",
+		"GOTOOLCHAIN=local",
+		"GOPROXY=off",
+		"CGO_ENABLED=0",
+	}
+}
+
+// sandboxPath is the PATH of compilers and programs.
+const sandboxPath = "/usr/local/bin:/usr/bin:/bin"
+
+// Prepare writes the source into a fresh directory and compiles it if needed.
+// The returned cleanup func removes the directory.
+func (rt *Runtime) Prepare(ctx context.Context, code string, limits Limits) (dir string, command []string, cleanup func(), err error) {
+	dir, err = os.MkdirTemp("", "run-code-*")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	if err := os.WriteFile(filepath.Join(dir, rt.FileName), []byte(code), 0o644); err != nil {
+		cleanup()
+		return "", nil, nil, err
+	}
+
+	if rt.Compile == nil {
+		return dir, rt.Command, cleanup, nil
+	}
+
+	compileCtx, cancel := context.WithTimeout(ctx, limits.CompileTimeout)
+	defer cancel()
+	command, err = rt.Compile(compileCtx, dir)
+	if err != nil {
+		cleanup()
+		return "", nil, nil, err
+	}
+	return dir, command, cleanup, nil
+}
+
+// Run executes command inside dir with the sandbox restrictions of the host platform.
+func Run(ctx context.Context, dir string, command []string, stdin string, limits Limits) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	cmd, cleanup, err := isolate(ctx, dir, command, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + sandboxPath, "HOME=" + dir, "TMPDIR=" + dir, "LANG=C.UTF-8"}
+	cmd.Stdin = strings.NewReader(stdin)
+
+	stdout := &limitedBuffer{limit: limits.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: limits.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	result := &Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start).Milliseconds(),
+		TimedOut: ctx.Err() == context.DeadlineExceeded,
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case result.TimedOut:
+		result.ExitCode = -1
+	default:
+		return nil, err
+	}
+	return result, nil
+}
+
+// Available reports whether programs can be run in the sandbox on this host.
+func Available() error {
+	dir, err := os.MkdirTemp("", "run-code-probe-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = Run(context.Background(), dir, []string{"/bin/true"}, "", DefaultLimits)
+	return err
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = true
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
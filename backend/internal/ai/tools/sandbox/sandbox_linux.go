@@ -0,0 +1,265 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// initArg marks the service binary re-executed to set up the sandbox; it then
+// becomes the program.
+const initArg = "run-code-sandbox-init"
+
+// systemPaths are mounted read-only in every sandbox, for the interpreters and
+// their shared libraries.
+var systemPaths = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32"}
+
+// nobody is who the program runs as when the service runs as root. RLIMIT_NPROC
+// does not apply to root, and the program must not own the host's files.
+const nobody = 65534
+
+// devices are bound into the sandbox's /dev.
+var devices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// initConfig is what the re-executed binary needs to set up the sandbox.
+type initConfig struct {
+	Root        string   `json:"root"`
+	Dir         string   `json:"dir"`
+	Paths       []string `json:"paths"`
+	CPUSeconds  int      `json:"cpu_seconds"`
+	MemoryBytes int64    `json:"memory_bytes"`
+	Processes   int      `json:"processes"`
+}
+
+func init() {
+	if len(os.Args) < 3 || os.Args[0] != initArg {
+		return
+	}
+	var config initConfig
+	err := json.Unmarshal([]byte(os.Args[1]), &config)
+	if err == nil {
+		err = enter(config, os.Args[2:])
+	}
+	// enter only returns if the program could not be started
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// isolate returns a command that runs the program in new user, mount, network and
+// PID namespaces. It sees only the system directories, read-only, and its work dir;
+// it has no network access and no privileges, and the whole namespace is killed when
+// the run is cancelled.
+func isolate(ctx context.Context, dir string, command []string, limits Limits) (*exec.Cmd, func(), error) {
+	root, err := os.MkdirTemp("", "run-code-root-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	uids := []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	gids := []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	if os.Getuid() == 0 {
+		// host root is mapped too, so the setup may read root's dirs, such as a
+		// pyenv install; the program has no capabilities to act as it
+		uids = []syscall.SysProcIDMap{{ContainerID: 0, HostID: nobody, Size: 1}, {ContainerID: 1, HostID: 0, Size: 1}}
+		gids = []syscall.SysProcIDMap{{ContainerID: 0, HostID: nobody, Size: 1}, {ContainerID: 1, HostID: 0, Size: 1}}
+		for _, path := range []string{root, dir} {
+			if err := os.Chown(path, nobody, nobody); err != nil {
+				os.Remove(root)
+				return nil, nil, err
+			}
+		}
+	}
+	cleanup := func() { os.Remove(root) }
+	config, err := json.Marshal(initConfig{
+		Root:        root,
+		Dir:         dir,
+		Paths:       installPaths(command[0]),
+		CPUSeconds:  limits.CPUSeconds,
+		MemoryBytes: limits.MemoryBytes,
+		Processes:   limits.Processes,
+	})
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = append([]string{initArg, string(config)}, command...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID,
+		UidMappings: uids,
+		GidMappings: gids,
+		// become root of the namespace, which is who the maps say, not the service's uid
+		Credential: &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true},
+		Setpgid:    true,
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd, cleanup, nil
+}
+
+// installPaths returns the install prefix of an interpreter outside the system
+// directories, such as a pyenv or nvm install, so it can be mounted too.
+func installPaths(program string) []string {
+	resolved, err := filepath.EvalSymlinks(program)
+	if err != nil {
+		return nil
+	}
+	// <prefix>/bin/<interpreter>
+	prefix := filepath.Dir(filepath.Dir(resolved))
+	if prefix == "/" {
+		return nil
+	}
+	for _, system := range systemPaths {
+		if prefix == system || strings.HasPrefix(prefix, system+"/") {
+			return nil
+		}
+	}
+	return []string{prefix}
+}
+
+// enter runs in the re-executed binary. It builds the sandbox's root from read-only
+// bind mounts, pivots into it, applies the limits, drops every capability and
+// executes the program.
+func enter(config initConfig, command []string) error {
+	// nothing mounted here may propagate back to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %v", err)
+	}
+	root := config.Root
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=1m,mode=755"); err != nil {
+		return fmt.Errorf("mount root: %v", err)
+	}
+
+	for _, path := range systemPaths {
+		info, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// on merged /usr systems, /bin and the like are symlinks into /usr
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err == nil {
+				err = os.Symlink(link, filepath.Join(root, path))
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := bindReadOnly(path, filepath.Join(root, path)); err != nil {
+			return err
+		}
+	}
+	for _, path := range config.Paths {
+		if err := bindReadOnly(path, filepath.Join(root, path)); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "dev"), 0o755); err != nil {
+		return err
+	}
+	for _, device := range devices {
+		target := filepath.Join(root, device)
+		if err := os.WriteFile(target, nil, 0o666); err != nil {
+			return err
+		}
+		if err := unix.Mount(device, target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind %s: %v", device, err)
+		}
+	}
+	// the work dir keeps its path, so the command line needs no rewriting
+	workDir := filepath.Join(root, config.Dir)
+	if err := os.MkdirAll(workDir, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount(config.Dir, workDir, "", unix.MS_BIND|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("bind work dir: %v", err)
+	}
+	if err := unix.Mount("", root, "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("make root read-only: %v", err)
+	}
+
+	// unlike chroot, pivot_root leaves no way back to the host's files
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot root: %v", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %v", err)
+	}
+	if err := unix.Chdir(config.Dir); err != nil {
+		return err
+	}
+
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, uint64(config.CPUSeconds)},
+		{unix.RLIMIT_AS, uint64(config.MemoryBytes)},
+		{unix.RLIMIT_NPROC, uint64(config.Processes)},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(limit.resource, &unix.Rlimit{Cur: limit.value, Max: limit.value}); err != nil {
+			return fmt.Errorf("set limit %d: %v", limit.resource, err)
+		}
+	}
+
+	// the program runs as root of its namespace; with an empty bounding set it
+	// gets no capabilities, so it cannot undo the mounts
+	for c := 0; ; c++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("drop capability %d: %v", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %v", err)
+	}
+
+	program, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+	return unix.Exec(program, command, os.Environ())
+}
+
+// bindReadOnly mounts the directory source read-only at target.
+func bindReadOnly(source, target string) error {
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %v", source, err)
+	}
+	// a remount must keep the flags the host mount has, or a user namespace may not do it
+	var stat unix.Statfs_t
+	if err := unix.Statfs(target, &stat); err != nil {
+		return err
+	}
+	locked := uintptr(stat.Flags) & (unix.MS_NOEXEC | unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_RELATIME)
+	if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|locked, ""); err != nil {
+		return fmt.Errorf("make %s read-only: %v", source, err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+)
+
+// isolate refuses to run programs where the sandbox's namespaces are not available.
+func isolate(ctx context.Context, dir string, command []string, limits Limits) (*exec.Cmd, func(), error) {
+	return nil, nil, ErrUnsupported
+}
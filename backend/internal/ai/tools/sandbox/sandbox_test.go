@@ -0,0 +1,193 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run runs a shell script in the sandbox with limits.
+func run(t *testing.T, limits Limits, script string) *Result {
+	t.Helper()
+	return runCommand(t, limits, "/bin/sh", "-c", script)
+}
+
+func runCommand(t *testing.T, limits Limits, command ...string) *Result {
+	t.Helper()
+	if err := Available(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	result, err := Run(context.Background(), workDir(t), command, "", limits)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return result
+}
+
+// workDir returns a dir like the ones Prepare makes. Those of t.TempDir are in a
+// dir the sandbox's uid cannot enter when the tests run as root.
+func workDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "run-code-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func python(t *testing.T) string {
+	t.Helper()
+	runtime, ok := DetectRuntimes()["python"]
+	if !ok {
+		t.Skip("python is not installed")
+	}
+	return runtime.Command[0]
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("processes", func(t *testing.T) {
+		limits := DefaultLimits
+		limits.Processes = 8
+		result := run(t, limits, "for i in 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16; do sleep 1 & done; wait")
+		if result.ExitCode == 0 || !strings.Contains(result.Stderr, "fork") {
+			t.Errorf("16 processes ran under a limit of 8: %+v", result)
+		}
+	})
+
+	t.Run("cpu", func(t *testing.T) {
+		limits := DefaultLimits
+		limits.CPUSeconds, limits.Timeout = 1, 10*time.Second
+		result := run(t, limits, "while :; do :; done")
+		if result.TimedOut || result.ExitCode == 0 || result.Duration > 5000 {
+			t.Errorf("busy loop was not stopped by the CPU limit: %+v", result)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		limits := DefaultLimits
+		limits.Timeout = 200 * time.Millisecond
+		if result := run(t, limits, "sleep 10"); !result.TimedOut || result.Duration > 5000 {
+			t.Errorf("sleep was not stopped by the timeout: %+v", result)
+		}
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		bin := python(t)
+		limits := DefaultLimits
+		limits.MemoryBytes = 256 << 20
+		if result := runCommand(t, limits, bin, "-c", "b = bytearray(512 << 20)"); !strings.Contains(result.Stderr, "MemoryError") {
+			t.Errorf("512MB were allocated under a limit of 256MB: %+v", result)
+		}
+	})
+}
+
+func TestNoNetwork(t *testing.T) {
+	bin := python(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// the host's loopback is not reachable from the sandbox's network namespace
+	script := `import socket, sys
+try:
+    socket.create_connection(("127.0.0.1", ` + listener.Addr().(*net.TCPAddr).AddrPort().String()[len("127.0.0.1:"):] + `), timeout=2)
+except OSError as e:
+    print(e)
+    sys.exit(1)
+`
+	result := runCommand(t, DefaultLimits, bin, "-c", script)
+	if result.ExitCode != 1 {
+		t.Errorf("program connected to the host: %+v", result)
+	}
+}
+
+func TestFileAccess(t *testing.T) {
+	// readable by anyone, so only the sandbox keeps the program from it
+	dir := workDir(t)
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, ".env")
+	if err := os.WriteFile(secret, []byte("OPENAI_API_KEY=sk-secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+
+	for _, test := range []struct {
+		name, script string
+	}{
+		{name: "host files", script: "cat " + secret},
+		{name: "host config", script: "ls /etc /root /home"},
+		{name: "environment", script: "env | grep sk-secret"},
+		{name: "system dirs", script: "touch /usr/bin/evil"},
+		{name: "mounts", script: "mount -o remount,rw /usr"},
+	} {
+		if result := run(t, DefaultLimits, test.script); result.ExitCode == 0 || strings.Contains(result.Stdout, "sk-secret") {
+			t.Errorf("%s: the sandbox allowed %q: %+v", test.name, test.script, result)
+		}
+	}
+
+	// the work dir is writable
+	if result := run(t, DefaultLimits, "echo ok > out && cat out"); result.ExitCode != 0 || result.Stdout != "ok\n" {
+		t.Errorf("work dir is not writable: %+v", result)
+	}
+}
+
+func TestCompileEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	for _, variable := range compileEnv(t.TempDir(), "") {
+		if strings.Contains(variable, "sk-secret") {
+			t.Errorf("compile environment has %s", variable)
+		}
+	}
+}
+
+func TestRunCodeSharesTheTimeout(t *testing.T) {
+	bin := python(t)
+	if err := Available(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	tool := &RunCodeTool{
+		Runtimes: map[string]*Runtime{"python": {Language: "python", FileName: "main.py", Command: []string{bin, "main.py"}}},
+		Limits:   DefaultLimits,
+	}
+	var tests []TestCase
+	for i := 0; i < maxTestCases; i++ {
+		tests = append(tests, TestCase{ExpectedStdout: "done"})
+	}
+	args, _ := json.Marshal(runCodeArgs{Language: "python", Code: "while True: pass", Tests: tests})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	out, err := tool.Invoke(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("run_code did not answer within its timeout")
+	}
+	var output runCodeOutput
+	if err := json.Unmarshal([]byte(out), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.Failed != maxTestCases || !output.Tests[0].Result.TimedOut {
+		t.Errorf("output = %s", out)
+	}
+}
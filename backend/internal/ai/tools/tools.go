@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a single tool invocation when the registry has no explicit timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Tool is a function the model can call during a realtime session.
+type Tool interface {
+	// Name is the function name advertised to the model.
+	Name() string
+	// Description tells the model when and how to use the tool.
+	Description() string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters() json.RawMessage
+	// Invoke runs the tool with the raw JSON arguments produced by the model. It must
+	// return soon after ctx is done: the registry stops waiting at its timeout, but
+	// cannot stop a tool that ignores ctx, which then keeps running in the background.
+	Invoke(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Registry holds the tools available to a session.
+type Registry struct {
+	mu      sync.RWMutex
+	tools   map[string]Tool
+	Timeout time.Duration
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Registry{
+		tools:   make(map[string]Tool),
+		Timeout: timeout,
+	}
+}
+
+// Register adds a tool, rejecting duplicate names.
+func (r *Registry) Register(t Tool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[t.Name()]; exists {
+		return fmt.Errorf("tool %q already registered", t.Name())
+	}
+	r.tools[t.Name()] = t
+	return nil
+}
+
+func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tools)
+}
+
+// Definitions returns the tools in the shape expected by the "tools" field of session.update.
+func (r *Registry) Definitions() []map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		t := r.tools[name]
+		defs = append(defs, map[string]interface{}{
+			"type":        "function",
+			"name":        t.Name(),
+			"description": t.Description(),
+			"parameters":  t.Parameters(),
+		})
+	}
+	return defs
+}
+
+// Invoke runs the named tool bounded by the registry timeout.
+// Errors, including a panic in the tool, are returned as a JSON object so the model
+// can see what went wrong.
+func (r *Registry) Invoke(ctx context.Context, name string, args json.RawMessage) string {
+	t, ok := r.Get(name)
+	if !ok {
+		return errorOutput(fmt.Errorf("unknown tool %q", name))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- result{err: fmt.Errorf("tool %q panicked: %v", name, p)}
+			}
+		}()
+		output, err := t.Invoke(ctx, args)
+		done <- result{output, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return errorOutput(res.err)
+		}
+		return res.output
+	case <-ctx.Done():
+		return errorOutput(fmt.Errorf("tool %q timed out after %v", name, r.Timeout))
+	}
+}
+
+func errorOutput(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// funcTool is a tool that runs invoke.
+type funcTool struct {
+	name   string
+	invoke func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+func (f funcTool) Name() string                { return f.name }
+func (f funcTool) Description() string         { return "A test tool." }
+func (f funcTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+
+func (f funcTool) Invoke(ctx context.Context, args json.RawMessage) (string, error) {
+	return f.invoke(ctx, args)
+}
+
+func newTestRegistry(t *testing.T, timeout time.Duration, tools ...Tool) *Registry {
+	t.Helper()
+	r := NewRegistry(timeout)
+	for _, tool := range tools {
+		if err := r.Register(tool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+// errorMessage returns the error of an error output, or "" if output is not one.
+func errorMessage(output string) string {
+	var result struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal([]byte(output), &result)
+	return result.Error
+}
+
+func TestRegister(t *testing.T) {
+	echo := funcTool{name: "echo", invoke: func(ctx context.Context, args json.RawMessage) (string, error) {
+		return string(args), nil
+	}}
+	r := newTestRegistry(t, 0, echo)
+	if r.Timeout != DefaultTimeout {
+		t.Errorf("Timeout = %v, want %v", r.Timeout, DefaultTimeout)
+	}
+	if err := r.Register(echo); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("Register of a duplicate = %v, want an error", err)
+	}
+	if r.Len() != 1 || len(r.Definitions()) != 1 {
+		t.Errorf("Len() = %d with %d definitions, want one tool", r.Len(), len(r.Definitions()))
+	}
+	if output := r.Invoke(context.Background(), "echo", json.RawMessage(`{"n":1}`)); output != `{"n":1}` {
+		t.Errorf("Invoke = %s", output)
+	}
+}
+
+func TestInvokeUnknownTool(t *testing.T) {
+	output := newTestRegistry(t, 0).Invoke(context.Background(), "missing", nil)
+	if got := errorMessage(output); got != `unknown tool "missing"` {
+		t.Errorf("Invoke = %s, want an unknown tool error", output)
+	}
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	// a tool that ignores its context is abandoned at the timeout
+	release := make(chan struct{})
+	defer close(release)
+	slow := funcTool{name: "slow", invoke: func(ctx context.Context, args json.RawMessage) (string, error) {
+		<-release
+		return "too late", nil
+	}}
+	r := newTestRegistry(t, 50*time.Millisecond, slow)
+
+	start := time.Now()
+	output := r.Invoke(context.Background(), "slow", nil)
+	if got := errorMessage(output); got != `tool "slow" timed out after 50ms` {
+		t.Errorf("Invoke = %s, want a timeout error", output)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Invoke returned after %v", elapsed)
+	}
+}
+
+func TestInvokePanic(t *testing.T) {
+	broken := funcTool{name: "broken", invoke: func(ctx context.Context, args json.RawMessage) (string, error) {
+		panic("index out of range")
+	}}
+	output := newTestRegistry(t, 0, broken).Invoke(context.Background(), "broken", nil)
+	if got := errorMessage(output); got != `tool "broken" panicked: index out of range` {
+		t.Errorf("Invoke = %s, want the panic as an error", output)
+	}
+}
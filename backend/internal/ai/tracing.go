@@ -0,0 +1,197 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace exporters.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+)
+
+const tracerName = "interviews-ai/internal/ai"
+
+// TracingConfig selects where spans are exported.
+type TracingConfig struct {
+	// Exporter is none (default), stdout or otlp.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://localhost:4318. When empty
+	// the exporter falls back to the standard OTEL_EXPORTER_OTLP_* variables.
+	Endpoint string
+}
+
+// SetupTracing installs the global tracer provider and returns a function that
+// flushes and stops it. With no exporter configured spans are not recorded.
+func SetupTracing(ctx context.Context, config TracingConfig) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", TraceExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case TraceExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q: want none, stdout or otlp", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %v", config.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "ai-service"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracer is looked up on every use so tests can swap the global provider.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// turnTrace follows the current user turn of a session as a tree of spans:
+//
+//	turn                  speech_started (or response.created) to response.done
+//	├── turn.speech       speech_started to speech_stopped
+//	├── turn.response     response.created to response.done
+//	│   └── turn.first_audio  response.created to the first response.audio.delta
+//	├── hub.route         each message routed during the turn
+//	└── upstream.write    each write to the upstream during the turn
+//
+// Events are fed from the AI read pump, while spans for routing hops and writes are
+// started from every pump, so the state is guarded by mu.
+type turnTrace struct {
+	mu         sync.Mutex
+	turns      int
+	ctx        context.Context
+	turn       trace.Span
+	speech     trace.Span
+	response   trace.Span
+	firstAudio trace.Span
+}
+
+// observe moves the turn along on an upstream event.
+func (t *turnTrace) observe(s *Session, event ServerEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch event.Type {
+	case MsgTypeSpeechStarted:
+		// speaking over the assistant interrupts its turn
+		t.end("interrupted")
+		t.start(s)
+		_, t.speech = tracer().Start(t.ctx, "turn.speech")
+	case MsgTypeSpeechStopped:
+		endSpan(&t.speech)
+	case MsgTypeResponseCreated:
+		if t.ctx == nil {
+			t.start(s)
+		}
+		endSpan(&t.response)
+		var ctx context.Context
+		ctx, t.response = tracer().Start(t.ctx, "turn.response")
+		if id, ok := event.Response["id"].(string); ok {
+			t.response.SetAttributes(attribute.String("response.id", id))
+		}
+		_, t.firstAudio = tracer().Start(ctx, "turn.first_audio")
+	case MsgTypeResponseAudioDelta:
+		endSpan(&t.firstAudio)
+	case MsgTypeResponseDone:
+		if t.response != nil {
+			status, _ := event.Response["status"].(string)
+			t.response.SetAttributes(attribute.String("response.status", status))
+			if usage, ok := event.Response["usage"].(map[string]interface{}); ok {
+				inputTokens, _ := usage["input_tokens"].(float64)
+				outputTokens, _ := usage["output_tokens"].(float64)
+				t.response.SetAttributes(
+					attribute.Int64("usage.input_tokens", int64(inputTokens)),
+					attribute.Int64("usage.output_tokens", int64(outputTokens)),
+				)
+			}
+		}
+		t.end("")
+	}
+}
+
+// start begins a new turn as the root of its own trace. mu must be held.
+func (t *turnTrace) start(s *Session) {
+	t.turns++
+	t.ctx, t.turn = tracer().Start(context.Background(), "turn",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("session.id", s.ID),
+			attribute.String("client.id", s.Client.ClientId),
+			attribute.String("ai_client.id", s.AIClient.AiClientId),
+			attribute.String("user.id", s.UserID),
+			attribute.String("template", s.Template),
+			attribute.Int("turn", t.turns),
+		))
+}
+
+// end finishes the current turn and any span still open in it, recording why the
+// turn ended early if reason is set. mu must be held.
+func (t *turnTrace) end(reason string) {
+	if t.turn == nil {
+		return
+	}
+	if reason != "" {
+		t.turn.SetAttributes(attribute.String("turn.ended", reason))
+	}
+	endSpan(&t.firstAudio)
+	endSpan(&t.speech)
+	endSpan(&t.response)
+	endSpan(&t.turn)
+	t.ctx = nil
+}
+
+// finish ends an open turn when the session closes.
+func (t *turnTrace) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.end("session closed")
+}
+
+// startSpan starts a child span of the current turn, or a no-op span between turns.
+func (t *turnTrace) startSpan(name string, attributes ...attribute.KeyValue) trace.Span {
+	t.mu.Lock()
+	ctx := t.ctx
+	t.mu.Unlock()
+	if ctx == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+	return span
+}
+
+func endSpan(span *trace.Span) {
+	if *span != nil {
+		(*span).End()
+		*span = nil
+	}
+}
+
+// failSpan marks span as failed with err.
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
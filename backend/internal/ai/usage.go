@@ -0,0 +1,276 @@
+package ai
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"interviews-ai/internal/metrics"
+)
+
+// MsgTypeUsageUpdated tells the browser the usage and cost of a response, along
+// with the totals of its session and user.
+const MsgTypeUsageUpdated = "usage.updated"
+
+// TokenUsage counts the tokens of responses and what they cost, from the usage
+// reported in response.done. Cached tokens are also counted as input text or audio.
+type TokenUsage struct {
+	InputTokens       int64   `json:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	InputTextTokens   int64   `json:"input_text_tokens"`
+	InputAudioTokens  int64   `json:"input_audio_tokens"`
+	CachedTextTokens  int64   `json:"cached_text_tokens"`
+	CachedAudioTokens int64   `json:"cached_audio_tokens"`
+	OutputTextTokens  int64   `json:"output_text_tokens"`
+	OutputAudioTokens int64   `json:"output_audio_tokens"`
+	CostUSD           float64 `json:"cost_usd"`
+}
+
+// Add adds other to u.
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.InputTextTokens += other.InputTextTokens
+	u.InputAudioTokens += other.InputAudioTokens
+	u.CachedTextTokens += other.CachedTextTokens
+	u.CachedAudioTokens += other.CachedAudioTokens
+	u.OutputTextTokens += other.OutputTextTokens
+	u.OutputAudioTokens += other.OutputAudioTokens
+	u.CostUSD += other.CostUSD
+}
+
+// parseTokenUsage reads the usage object of a response.done. Tokens without a
+// breakdown into text and audio are counted as text.
+func parseTokenUsage(usage map[string]interface{}) TokenUsage {
+	count := func(m map[string]interface{}, key string) int64 {
+		n, _ := m[key].(float64)
+		return int64(n)
+	}
+	input, _ := usage["input_token_details"].(map[string]interface{})
+	cached, _ := input["cached_tokens_details"].(map[string]interface{})
+	output, _ := usage["output_token_details"].(map[string]interface{})
+
+	tokens := TokenUsage{
+		InputTokens:       count(usage, "input_tokens"),
+		OutputTokens:      count(usage, "output_tokens"),
+		InputTextTokens:   count(input, "text_tokens"),
+		InputAudioTokens:  count(input, "audio_tokens"),
+		CachedTextTokens:  count(cached, "text_tokens"),
+		CachedAudioTokens: count(cached, "audio_tokens"),
+		OutputTextTokens:  count(output, "text_tokens"),
+		OutputAudioTokens: count(output, "audio_tokens"),
+	}
+	if tokens.InputTextTokens+tokens.InputAudioTokens == 0 {
+		tokens.InputTextTokens = tokens.InputTokens
+	}
+	if cachedTokens := count(input, "cached_tokens"); cached == nil && cachedTokens > 0 {
+		// without a breakdown, cached tokens are taken from the text
+		tokens.CachedTextTokens = min(cachedTokens, tokens.InputTextTokens)
+	}
+	if tokens.OutputTextTokens+tokens.OutputAudioTokens == 0 {
+		tokens.OutputTextTokens = tokens.OutputTokens
+	}
+	return tokens
+}
+
+// Prices of a model, in USD per million tokens.
+type Prices struct {
+	InputText        float64 `json:"input_text"`
+	CachedInputText  float64 `json:"cached_input_text"`
+	InputAudio       float64 `json:"input_audio"`
+	CachedInputAudio float64 `json:"cached_input_audio"`
+	OutputText       float64 `json:"output_text"`
+	OutputAudio      float64 `json:"output_audio"`
+}
+
+// Cost returns what tokens cost at these prices, in USD.
+func (p Prices) Cost(tokens TokenUsage) float64 {
+	cost := float64(tokens.InputTextTokens-tokens.CachedTextTokens)*p.InputText +
+		float64(tokens.CachedTextTokens)*p.CachedInputText +
+		float64(tokens.InputAudioTokens-tokens.CachedAudioTokens)*p.InputAudio +
+		float64(tokens.CachedAudioTokens)*p.CachedInputAudio +
+		float64(tokens.OutputTextTokens)*p.OutputText +
+		float64(tokens.OutputAudioTokens)*p.OutputAudio
+	return cost / 1e6
+}
+
+// PriceTable maps model names to their prices.
+type PriceTable map[string]Prices
+
+// Lookup returns the prices of model. A model without its own entry takes the
+// longest name in the table it starts with, so dated snapshots share the prices
+// of their model.
+func (t PriceTable) Lookup(model string) (Prices, bool) {
+	if prices, ok := t[model]; ok {
+		return prices, true
+	}
+	var best string
+	for name := range t {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Prices{}, false
+	}
+	return t[best], true
+}
+
+// DefaultPrices are the list prices of the Realtime models.
+var DefaultPrices = PriceTable{
+	"gpt-4o-realtime-preview":      {InputText: 5, CachedInputText: 2.5, InputAudio: 40, CachedInputAudio: 2.5, OutputText: 20, OutputAudio: 80},
+	"gpt-4o-mini-realtime-preview": {InputText: 0.6, CachedInputText: 0.3, InputAudio: 10, CachedInputAudio: 0.3, OutputText: 2.4, OutputAudio: 20},
+	"gpt-realtime":                 {InputText: 4, CachedInputText: 0.4, InputAudio: 32, CachedInputAudio: 0.4, OutputText: 16, OutputAudio: 64},
+	"gpt-realtime-mini":            {InputText: 0.6, CachedInputText: 0.06, InputAudio: 10, CachedInputAudio: 0.3, OutputText: 2.4, OutputAudio: 20},
+}
+
+// UsageUpdatedEvent reports the usage of a response and the totals it adds to.
+type UsageUpdatedEvent struct {
+	Type     string     `json:"type"`
+	Response TokenUsage `json:"response"`
+	Session  TokenUsage `json:"session"`
+	// User is sent when user totals are kept.
+	User *UserUsage `json:"user,omitempty"`
+}
+
+// UserUsage is the usage of one user across sessions.
+type UserUsage struct {
+	UserID    string `json:"user_id"`
+	Responses int64  `json:"responses"`
+	TokenUsage
+	// Daily and Monthly are the usage of the current day and month, in UTC.
+	Daily     PeriodUsage `json:"daily"`
+	Monthly   PeriodUsage `json:"monthly"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// PeriodUsage is the usage of a user in one day or month.
+type PeriodUsage struct {
+	// Period is the day (2006-01-02) or month (2006-01) counted.
+	Period  string  `json:"period"`
+	Tokens  int64   `json:"tokens"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// in returns the usage counted in period, which is none if it counted another period.
+func (u PeriodUsage) in(period string) PeriodUsage {
+	if u.Period != period {
+		return PeriodUsage{Period: period}
+	}
+	return u
+}
+
+// Period names.
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// UsageStore keeps the usage of each user across sessions.
+type UsageStore interface {
+	// AddUsage adds the usage of a response to the totals of user and returns them.
+	AddUsage(user string, usage TokenUsage) (UserUsage, error)
+	// UserUsage returns the totals of user, which are zero for a new user.
+	UserUsage(user string) (UserUsage, error)
+}
+
+// MemoryUsageStore keeps the usage of each user until the service stops.
+type MemoryUsageStore struct {
+	mu    sync.Mutex
+	users map[string]UserUsage
+}
+
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{users: make(map[string]UserUsage)}
+}
+
+func (s *MemoryUsageStore) AddUsage(user string, usage TokenUsage) (UserUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := addUserUsage(s.users[user], user, usage)
+	s.users[user] = total
+	return total, nil
+}
+
+func (s *MemoryUsageStore) UserUsage(user string) (UserUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[user], nil
+}
+
+func addUserUsage(total UserUsage, user string, usage TokenUsage) UserUsage {
+	now := time.Now()
+	total.UserID = user
+	total.Responses++
+	total.TokenUsage.Add(usage)
+	total.Daily = total.Daily.in(now.UTC().Format(dayLayout))
+	total.Monthly = total.Monthly.in(now.UTC().Format(monthLayout))
+	for _, period := range []*PeriodUsage{&total.Daily, &total.Monthly} {
+		period.Tokens += usage.InputTokens + usage.OutputTokens
+		period.CostUSD += usage.CostUSD
+	}
+	total.UpdatedAt = now
+	return total
+}
+
+func (c *AIClient) usageKey() string {
+	if c.UsageKey != "" {
+		return c.UsageKey
+	}
+	return c.Session.UserID
+}
+
+// prices returns the prices of the session's model, which Config.PricingModel overrides.
+func (c *AIClient) prices() (Prices, bool) {
+	if c.Config == nil {
+		return Prices{}, false
+	}
+	model := c.Config.PricingModel
+	if model == "" {
+		model = c.model
+	}
+	return c.Config.Prices.Lookup(model)
+}
+
+// countResponse adds the token usage and cost of a finished response to the
+// session and user totals, and sends them to the browser.
+func countResponse(c *AIClient, event ServerEvent) {
+	usage, _ := event.Response["usage"].(map[string]interface{})
+	tokens := parseTokenUsage(usage)
+	if prices, ok := c.prices(); ok {
+		tokens.CostUSD = prices.Cost(tokens)
+	}
+
+	var session TokenUsage
+	c.Session.count(func(counters *SessionUsage) {
+		counters.Responses++
+		counters.TokenUsage.Add(tokens)
+		session = counters.TokenUsage
+	})
+	for kind, n := range map[string]int64{
+		"input_text":   tokens.InputTextTokens - tokens.CachedTextTokens,
+		"cached_text":  tokens.CachedTextTokens,
+		"input_audio":  tokens.InputAudioTokens - tokens.CachedAudioTokens,
+		"cached_audio": tokens.CachedAudioTokens,
+		"output_text":  tokens.OutputTextTokens,
+		"output_audio": tokens.OutputAudioTokens,
+	} {
+		metrics.Tokens.WithLabelValues(kind).Add(float64(n))
+	}
+	metrics.CostUSD.Add(tokens.CostUSD)
+
+	updated := UsageUpdatedEvent{Type: MsgTypeUsageUpdated, Response: tokens, Session: session}
+	if c.Usage != nil && c.Session != nil {
+		user, err := c.Usage.AddUsage(c.usageKey(), tokens)
+		if err != nil {
+			c.logger().Error("Failed to save user usage", "error", err)
+		} else {
+			updated.User = &user
+		}
+	}
+	c.logger().Debug("Response usage", "input_tokens", tokens.InputTokens, "output_tokens", tokens.OutputTokens, "cost_usd", tokens.CostUSD)
+	sendToClient(c, updated)
+	if updated.User != nil {
+		checkBudget(c, *updated.User)
+	}
+}
@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTokenUsage(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		usage map[string]interface{}
+		want  TokenUsage
+	}{
+		{
+			name: "details",
+			usage: map[string]interface{}{
+				"input_tokens": 1200.0, "output_tokens": 300.0,
+				"input_token_details": map[string]interface{}{
+					"cached_tokens": 500.0, "text_tokens": 400.0, "audio_tokens": 800.0,
+					"cached_tokens_details": map[string]interface{}{"text_tokens": 300.0, "audio_tokens": 200.0},
+				},
+				"output_token_details": map[string]interface{}{"text_tokens": 60.0, "audio_tokens": 240.0},
+			},
+			want: TokenUsage{InputTokens: 1200, OutputTokens: 300, InputTextTokens: 400, InputAudioTokens: 800,
+				CachedTextTokens: 300, CachedAudioTokens: 200, OutputTextTokens: 60, OutputAudioTokens: 240},
+		},
+		{
+			name: "totals only",
+			usage: map[string]interface{}{
+				"input_tokens": 100.0, "output_tokens": 50.0,
+				"input_token_details": map[string]interface{}{"cached_tokens": 20.0},
+			},
+			want: TokenUsage{InputTokens: 100, OutputTokens: 50, InputTextTokens: 100, CachedTextTokens: 20, OutputTextTokens: 50},
+		},
+		{name: "missing", usage: nil, want: TokenUsage{}},
+	} {
+		if got := parseTokenUsage(test.usage); got != test.want {
+			t.Errorf("%s: parseTokenUsage = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPrices(t *testing.T) {
+	prices, ok := DefaultPrices.Lookup("gpt-4o-realtime-preview-2024-12-17")
+	if !ok || prices != DefaultPrices["gpt-4o-realtime-preview"] {
+		t.Fatalf("a dated snapshot got prices %+v, %v", prices, ok)
+	}
+	if prices, _ := DefaultPrices.Lookup("gpt-realtime-mini-2025-10-06"); prices != DefaultPrices["gpt-realtime-mini"] {
+		t.Errorf("gpt-realtime-mini took the prices of a shorter name: %+v", prices)
+	}
+	if _, ok := DefaultPrices.Lookup("whisper-1"); ok {
+		t.Error("an unknown model has prices")
+	}
+
+	tokens := TokenUsage{InputTextTokens: 400, CachedTextTokens: 300, InputAudioTokens: 800, CachedAudioTokens: 200, OutputTextTokens: 60, OutputAudioTokens: 240}
+	// (100*5 + 300*2.5 + 600*40 + 200*2.5 + 60*20 + 240*80) / 1e6
+	if got, want := prices.Cost(tokens), 0.04615; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost = %v, want %v", got, want)
+	}
+}
+
+func TestFileUsageStore(t *testing.T) {
+	store, err := NewFileRecordStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := store.AddUsage("../alice", TokenUsage{InputTokens: 10, OutputTokens: 5, CostUSD: 0.5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a new store reads the totals back from disk
+	total, err := (&FileRecordStore{Dir: store.Dir}).AddUsage("../alice", TokenUsage{InputTokens: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.UserID != "../alice" || total.Responses != 3 || total.InputTokens != 21 || total.OutputTokens != 10 || total.CostUSD != 1 {
+		t.Errorf("total = %+v", total)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "users", "..%2Falice.json")); err != nil {
+		t.Errorf("usage file not kept inside the users dir: %v", err)
+	}
+}
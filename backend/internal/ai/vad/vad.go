@@ -0,0 +1,197 @@
+// Package vad detects speech in pcm16 audio at 24kHz, the input format of the
+// Realtime API, and gates out the silence between utterances.
+//
+// A 20ms frame is speech when its energy is above a threshold and its zero-crossing
+// rate is low enough to be voice rather than hiss; very loud frames count as speech
+// regardless.
+package vad
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	SampleRate = 24000
+	FrameMs    = 20
+	// bytesPerMs of pcm16 mono audio
+	bytesPerMs = SampleRate * 2 / 1000
+	frameBytes = FrameMs * bytesPerMs
+
+	// loudFactor times the threshold is speech whatever its zero-crossing rate.
+	loudFactor = 4
+)
+
+// Defaults of Config.
+const (
+	DefaultThreshold           = 0.01
+	DefaultMaxZeroCrossingRate = 0.35
+	DefaultHangover            = 800 * time.Millisecond
+	DefaultPreRoll             = 300 * time.Millisecond
+)
+
+// Config tunes a Gate. Zero values select the defaults, except for PreRoll.
+type Config struct {
+	// Threshold is the RMS level, from 0 to 1, above which a frame may be speech.
+	Threshold float64
+	// MaxZeroCrossingRate is the highest share of sign changes between samples a
+	// quiet frame may have and still be speech.
+	MaxZeroCrossingRate float64
+	// Hangover keeps audio flowing after speech, so the silence that ends a turn
+	// still reaches the upstream's own turn detection.
+	Hangover time.Duration
+	// PreRoll is how much audio from just before speech starts is sent with it, so
+	// the first syllable is not cut off.
+	PreRoll time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultThreshold
+	}
+	if c.MaxZeroCrossingRate <= 0 {
+		c.MaxZeroCrossingRate = DefaultMaxZeroCrossingRate
+	}
+	if c.Hangover <= 0 {
+		c.Hangover = DefaultHangover
+	}
+	return c
+}
+
+// Stats count the audio a Gate has seen, in milliseconds. Audio still held back as
+// pre-roll is in neither.
+type Stats struct {
+	PassedMs     int64 `json:"passed_ms"`
+	SuppressedMs int64 `json:"suppressed_ms"`
+}
+
+// Gate passes chunks of audio that contain speech, along with a hangover after
+// them and a pre-roll before them, and holds back the rest. It is not safe for
+// concurrent use.
+type Gate struct {
+	config Config
+	// hangoverMs is how much more audio passes without speech.
+	hangoverMs int
+	// held is the most recent suppressed audio, up to PreRoll long.
+	held  [][]byte
+	stats Stats
+}
+
+func NewGate(config Config) *Gate {
+	return &Gate{config: config.withDefaults()}
+}
+
+// SetHangover changes the hangover of the gate.
+func (g *Gate) SetHangover(hangover time.Duration) {
+	if hangover > 0 {
+		g.config.Hangover = hangover
+	}
+}
+
+// Hangover returns the hangover of the gate.
+func (g *Gate) Hangover() time.Duration {
+	return g.config.Hangover
+}
+
+// Process takes the next chunk of audio and returns the chunks to send in its
+// place: none while silent, or the held pre-roll followed by the chunk once speech
+// starts.
+func (g *Gate) Process(pcm []byte) [][]byte {
+	ms := Duration(pcm)
+	if g.hasSpeech(pcm) {
+		out := append(g.held, pcm)
+		for _, chunk := range out {
+			g.stats.PassedMs += Duration(chunk)
+		}
+		g.held = nil
+		g.hangoverMs = int(g.config.Hangover.Milliseconds())
+		return out
+	}
+	if g.hangoverMs > 0 {
+		g.hangoverMs -= int(ms)
+		g.stats.PassedMs += ms
+		return [][]byte{pcm}
+	}
+
+	g.held = append(g.held, pcm)
+	// audio older than the pre-roll is dropped for good
+	var heldMs int64
+	for i := len(g.held) - 1; i >= 0; i-- {
+		heldMs += Duration(g.held[i])
+		if time.Duration(heldMs)*time.Millisecond > g.config.PreRoll {
+			for _, dropped := range g.held[:i+1] {
+				g.stats.SuppressedMs += Duration(dropped)
+			}
+			g.held = g.held[i+1:]
+			break
+		}
+	}
+	return nil
+}
+
+// Stats returns what the gate has passed and suppressed so far.
+func (g *Gate) Stats() Stats {
+	return g.stats
+}
+
+func (g *Gate) hasSpeech(pcm []byte) bool {
+	for start := 0; start < len(pcm); start += frameBytes {
+		frame := pcm[start:min(start+frameBytes, len(pcm))]
+		// a short tail is judged with the frame before it
+		if len(frame) < frameBytes/2 && start > 0 {
+			frame = pcm[max(start-frameBytes, 0):]
+		}
+		if IsSpeech(frame, g.config.Threshold, g.config.MaxZeroCrossingRate) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSpeech reports whether a frame of audio sounds like speech.
+func IsSpeech(frame []byte, threshold float64, maxZeroCrossingRate float64) bool {
+	level := RMS(frame)
+	if level < threshold {
+		return false
+	}
+	return level >= loudFactor*threshold || ZeroCrossingRate(frame) <= maxZeroCrossingRate
+}
+
+// RMS returns the root mean square level of pcm16 samples, normalized to 0-1.
+func RMS(pcm []byte) float64 {
+	n := len(pcm) / 2
+	if n == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		s := sample(pcm, i)
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+// ZeroCrossingRate returns the share of consecutive pcm16 samples that change sign.
+func ZeroCrossingRate(pcm []byte) float64 {
+	n := len(pcm) / 2
+	if n < 2 {
+		return 0
+	}
+	crossings := 0
+	for i := 1; i < n; i++ {
+		if (sample(pcm, i-1) >= 0) != (sample(pcm, i) >= 0) {
+			crossings++
+		}
+	}
+	return float64(crossings) / float64(n-1)
+}
+
+// Duration returns the length of pcm16 audio in milliseconds.
+func Duration(pcm []byte) int64 {
+	return int64(len(pcm) / bytesPerMs)
+}
+
+func sample(pcm []byte, i int) float64 {
+	return float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / math.MaxInt16
+}
@@ -0,0 +1,80 @@
+package vad
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// sine returns ms milliseconds of a tone at freq Hz and the given amplitude (0-1).
+func sine(ms int, freq float64, amplitude float64) []byte {
+	pcm := make([]byte, ms*bytesPerMs)
+	for i := 0; i < len(pcm)/2; i++ {
+		v := amplitude * math.Sin(2*math.Pi*freq*float64(i)/SampleRate)
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(v*math.MaxInt16)))
+	}
+	return pcm
+}
+
+// hiss returns ms milliseconds of white noise at the given amplitude.
+func hiss(ms int, amplitude float64) []byte {
+	random := rand.New(rand.NewSource(1))
+	pcm := make([]byte, ms*bytesPerMs)
+	for i := 0; i < len(pcm)/2; i++ {
+		v := amplitude * (2*random.Float64() - 1)
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(v*math.MaxInt16)))
+	}
+	return pcm
+}
+
+func TestIsSpeech(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		frame []byte
+		want  bool
+	}{
+		{"silence", make([]byte, frameBytes), false},
+		{"quiet voice", sine(FrameMs, 200, 0.03), true},
+		{"hiss", hiss(FrameMs, 0.03), false},
+		{"loud noise", hiss(FrameMs, 0.5), true},
+	} {
+		if got := IsSpeech(test.frame, DefaultThreshold, DefaultMaxZeroCrossingRate); got != test.want {
+			t.Errorf("%s: IsSpeech = %v, want %v (rms %.3f, zcr %.2f)", test.name, got, test.want, RMS(test.frame), ZeroCrossingRate(test.frame))
+		}
+	}
+}
+
+func TestGate(t *testing.T) {
+	gate := NewGate(Config{Hangover: 300 * time.Millisecond, PreRoll: 200 * time.Millisecond})
+	silence := make([]byte, 100*bytesPerMs)
+	speech := sine(100, 200, 0.1)
+
+	for i := 0; i < 5; i++ {
+		if out := gate.Process(silence); out != nil {
+			t.Fatalf("silent chunk %d was passed", i)
+		}
+	}
+	// the last 200ms of silence are held back as pre-roll
+	if stats := gate.Stats(); stats.SuppressedMs != 300 || stats.PassedMs != 0 {
+		t.Errorf("stats after silence = %+v", stats)
+	}
+
+	out := gate.Process(speech)
+	if len(out) != 3 || &out[2][0] != &speech[0] {
+		t.Fatalf("speech passed %d chunks, want the 2 chunk pre-roll and the speech", len(out))
+	}
+
+	// the hangover passes 300ms of silence after speech
+	passed := 0
+	for i := 0; i < 5; i++ {
+		passed += len(gate.Process(silence))
+	}
+	if passed != 3 {
+		t.Errorf("%d silent chunks passed after speech, want 3", passed)
+	}
+	if stats := gate.Stats(); stats.PassedMs != 600 || stats.SuppressedMs != 300 {
+		t.Errorf("final stats = %+v, want 600ms passed and 300ms suppressed", stats)
+	}
+}
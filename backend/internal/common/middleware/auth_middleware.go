@@ -1,13 +1,44 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 )
 
+// UserIDHeader carries the caller's user id. Browsers cannot set headers on websocket
+// requests, so the user_id query parameter is accepted as well.
+const UserIDHeader = "X-User-ID"
+
+// AnonymousUser identifies callers that did not say who they are.
+const AnonymousUser = "anonymous"
+
+type contextKey string
+
+const userIDKey contextKey = "user_id"
+
+// AuthMiddleware stores the user id the caller gives in the request context. It is
+// not verified: any client can claim any id, or a new one each time. What is keyed
+// by it, the per-user session limits, usage totals and budgets, is advisory; only
+// the limits keyed by client IP hold against a client that lies.
 func AuthMiddleware(next HandleFunc) HandleFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Request received: %s\n", r.RequestURI)
-		next(w, r)
+		slog.Debug("Request received", "method", r.Method, "path", r.URL.Path)
+		userID := r.Header.Get(UserIDHeader)
+		if userID == "" {
+			userID = r.URL.Query().Get("user_id")
+		}
+		if userID == "" {
+			userID = AnonymousUser
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userIDKey, userID)))
+	}
+}
+
+// UserID returns the user id stored by AuthMiddleware, or AnonymousUser.
+func UserID(ctx context.Context) string {
+	if userID, ok := ctx.Value(userIDKey).(string); ok {
+		return userID
 	}
+	return AnonymousUser
 }
@@ -0,0 +1,539 @@
+// Package config loads the configuration of the ai-service.
+//
+// Values are merged from, in increasing order of precedence: the defaults below, a
+// YAML or TOML file (--config or CONFIG_FILE), environment variables (including a
+// .env file in the working directory) and command line flags. The result is
+// validated as a whole, so every problem is reported at once.
+//
+// Each setting is described by struct tags: yaml and toml name it in files, env
+// names its environment variable, flag its command line flag, and secret marks it
+// for redaction by Print.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"interviews-ai/internal/ai"
+	"interviews-ai/internal/ai/tools"
+	"interviews-ai/internal/ai/vad"
+	"interviews-ai/internal/logging"
+	"interviews-ai/internal/ratelimit"
+)
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Provider  string          `yaml:"provider" toml:"provider" env:"AI_PROVIDER" flag:"provider" usage:"realtime backend: azure, openai, mock, cascade or replay"`
+	Azure     AzureConfig     `yaml:"azure" toml:"azure"`
+	OpenAI    OpenAIConfig    `yaml:"openai" toml:"openai"`
+	Mock      MockConfig      `yaml:"mock" toml:"mock"`
+	Cascade   CascadeConfig   `yaml:"cascade" toml:"cascade"`
+	Replay    ReplayConfig    `yaml:"replay" toml:"replay"`
+	Session   SessionConfig   `yaml:"session" toml:"session"`
+	Timeouts  TimeoutsConfig  `yaml:"timeouts" toml:"timeouts"`
+	Limits    LimitsConfig    `yaml:"limits" toml:"limits"`
+	Records   RecordsConfig   `yaml:"records" toml:"records"`
+	Pricing   PricingConfig   `yaml:"pricing" toml:"pricing"`
+	Budgets   BudgetsConfig   `yaml:"budgets" toml:"budgets"`
+	Breaker   BreakerConfig   `yaml:"breaker" toml:"breaker"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	Logging   LoggingConfig   `yaml:"logging" toml:"logging"`
+	Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+	Templates TemplatesConfig `yaml:"templates" toml:"templates"`
+	Reload    ReloadConfig    `yaml:"reload" toml:"reload"`
+}
+
+type ServerConfig struct {
+	Addr string    `yaml:"addr" toml:"addr" env:"LISTEN_ADDR" flag:"addr" usage:"address to listen on"`
+	TLS  TLSConfig `yaml:"tls" toml:"tls"`
+}
+
+// TLSConfig enables HTTPS and WSS when both files are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file" env:"TLS_CERT_FILE" flag:"tls-cert" usage:"TLS certificate file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file" env:"TLS_KEY_FILE" flag:"tls-key" usage:"TLS private key file"`
+}
+
+type AzureConfig struct {
+	APIKey   string `yaml:"api_key" toml:"api_key" env:"AZURE_OPENAI_API_KEY" secret:"true"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"AZURE_OPENAI_ENDPOINT"`
+}
+
+type OpenAIConfig struct {
+	APIKey string `yaml:"api_key" toml:"api_key" env:"OPENAI_API_KEY" secret:"true"`
+	// Endpoint defaults to the OpenAI Realtime API for Model.
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"OPENAI_REALTIME_ENDPOINT"`
+	Model    string `yaml:"model" toml:"model" env:"OPENAI_REALTIME_MODEL"`
+}
+
+type MockConfig struct {
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"MOCK_REALTIME_ENDPOINT"`
+}
+
+// CascadeConfig configures the OpenAI compatible backends of the cascade provider.
+// The per-stage base URLs default to BaseURL.
+type CascadeConfig struct {
+	BaseURL     string `yaml:"base_url" toml:"base_url" env:"CASCADE_BASE_URL"`
+	APIKey      string `yaml:"api_key" toml:"api_key" env:"CASCADE_API_KEY" secret:"true"`
+	STTBaseURL  string `yaml:"stt_base_url" toml:"stt_base_url" env:"CASCADE_STT_BASE_URL"`
+	STTModel    string `yaml:"stt_model" toml:"stt_model" env:"CASCADE_STT_MODEL"`
+	ChatBaseURL string `yaml:"chat_base_url" toml:"chat_base_url" env:"CASCADE_CHAT_BASE_URL"`
+	ChatModel   string `yaml:"chat_model" toml:"chat_model" env:"CASCADE_CHAT_MODEL"`
+	TTSBaseURL  string `yaml:"tts_base_url" toml:"tts_base_url" env:"CASCADE_TTS_BASE_URL"`
+	TTSModel    string `yaml:"tts_model" toml:"tts_model" env:"CASCADE_TTS_MODEL"`
+}
+
+type ReplayConfig struct {
+	Cassette string `yaml:"cassette" toml:"cassette" env:"AI_REPLAY_CASSETTE"`
+	// Speed is a multiple of real time; 0 replays as fast as possible.
+	Speed float64 `yaml:"speed" toml:"speed" env:"AI_REPLAY_SPEED"`
+}
+
+// SessionConfig is sent to the model in the initial session.update.
+type SessionConfig struct {
+	Voice       string          `yaml:"voice" toml:"voice" env:"AI_VOICE" flag:"voice" usage:"voice of the interviewer"`
+	Temperature float64         `yaml:"temperature" toml:"temperature" env:"AI_TEMPERATURE" flag:"temperature" usage:"sampling temperature, 0.6 to 1.2"`
+	VAD         VADConfig       `yaml:"vad" toml:"vad"`
+	NoiseGate   NoiseGateConfig `yaml:"noise_gate" toml:"noise_gate"`
+}
+
+// VADConfig configures server side voice activity detection. Zero values leave the
+// upstream's defaults in place; a Type of none starts sessions in push-to-talk mode.
+type VADConfig struct {
+	Type              string  `yaml:"type" toml:"type" env:"AI_VAD_TYPE"`
+	Threshold         float64 `yaml:"threshold" toml:"threshold" env:"AI_VAD_THRESHOLD"`
+	PrefixPaddingMs   int     `yaml:"prefix_padding_ms" toml:"prefix_padding_ms" env:"AI_VAD_PREFIX_PADDING_MS"`
+	SilenceDurationMs int     `yaml:"silence_duration_ms" toml:"silence_duration_ms" env:"AI_VAD_SILENCE_DURATION_MS"`
+}
+
+// NoiseGateConfig drops silent browser audio before it is sent upstream, which saves
+// audio tokens and bandwidth.
+type NoiseGateConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"AI_NOISE_GATE"`
+	// Threshold is the RMS level, from 0 to 1, above which audio may be speech.
+	Threshold float64 `yaml:"threshold" toml:"threshold" env:"AI_NOISE_GATE_THRESHOLD"`
+	// MaxZeroCrossingRate tells quiet speech from hiss.
+	MaxZeroCrossingRate float64 `yaml:"max_zero_crossing_rate" toml:"max_zero_crossing_rate" env:"AI_NOISE_GATE_MAX_ZCR"`
+	// Hangover keeps sending audio after speech; it is extended past the VAD's
+	// silence duration when that is longer.
+	Hangover time.Duration `yaml:"hangover" toml:"hangover" env:"AI_NOISE_GATE_HANGOVER"`
+	// PreRoll is audio from just before speech that is sent along with it.
+	PreRoll time.Duration `yaml:"pre_roll" toml:"pre_roll" env:"AI_NOISE_GATE_PRE_ROLL"`
+}
+
+type TimeoutsConfig struct {
+	// Dial bounds the upstream websocket handshake.
+	Dial time.Duration `yaml:"dial" toml:"dial" env:"AI_DIAL_TIMEOUT"`
+	// Tool bounds each tool call made by the model.
+	Tool time.Duration `yaml:"tool" toml:"tool" env:"TOOL_TIMEOUT"`
+	// ReadHeader bounds reading the headers of an HTTP request.
+	ReadHeader time.Duration `yaml:"read_header" toml:"read_header" env:"READ_HEADER_TIMEOUT"`
+	// Drain is how long live sessions may run after SIGTERM before they are closed.
+	Drain time.Duration `yaml:"drain" toml:"drain" env:"DRAIN_TIMEOUT"`
+	// Shutdown bounds closing the HTTP server once sessions are drained.
+	Shutdown time.Duration `yaml:"shutdown" toml:"shutdown" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type LimitsConfig struct {
+	// SendBuffer is the capacity of each client's Send channel; a session whose
+	// channel fills up is evicted.
+	SendBuffer int `yaml:"send_buffer" toml:"send_buffer" env:"SEND_BUFFER_SIZE"`
+	// MaxMessageBytes limits the size of a browser message; 0 means no limit.
+	MaxMessageBytes int64 `yaml:"max_message_bytes" toml:"max_message_bytes" env:"MAX_MESSAGE_BYTES"`
+	// MaxSessions limits concurrent sessions, across every instance sharing the redis
+	// backend; 0 means no limit.
+	MaxSessions int `yaml:"max_sessions" toml:"max_sessions" env:"MAX_SESSIONS" flag:"max-sessions" usage:"maximum concurrent sessions, 0 for no limit"`
+	// MaxSessionsPerUser limits concurrent sessions of one user; 0 means no limit.
+	// Anonymous users are told apart by their IP.
+	MaxSessionsPerUser int `yaml:"max_sessions_per_user" toml:"max_sessions_per_user" env:"MAX_SESSIONS_PER_USER"`
+	// MaxSessionsPerIP limits concurrent sessions from one client IP; 0 means no
+	// limit. Unlike user ids, which clients choose, IPs bound what one client can use.
+	MaxSessionsPerIP int `yaml:"max_sessions_per_ip" toml:"max_sessions_per_ip" env:"MAX_SESSIONS_PER_IP"`
+	// AttemptsPerMinute limits connection attempts per user and per client IP; 0
+	// means no limit.
+	AttemptsPerMinute int `yaml:"attempts_per_minute" toml:"attempts_per_minute" env:"CONNECT_ATTEMPTS_PER_MINUTE"`
+	// MaxSessionDuration ends sessions that run longer; 0 means no limit.
+	MaxSessionDuration time.Duration `yaml:"max_session_duration" toml:"max_session_duration" env:"MAX_SESSION_DURATION"`
+	// ClientIPHeader names the header holding the client IP, such as X-Forwarded-For
+	// behind a proxy. The connection's address is used when empty.
+	ClientIPHeader string `yaml:"client_ip_header" toml:"client_ip_header" env:"CLIENT_IP_HEADER"`
+	// Backend keeps the limit counters: memory, or redis to share them between instances.
+	Backend string `yaml:"backend" toml:"backend" env:"LIMITS_BACKEND"`
+	// RedisURL is the server of the redis backend, such as redis://host:6379/0.
+	RedisURL string `yaml:"redis_url" toml:"redis_url" env:"REDIS_URL" secret:"true"`
+}
+
+// Limit backends.
+const (
+	LimitsBackendMemory = "memory"
+	LimitsBackendRedis  = "redis"
+)
+
+type RecordsConfig struct {
+	// Dir is where session records are written; records are not kept when empty.
+	Dir string `yaml:"dir" toml:"dir" env:"SESSION_RECORDS_DIR"`
+	// CassetteDir, if set, records every upstream session as a cassette.
+	CassetteDir string `yaml:"cassette_dir" toml:"cassette_dir" env:"AI_RECORD_DIR"`
+}
+
+// PricingConfig converts the token usage of responses to cost.
+type PricingConfig struct {
+	// Model prices sessions as this model instead of the one the upstream reports,
+	// such as the model behind an Azure deployment.
+	Model string `yaml:"model" toml:"model" env:"AI_PRICING_MODEL"`
+	// Prices are by model, in USD per million tokens. An entry replaces the built-in
+	// prices of its model, and also applies to the dated versions of the model.
+	Prices map[string]PriceConfig `yaml:"prices" toml:"prices"`
+}
+
+type PriceConfig struct {
+	InputText        float64 `yaml:"input_text" toml:"input_text"`
+	CachedInputText  float64 `yaml:"cached_input_text" toml:"cached_input_text"`
+	InputAudio       float64 `yaml:"input_audio" toml:"input_audio"`
+	CachedInputAudio float64 `yaml:"cached_input_audio" toml:"cached_input_audio"`
+	OutputText       float64 `yaml:"output_text" toml:"output_text"`
+	OutputAudio      float64 `yaml:"output_audio" toml:"output_audio"`
+}
+
+// BudgetsConfig limits what each known user may use per day and per month, in
+// UTC. Limits of 0 are not enforced.
+type BudgetsConfig struct {
+	// DailyUSD, MonthlyUSD, DailyTokens and MonthlyTokens are the limits of users without a plan.
+	DailyUSD      float64 `yaml:"daily_usd" toml:"daily_usd" env:"BUDGET_DAILY_USD"`
+	MonthlyUSD    float64 `yaml:"monthly_usd" toml:"monthly_usd" env:"BUDGET_MONTHLY_USD"`
+	DailyTokens   int64   `yaml:"daily_tokens" toml:"daily_tokens" env:"BUDGET_DAILY_TOKENS"`
+	MonthlyTokens int64   `yaml:"monthly_tokens" toml:"monthly_tokens" env:"BUDGET_MONTHLY_TOKENS"`
+	// WarnAt is the share of a limit at which the browser is warned.
+	WarnAt float64 `yaml:"warn_at" toml:"warn_at" env:"BUDGET_WARN_AT"`
+	// WrapUpTimeout bounds the model's closing feedback once a limit is reached.
+	WrapUpTimeout time.Duration `yaml:"wrap_up_timeout" toml:"wrap_up_timeout" env:"BUDGET_WRAP_UP_TIMEOUT"`
+	// Plans are named sets of limits, assigned to users in Users.
+	Plans map[string]PlanConfig `yaml:"plans" toml:"plans"`
+	// Users maps user ids to their plan.
+	Users map[string]string `yaml:"users" toml:"users"`
+}
+
+// PlanConfig is the limits of a plan, as in BudgetsConfig.
+type PlanConfig struct {
+	DailyUSD      float64 `yaml:"daily_usd" toml:"daily_usd"`
+	MonthlyUSD    float64 `yaml:"monthly_usd" toml:"monthly_usd"`
+	DailyTokens   int64   `yaml:"daily_tokens" toml:"daily_tokens"`
+	MonthlyTokens int64   `yaml:"monthly_tokens" toml:"monthly_tokens"`
+}
+
+// defaultPlan names the limits of users without a plan.
+const defaultPlan = "default"
+
+type BreakerConfig struct {
+	Threshold int           `yaml:"threshold" toml:"threshold" env:"AI_BREAKER_THRESHOLD"`
+	Cooldown  time.Duration `yaml:"cooldown" toml:"cooldown" env:"AI_BREAKER_COOLDOWN"`
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"AI_TRACE_EXPORTER" flag:"trace-exporter" usage:"none, stdout or otlp"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"AI_TRACE_ENDPOINT"`
+}
+
+type LoggingConfig struct {
+	Level       string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+	Format      string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"text or json"`
+	SampleEvery int    `yaml:"sample_every" toml:"sample_every" env:"LOG_SAMPLE_EVERY"`
+}
+
+type AdminConfig struct {
+	// Token enables the admin API; it is disabled when empty.
+	Token string `yaml:"token" toml:"token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+type TemplatesConfig struct {
+	// Dir holds extra interview templates, one .md or .txt file each, named after
+	// the file. They override the built-in templates of the same name.
+	Dir string `yaml:"dir" toml:"dir" env:"TEMPLATES_DIR" flag:"templates" usage:"directory of interview templates"`
+}
+
+// ReloadConfig controls hot reloading of the config file and the templates, which
+// also happens on SIGHUP.
+type ReloadConfig struct {
+	// Interval is how often the files are checked for changes; 0 only reloads on SIGHUP.
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"RELOAD_INTERVAL"`
+}
+
+const (
+	defaultOpenAIRealtimeModel = "gpt-4o-realtime-preview"
+	defaultMockEndpoint        = "ws://localhost:5556/realtime"
+	defaultCascadeBaseURL      = "https://api.openai.com/v1"
+)
+
+// Default returns the configuration used when nothing else is set.
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Addr: ":5555"},
+		Provider: ai.ProviderAzure,
+		OpenAI:   OpenAIConfig{Model: defaultOpenAIRealtimeModel},
+		Mock:     MockConfig{Endpoint: defaultMockEndpoint},
+		Cascade: CascadeConfig{
+			BaseURL:   defaultCascadeBaseURL,
+			STTModel:  "whisper-1",
+			ChatModel: "gpt-4o-mini",
+			TTSModel:  "tts-1",
+		},
+		Session: SessionConfig{
+			Voice:       ai.DefaultVoice,
+			Temperature: ai.DefaultTemperature,
+			VAD:         VADConfig{Type: ai.TurnDetectionVAD},
+			NoiseGate: NoiseGateConfig{
+				Threshold:           vad.DefaultThreshold,
+				MaxZeroCrossingRate: vad.DefaultMaxZeroCrossingRate,
+				Hangover:            vad.DefaultHangover,
+				PreRoll:             vad.DefaultPreRoll,
+			},
+		},
+		Timeouts: TimeoutsConfig{
+			Dial:       ai.DefaultDialTimeout,
+			Tool:       tools.DefaultTimeout,
+			ReadHeader: 10 * time.Second,
+			Drain:      30 * time.Second,
+			Shutdown:   5 * time.Second,
+		},
+		Limits: LimitsConfig{
+			SendBuffer:      ai.DefaultSendBuffer,
+			MaxMessageBytes: 1 << 20,
+			Backend:         LimitsBackendMemory,
+		},
+		Pricing: PricingConfig{Prices: defaultPrices()},
+		Budgets: BudgetsConfig{WarnAt: ai.DefaultBudgetWarnAt, WrapUpTimeout: ai.DefaultWrapUpTimeout},
+		Breaker: BreakerConfig{Threshold: ai.DefaultBreakerThreshold, Cooldown: ai.DefaultBreakerCooldown},
+		Tracing: TracingConfig{Exporter: ai.TraceExporterNone},
+		Logging: LoggingConfig{Level: "info", Format: "text", SampleEvery: logging.DefaultSampleEvery},
+		Reload:  ReloadConfig{Interval: 5 * time.Second},
+	}
+}
+
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check((c.Server.TLS.CertFile == "") == (c.Server.TLS.KeyFile == ""), "server.tls needs both cert_file and key_file")
+
+	switch c.Provider {
+	case ai.ProviderAzure:
+		check(c.Azure.APIKey != "" && c.Azure.Endpoint != "", "the azure provider needs azure.api_key and azure.endpoint")
+	case ai.ProviderOpenAI:
+		check(c.OpenAI.APIKey != "", "the openai provider needs openai.api_key")
+	case ai.ProviderMock:
+		check(c.Mock.Endpoint != "", "the mock provider needs mock.endpoint")
+	case ai.ProviderCascade:
+		check(c.Cascade.BaseURL != "", "the cascade provider needs cascade.base_url")
+	case ai.ProviderReplay:
+		check(c.Replay.Cassette != "", "the replay provider needs replay.cassette")
+	default:
+		errs = append(errs, fmt.Errorf("unknown provider %q", c.Provider))
+	}
+	check(c.Replay.Speed >= 0, "replay.speed must not be negative")
+
+	check(slices.Contains(ai.Voices, c.Session.Voice), "session.voice must be one of %v, got %q", ai.Voices, c.Session.Voice)
+	check(c.Session.Temperature >= ai.MinTemperature && c.Session.Temperature <= ai.MaxTemperature,
+		"session.temperature must be between %v and %v, got %v", ai.MinTemperature, ai.MaxTemperature, c.Session.Temperature)
+	check(c.Session.VAD.Type == ai.TurnDetectionVAD || c.Session.VAD.Type == ai.TurnDetectionNone,
+		"session.vad.type must be %s or %s, got %q", ai.TurnDetectionVAD, ai.TurnDetectionNone, c.Session.VAD.Type)
+	check(c.Session.VAD.Threshold >= 0 && c.Session.VAD.Threshold <= 1, "session.vad.threshold must be between 0 and 1")
+	check(c.Session.VAD.PrefixPaddingMs >= 0, "session.vad.prefix_padding_ms must not be negative")
+	check(c.Session.VAD.SilenceDurationMs >= 0, "session.vad.silence_duration_ms must not be negative")
+	if gate := c.Session.NoiseGate; gate.Enabled {
+		check(gate.Threshold > 0 && gate.Threshold <= 1, "session.noise_gate.threshold must be above 0 and at most 1")
+		check(gate.MaxZeroCrossingRate > 0 && gate.MaxZeroCrossingRate <= 1, "session.noise_gate.max_zero_crossing_rate must be above 0 and at most 1")
+		check(gate.Hangover > 0, "session.noise_gate.hangover must be positive")
+		check(gate.PreRoll >= 0, "session.noise_gate.pre_roll must not be negative")
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"dial": c.Timeouts.Dial, "tool": c.Timeouts.Tool, "read_header": c.Timeouts.ReadHeader,
+		"drain": c.Timeouts.Drain, "shutdown": c.Timeouts.Shutdown,
+	} {
+		check(timeout > 0, "timeouts.%s must be positive", name)
+	}
+
+	check(c.Limits.SendBuffer > 0, "limits.send_buffer must be positive")
+	check(c.Limits.MaxMessageBytes >= 0, "limits.max_message_bytes must not be negative")
+	check(c.Limits.MaxSessions >= 0, "limits.max_sessions must not be negative")
+	check(c.Limits.MaxSessionsPerUser >= 0, "limits.max_sessions_per_user must not be negative")
+	check(c.Limits.MaxSessionsPerIP >= 0, "limits.max_sessions_per_ip must not be negative")
+	check(c.Limits.AttemptsPerMinute >= 0, "limits.attempts_per_minute must not be negative")
+	check(c.Limits.MaxSessionDuration >= 0, "limits.max_session_duration must not be negative")
+	switch c.Limits.Backend {
+	case LimitsBackendMemory:
+	case LimitsBackendRedis:
+		check(c.Limits.RedisURL != "", "limits.redis_url is required with the redis backend")
+	default:
+		errs = append(errs, fmt.Errorf("limits.backend must be memory or redis, got %q", c.Limits.Backend))
+	}
+
+	for model, price := range c.Pricing.Prices {
+		check(price.InputText >= 0 && price.CachedInputText >= 0 && price.InputAudio >= 0 &&
+			price.CachedInputAudio >= 0 && price.OutputText >= 0 && price.OutputAudio >= 0,
+			"pricing.prices.%s must not be negative", model)
+	}
+	if model := c.Pricing.Model; model != "" {
+		_, ok := c.AI().Prices.Lookup(model)
+		check(ok, "pricing.model %q has no prices", model)
+	}
+
+	budgets := c.Budgets
+	check(budgets.DailyUSD >= 0 && budgets.MonthlyUSD >= 0 && budgets.DailyTokens >= 0 && budgets.MonthlyTokens >= 0,
+		"budgets limits must not be negative")
+	check(budgets.WarnAt > 0 && budgets.WarnAt <= 1, "budgets.warn_at must be above 0 and at most 1, got %v", budgets.WarnAt)
+	check(budgets.WrapUpTimeout > 0, "budgets.wrap_up_timeout must be positive")
+	for name, plan := range budgets.Plans {
+		check(plan.DailyUSD >= 0 && plan.MonthlyUSD >= 0 && plan.DailyTokens >= 0 && plan.MonthlyTokens >= 0,
+			"budgets.plans.%s limits must not be negative", name)
+	}
+	for user, plan := range budgets.Users {
+		_, ok := budgets.Plans[plan]
+		check(ok, "budgets.users.%s has unknown plan %q", user, plan)
+	}
+
+	check(c.Breaker.Threshold > 0, "breaker.threshold must be positive")
+	check(c.Breaker.Cooldown > 0, "breaker.cooldown must be positive")
+
+	switch c.Tracing.Exporter {
+	case ai.TraceExporterNone, ai.TraceExporterStdout, ai.TraceExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter))
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Logging.Level)) == nil, "logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(c.Logging.Format == "text" || c.Logging.Format == "json", "logging.format must be text or json, got %q", c.Logging.Format)
+	check(c.Logging.SampleEvery > 0, "logging.sample_every must be positive")
+
+	check(c.Reload.Interval >= 0, "reload.interval must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// AI returns the settings of the AI side of the service.
+func (c *Config) AI() *ai.Config {
+	config := &ai.Config{
+		Provider: c.Provider,
+		Cascade: ai.CascadeConfig{
+			BaseURL:     c.Cascade.BaseURL,
+			APIKey:      c.Cascade.APIKey,
+			STTBaseURL:  c.Cascade.STTBaseURL,
+			STTModel:    c.Cascade.STTModel,
+			ChatBaseURL: c.Cascade.ChatBaseURL,
+			ChatModel:   c.Cascade.ChatModel,
+			TTSBaseURL:  c.Cascade.TTSBaseURL,
+			TTSModel:    c.Cascade.TTSModel,
+		},
+		RecordDir:      c.Records.CassetteDir,
+		ReplayCassette: c.Replay.Cassette,
+		ReplaySpeed:    c.Replay.Speed,
+		RecordsDir:     c.Records.Dir,
+		Tracing:        ai.TracingConfig{Exporter: c.Tracing.Exporter, Endpoint: c.Tracing.Endpoint},
+		Breaker:        ai.BreakerConfig{Threshold: c.Breaker.Threshold, Cooldown: c.Breaker.Cooldown},
+		Voice:          c.Session.Voice,
+		Temperature:    c.Session.Temperature,
+		TurnDetection: ai.TurnDetection{
+			Type:              c.Session.VAD.Type,
+			Threshold:         unlessZero(c.Session.VAD.Threshold),
+			PrefixPaddingMs:   unlessZero(c.Session.VAD.PrefixPaddingMs),
+			SilenceDurationMs: unlessZero(c.Session.VAD.SilenceDurationMs),
+		},
+		DialTimeout:        c.Timeouts.Dial,
+		SendBuffer:         c.Limits.SendBuffer,
+		MaxMessageBytes:    c.Limits.MaxMessageBytes,
+		MaxSessionDuration: c.Limits.MaxSessionDuration,
+		Prices:             make(ai.PriceTable, len(c.Pricing.Prices)),
+		PricingModel:       c.Pricing.Model,
+	}
+	for model, price := range c.Pricing.Prices {
+		config.Prices[model] = ai.Prices(price)
+	}
+	if gate := c.Session.NoiseGate; gate.Enabled {
+		config.NoiseGate = &vad.Config{
+			Threshold:           gate.Threshold,
+			MaxZeroCrossingRate: gate.MaxZeroCrossingRate,
+			Hangover:            gate.Hangover,
+			PreRoll:             gate.PreRoll,
+		}
+	}
+
+	switch c.Provider {
+	case ai.ProviderAzure:
+		config.APIKey, config.Endpoint = c.Azure.APIKey, c.Azure.Endpoint
+	case ai.ProviderOpenAI:
+		config.APIKey, config.Endpoint = c.OpenAI.APIKey, c.OpenAI.Endpoint
+		if config.Endpoint == "" {
+			config.Endpoint = "wss://api.openai.com/v1/realtime?model=" + c.OpenAI.Model
+		}
+	case ai.ProviderMock:
+		config.Endpoint = c.Mock.Endpoint
+	}
+	return config
+}
+
+// unlessZero returns a pointer to v, or nil if v is zero and so leaves the
+// upstream's default in place.
+func unlessZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+// defaultPrices returns a copy of the built-in prices.
+func defaultPrices() map[string]PriceConfig {
+	prices := make(map[string]PriceConfig, len(ai.DefaultPrices))
+	for model, price := range ai.DefaultPrices {
+		prices[model] = PriceConfig(price)
+	}
+	return prices
+}
+
+// RateLimits returns the session limits enforced before dialing upstream.
+func (c *Config) RateLimits() ratelimit.Config {
+	return ratelimit.Config{
+		MaxSessions:        c.Limits.MaxSessions,
+		MaxSessionsPerUser: c.Limits.MaxSessionsPerUser,
+		MaxSessionsPerIP:   c.Limits.MaxSessionsPerIP,
+		AttemptsPerMinute:  c.Limits.AttemptsPerMinute,
+	}
+}
+
+// Budget returns the budget of user, or nil when it has no limits.
+func (c *Config) Budget(user string) *ai.Budget {
+	b := c.Budgets
+	name, plan := defaultPlan, PlanConfig{DailyUSD: b.DailyUSD, MonthlyUSD: b.MonthlyUSD, DailyTokens: b.DailyTokens, MonthlyTokens: b.MonthlyTokens}
+	if assigned, ok := b.Users[user]; ok {
+		name, plan = assigned, b.Plans[assigned]
+	}
+	if plan == (PlanConfig{}) {
+		return nil
+	}
+	return &ai.Budget{
+		Plan:          name,
+		DailyUSD:      plan.DailyUSD,
+		MonthlyUSD:    plan.MonthlyUSD,
+		DailyTokens:   plan.DailyTokens,
+		MonthlyTokens: plan.MonthlyTokens,
+		WarnAt:        b.WarnAt,
+		WrapUpTimeout: b.WrapUpTimeout,
+	}
+}
+
+// LogConfig returns the settings of the logger.
+func (c *Config) LogConfig() logging.Config {
+	config := logging.Config{JSON: c.Logging.Format == "json", SampleEvery: c.Logging.SampleEvery}
+	config.Level.UnmarshalText([]byte(c.Logging.Level))
+	return config
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"interviews-ai/internal/ai"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": `
+provider: mock
+server:
+  addr: ":7000"
+session:
+  voice: verse
+  temperature: 0.7
+timeouts:
+  drain: 1m
+limits:
+  max_sessions: 10
+`,
+		"config.toml": `
+provider = "mock"
+
+[server]
+addr = ":7000"
+
+[session]
+voice = "verse"
+temperature = 0.7
+
+[timeouts]
+drain = "1m"
+
+[limits]
+max_sessions = 10
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, name, content)
+			t.Setenv("AI_VOICE", "sage")
+			t.Setenv("MAX_SESSIONS", "20")
+
+			config, options, err := Load([]string{"--config", path, "--max-sessions", "30"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if options.File != path {
+				t.Errorf("options.File = %q, want %q", options.File, path)
+			}
+			// defaults < file < env < flags
+			if config.Server.Addr != ":7000" || config.Session.Temperature != 0.7 || config.Timeouts.Drain != time.Minute {
+				t.Errorf("file settings not applied: %+v", config)
+			}
+			if config.Session.Voice != "sage" {
+				t.Errorf("voice = %q, want the env value", config.Session.Voice)
+			}
+			if config.Limits.MaxSessions != 30 {
+				t.Errorf("max sessions = %d, want the flag value", config.Limits.MaxSessions)
+			}
+			if config.Limits.SendBuffer != ai.DefaultSendBuffer || config.Timeouts.Shutdown != 5*time.Second {
+				t.Errorf("defaults not kept: %+v", config)
+			}
+
+			aiConfig := config.AI()
+			if aiConfig.Endpoint != defaultMockEndpoint || aiConfig.Voice != "sage" {
+				t.Errorf("AI() = %+v", aiConfig)
+			}
+			if limits := config.RateLimits(); limits.MaxSessions != 30 {
+				t.Errorf("RateLimits() = %+v", limits)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownSettings(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "provider: mock\nsesion:\n  voice: verse\n",
+		"config.toml": "provider = \"mock\"\n[sesion]\nvoice = \"verse\"\n",
+	} {
+		if _, _, err := Load([]string{"--config", writeFile(t, name, content)}); err == nil {
+			t.Errorf("%s with a misspelled section was accepted", name)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	config := Default()
+	config.Provider = ai.ProviderOpenAI
+	config.Session.Temperature = 2
+	config.Limits.SendBuffer = 0
+	config.Limits.Backend = LimitsBackendRedis
+	config.Logging.Format = "xml"
+	config.Budgets.Users = map[string]string{"alice": "gold"}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("invalid config was accepted")
+	}
+	for _, want := range []string{"openai.api_key", "session.temperature", "limits.send_buffer", "limits.redis_url", "logging.format", "budgets.users.alice"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestBudgetPlans(t *testing.T) {
+	config := Default()
+	if budget := config.Budget("alice"); budget != nil {
+		t.Errorf("default config has a budget: %+v", budget)
+	}
+
+	config.Budgets.DailyUSD = 2
+	config.Budgets.Plans = map[string]PlanConfig{"pro": {MonthlyUSD: 100}, "unlimited": {}}
+	config.Budgets.Users = map[string]string{"bob": "pro", "carol": "unlimited"}
+	if budget := config.Budget("alice"); budget == nil || budget.Plan != "default" || budget.DailyUSD != 2 || budget.WarnAt != ai.DefaultBudgetWarnAt {
+		t.Errorf("budget of a user without a plan = %+v", budget)
+	}
+	if budget := config.Budget("bob"); budget == nil || budget.Plan != "pro" || budget.DailyUSD != 0 || budget.MonthlyUSD != 100 {
+		t.Errorf("budget of a pro user = %+v", budget)
+	}
+	if budget := config.Budget("carol"); budget != nil {
+		t.Errorf("a plan without limits has a budget: %+v", budget)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	config := Default()
+	config.Provider = ai.ProviderAzure
+	config.Azure.APIKey = "sk-secret"
+	config.Azure.Endpoint = "wss://example.openai.azure.com/openai/realtime"
+	config.Admin.Token = "admin-secret"
+
+	var out bytes.Buffer
+	if err := Print(&out, config); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "secret") {
+		t.Errorf("printed config leaks a secret:\n%s", printed)
+	}
+	for _, want := range []string{"api_key: REDACTED", "token: REDACTED", "endpoint: wss://example.openai.azure.com", "drain: 30s"} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("printed config does not contain %q:\n%s", want, printed)
+		}
+	}
+	if config.Azure.APIKey != "sk-secret" {
+		t.Error("Print modified the config")
+	}
+}
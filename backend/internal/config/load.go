@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Options is what Load found on the command line besides the settings.
+type Options struct {
+	// File is the config file that was read, if any.
+	File string
+	// PrintConfig asks to print the configuration and exit.
+	PrintConfig bool
+}
+
+// Load merges the defaults, the config file, the environment and the command line
+// flags in args, and validates the result.
+func Load(args []string) (*Config, Options, error) {
+	config := Default()
+	var options Options
+
+	// flags are parsed first to find the config file, and applied last
+	flags := flag.NewFlagSet("ai-service", flag.ContinueOnError)
+	flags.StringVar(&options.File, "config", "", "YAML or TOML config file (default $CONFIG_FILE)")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	var set []func() error
+	for _, f := range fields(reflect.ValueOf(config).Elem(), "") {
+		name := f.tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		usage := f.tag.Get("usage")
+		if env := f.tag.Get("env"); env != "" {
+			usage += " ($" + env + ")"
+		}
+		flags.Func(name, usage, func(value string) error {
+			// reject bad values now, so the flag package reports them with the usage
+			if err := parseValue(reflect.New(f.value.Type()).Elem(), value); err != nil {
+				return err
+			}
+			set = append(set, func() error { return parseValue(f.value, value) })
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, options, err
+	}
+
+	// a .env file only fills in variables that are not set already
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, options, fmt.Errorf("load .env: %v", err)
+	}
+
+	if options.File == "" {
+		options.File = os.Getenv("CONFIG_FILE")
+	}
+	if options.File != "" {
+		if err := loadFile(config, options.File); err != nil {
+			return nil, options, err
+		}
+	}
+	if err := loadEnv(config, os.Getenv); err != nil {
+		return nil, options, err
+	}
+	for _, apply := range set {
+		if err := apply(); err != nil {
+			return nil, options, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, options, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return config, options, nil
+}
+
+// loadFile reads a YAML or TOML file, chosen by its extension, over config.
+// Settings missing from the file keep their current values.
+func loadFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse %s: %v", path, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), config)
+		if err != nil {
+			return fmt.Errorf("parse %s: %v", path, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parse %s: unknown settings %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// loadEnv sets every setting whose environment variable is set.
+func loadEnv(config *Config, getenv func(string) string) error {
+	for _, f := range fields(reflect.ValueOf(config).Elem(), "") {
+		name := f.tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if value := getenv(name); value != "" {
+			if err := parseValue(f.value, value); err != nil {
+				return fmt.Errorf("%s (%s): %v", name, f.path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// field is one setting of Config.
+type field struct {
+	// path is the setting's name in config files, e.g. server.tls.cert_file.
+	path  string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields lists the settings of a struct, descending into nested sections.
+func fields(v reflect.Value, prefix string) []field {
+	var list []field
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		path := prefix + structField.Tag.Get("yaml")
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct && value.Type() != durationType {
+			list = append(list, fields(value, path+".")...)
+			continue
+		}
+		list = append(list, field{path: path, value: value, tag: structField.Tag})
+	}
+	return list
+}
+
+// parseValue sets v from its text form.
+func parseValue(v reflect.Value, text string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// redacted is shown instead of a secret that is set.
+const redacted = "REDACTED"
+
+// Print writes config as YAML, replacing secrets with REDACTED.
+func Print(w io.Writer, config *Config) error {
+	printed := *config
+	for _, f := range fields(reflect.ValueOf(&printed).Elem(), "") {
+		if f.tag.Get("secret") == "true" && f.value.String() != "" {
+			f.value.SetString(redacted)
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&printed); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,80 @@
+// Package health serves the probes used by container orchestrators:
+//
+//	GET /healthz   the process is alive and its core loops respond
+//	GET /readyz    the service can take new sessions
+//	GET /version   build metadata
+//
+// /healthz and /readyz answer 200 when every check passes and 503 otherwise, with
+// the result of each check in the body.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout bounds each probe when Handler.Timeout is not set.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether one part of the service is healthy.
+type Check func(ctx context.Context) error
+
+// Handler runs Live checks for /healthz and Ready checks for /readyz.
+type Handler struct {
+	Live    map[string]Check
+	Ready   map[string]Check
+	Timeout time.Duration
+}
+
+// Response is the body of /healthz and /readyz.
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Register adds the probes to mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.Live)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.Ready)
+	})
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Build())
+	})
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, checks map[string]Check) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	response := Response{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			response.Checks[name] = err.Error()
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+	writeJSON(w, status, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write health response", "error", err)
+	}
+}
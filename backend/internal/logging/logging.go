@@ -0,0 +1,65 @@
+// Package logging configures the structured logger used by the services.
+//
+// High-frequency events such as audio deltas are only logged once every
+// SampleEvery occurrences per session.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Config selects how logs are written.
+type Config struct {
+	Level slog.Level
+	JSON  bool
+	// SampleEvery logs one in this many high-frequency events; 1 logs them all.
+	SampleEvery int
+}
+
+// DefaultSampleEvery is the default sampling rate of high-frequency events.
+const DefaultSampleEvery = 100
+
+// SampleEvery is the sampling rate of new Samplers, set by Setup.
+var SampleEvery = DefaultSampleEvery
+
+// New returns a logger writing to w.
+func New(w io.Writer, config Config) *slog.Logger {
+	options := &slog.HandlerOptions{Level: config.Level}
+	if config.JSON {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// Setup makes a logger writing to stderr the default, which the standard log
+// package then writes through as well.
+func Setup(config Config) *slog.Logger {
+	logger := New(os.Stderr, config)
+	slog.SetDefault(logger)
+	SampleEvery = max(config.SampleEvery, 1)
+	return logger
+}
+
+// Sampler lets through the first and then every Nth occurrence of each key.
+type Sampler struct {
+	every  uint64
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func NewSampler(every int) *Sampler {
+	return &Sampler{every: uint64(max(every, 1)), counts: make(map[string]uint64)}
+}
+
+// Allow counts an occurrence of key and reports whether it should be logged,
+// along with how many occurrences there have been so far.
+func (s *Sampler) Allow(key string) (bool, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key]++
+	count := s.counts[key]
+	return (count-1)%s.every == 0, count
+}
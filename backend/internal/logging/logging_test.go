@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewWritesJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Config{Level: slog.LevelInfo, JSON: true})
+	logger.Debug("hidden")
+	logger.With("session_id", "SES_1").Info("shown")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("output %q is not a single JSON line: %v", buf.String(), err)
+	}
+	if line["msg"] != "shown" || line["session_id"] != "SES_1" {
+		t.Errorf("line = %v, want the info message with its session_id", line)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	sampler := NewSampler(3)
+	var allowed []uint64
+	for i := 0; i < 7; i++ {
+		if ok, count := sampler.Allow("response.audio.delta"); ok {
+			allowed = append(allowed, count)
+		}
+	}
+	if len(allowed) != 3 || allowed[0] != 1 || allowed[1] != 4 || allowed[2] != 7 {
+		t.Errorf("allowed occurrences %v, want [1 4 7]", allowed)
+	}
+	// keys are sampled independently
+	if ok, _ := sampler.Allow("input_audio_buffer.append"); !ok {
+		t.Error("first occurrence of another key was not allowed")
+	}
+}
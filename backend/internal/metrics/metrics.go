@@ -0,0 +1,154 @@
+// Package metrics defines the Prometheus metrics of the ai-service, served on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ai_service"
+
+// Event directions.
+const (
+	FromClient   = "client"
+	FromUpstream = "upstream"
+)
+
+var (
+	SessionsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_active",
+		Help:      "Sessions registered with the hub.",
+	})
+
+	Upgrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_upgrades_total",
+		Help:      "Browser websocket upgrade attempts by result (accepted or rejected).",
+	}, []string{"result"})
+
+	SessionsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_rejected_total",
+		Help:      "Sessions refused by a limit before dialing upstream, by reason.",
+	}, []string{"reason"})
+
+	LimiterErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "limiter_errors_total",
+		Help:      "Limit checks that failed on a backend error; the session is admitted.",
+	})
+
+	UpstreamDialSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_dial_seconds",
+		Help:      "Time to connect to the realtime upstream and send the initial session.update.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 5, 10},
+	}, []string{"provider"})
+
+	UpstreamDialFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_dial_failures_total",
+		Help:      "Failed connections to the realtime upstream.",
+	}, []string{"provider"})
+
+	Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Realtime events by direction (client or upstream) and type.",
+	}, []string{"direction", "type"})
+
+	SendQueueDepth = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_queue_depth",
+		Help:      "Messages already queued on a Send channel when another is routed to it, by side (client or ai).",
+		Buckets:   []float64{0, 1, 4, 16, 64, 256, 1024},
+	}, []string{"side"})
+
+	DroppedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_messages_total",
+		Help:      "Messages not routed, by reason (full: the session was evicted; closed: the session was closing).",
+	}, []string{"reason"})
+
+	TimeToFirstAudio = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "time_to_first_audio_seconds",
+		Help:      "Time from input_audio_buffer.speech_stopped to the first response.audio.delta.",
+		Buckets:   []float64{.1, .25, .5, .75, 1, 1.5, 2, 3, 5, 10},
+	})
+
+	SuppressedAudioSeconds = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "suppressed_audio_seconds_total",
+		Help:      "Browser audio dropped by the noise gate instead of being sent upstream.",
+	})
+
+	Tokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Tokens used by responses by kind (input_text, cached_text, input_audio, cached_audio, output_text or output_audio).",
+	}, []string{"kind"})
+
+	CostUSD = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_usd_total",
+		Help:      "Cost of the tokens used by responses, in USD, for models with prices.",
+	})
+
+	BudgetEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "budget_events_total",
+		Help:      "User budget events by kind (warning, exceeded or rejected).",
+	}, []string{"event"})
+
+	ConfigReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Reloads of the config file and templates by result (success or failure).",
+	}, []string{"result"})
+
+	ConfigLastReloadSuccessful = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last config reload succeeded (1) or was rejected (0).",
+	})
+)
+
+// clientEventTypes are the event types a browser may send. Anything else is counted
+// as "other" so clients cannot create arbitrary label values.
+var clientEventTypes = map[string]bool{
+	"session.update":            true,
+	"session.configure":         true,
+	"input_audio_buffer.append": true,
+	"input_audio_buffer.commit": true,
+	"input_audio_buffer.clear":  true,
+	"conversation.item.create":  true,
+	"response.create":           true,
+	"response.cancel":           true,
+	"editor.patch":              true,
+	"ptt.start":                 true,
+	"ptt.stop":                  true,
+}
+
+// maxEventTypeLen bounds upstream event type labels.
+const maxEventTypeLen = 64
+
+// CountEvent counts an event seen in the given direction.
+func CountEvent(direction string, eventType string) {
+	switch {
+	case direction == FromClient && !clientEventTypes[eventType]:
+		eventType = "other"
+	case len(eventType) > maxEventTypeLen:
+		eventType = "other"
+	}
+	Events.WithLabelValues(direction, eventType).Inc()
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps the counters in memory, so the limits apply to one instance.
+type MemoryBackend struct {
+	mu sync.Mutex
+	// holders maps each key to the expiry of each of its holders.
+	holders map[string]map[string]time.Time
+	windows map[string]*window
+	swept   time.Time
+	now     func() time.Time
+}
+
+type window struct {
+	end   time.Time
+	count int
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		holders: make(map[string]map[string]time.Time),
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+func (b *MemoryBackend) Acquire(_ context.Context, key string, id string, max int, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	holders := b.holders[key]
+	if holders == nil {
+		holders = make(map[string]time.Time)
+		b.holders[key] = holders
+	}
+	for holder, expiry := range holders {
+		if !now.Before(expiry) {
+			delete(holders, holder)
+		}
+	}
+	if _, ok := holders[id]; !ok && len(holders) >= max {
+		return false, nil
+	}
+	holders[id] = now.Add(ttl)
+	return true, nil
+}
+
+func (b *MemoryBackend) Release(_ context.Context, key string, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.holders[key], id)
+	if len(b.holders[key]) == 0 {
+		delete(b.holders, key)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Hit(_ context.Context, key string, max int, length time.Duration) (bool, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	// windows are kept per client IP, so ended ones are swept out now and then
+	if now.Sub(b.swept) >= length {
+		for k, w := range b.windows {
+			if !now.Before(w.end) {
+				delete(b.windows, k)
+			}
+		}
+		b.swept = now
+	}
+
+	w := b.windows[key]
+	if w == nil || !now.Before(w.end) {
+		w = &window{end: now.Add(length)}
+		b.windows[key] = w
+	}
+	w.count++
+	if w.count > max {
+		return false, w.end.Sub(now), nil
+	}
+	return true, 0, nil
+}
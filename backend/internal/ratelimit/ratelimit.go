@@ -0,0 +1,193 @@
+// Package ratelimit enforces how many sessions may run at once and how often new
+// ones may be started.
+//
+// The counters live in a Backend: in memory for a single instance, or in Redis (or
+// anything speaking its protocol) to share the limits between instances.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Backend stores the counters behind the limits.
+type Backend interface {
+	// Acquire adds id to the holders of key, unless max already hold it. Holders
+	// expire after ttl, so the slots of a process that died are eventually freed.
+	Acquire(ctx context.Context, key string, id string, max int, ttl time.Duration) (bool, error)
+	// Release removes id from the holders of key.
+	Release(ctx context.Context, key string, id string) error
+	// Hit counts an attempt against key, allowing max per window. When over the
+	// limit, it returns how long until the window ends.
+	Hit(ctx context.Context, key string, max int, window time.Duration) (bool, time.Duration, error)
+}
+
+// Rejection reasons.
+const (
+	ReasonRateLimited  = "rate_limited"
+	ReasonUserSessions = "too_many_user_sessions"
+	ReasonIPSessions   = "too_many_ip_sessions"
+	ReasonSessions     = "too_many_sessions"
+)
+
+// Rejection is returned by Admit when a limit is reached.
+type Rejection struct {
+	Reason string
+	// RetryAfter is how long until the attempt may succeed, when known.
+	RetryAfter time.Duration
+}
+
+func (r *Rejection) Error() string {
+	switch r.Reason {
+	case ReasonRateLimited:
+		return fmt.Sprintf("too many connection attempts, retry in %s", r.RetryAfter.Round(time.Second))
+	case ReasonUserSessions:
+		return "too many concurrent sessions for this user"
+	case ReasonIPSessions:
+		return "too many concurrent sessions from this address"
+	default:
+		return "too many concurrent sessions"
+	}
+}
+
+// DefaultSessionTTL bounds how long the slots of a session outlive an instance that
+// dies without releasing them. Live sessions renew theirs.
+const DefaultSessionTTL = 2 * time.Minute
+
+// attemptWindow is the window of Config.AttemptsPerMinute.
+const attemptWindow = time.Minute
+
+// Config sets the limits; zero means no limit.
+type Config struct {
+	// MaxSessions limits concurrent sessions across every instance sharing the backend.
+	MaxSessions int
+	// MaxSessionsPerUser limits concurrent sessions of one user.
+	MaxSessionsPerUser int
+	// MaxSessionsPerIP limits concurrent sessions from one client IP, which holds
+	// however users name themselves.
+	MaxSessionsPerIP int
+	// AttemptsPerMinute limits connection attempts of one user, and from one client IP.
+	AttemptsPerMinute int
+	// SessionTTL is how long a slot is held if it is never released, DefaultSessionTTL
+	// if zero. Slots are renewed every third of it until released.
+	SessionTTL time.Duration
+}
+
+// Limiter admits sessions under a Config.
+type Limiter struct {
+	backend Backend
+	config  Config
+}
+
+func New(backend Backend, config Config) *Limiter {
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = DefaultSessionTTL
+	}
+	return &Limiter{backend: backend, config: config}
+}
+
+// Admit checks a session of user, connecting from ip, against the limits. The
+// returned release frees its slots and must be called once the session ends. A
+// *Rejection is returned when a limit is reached, or the backend's error.
+func (l *Limiter) Admit(ctx context.Context, id string, user string, ip string) (func(), error) {
+	if n := l.config.AttemptsPerMinute; n > 0 {
+		for _, key := range []string{"attempts:ip:" + ip, "attempts:user:" + user} {
+			ok, retryAfter, err := l.backend.Hit(ctx, key, n, attemptWindow)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, &Rejection{Reason: ReasonRateLimited, RetryAfter: retryAfter}
+			}
+		}
+	}
+
+	var acquired []slot
+	releaseSlots := func() {
+		// the request context may be gone by the time the session ends
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, slot := range acquired {
+			l.backend.Release(ctx, slot.key, id)
+		}
+	}
+	for _, slot := range []struct {
+		slot
+		reason string
+	}{
+		{slot{"sessions:user:" + user, l.config.MaxSessionsPerUser}, ReasonUserSessions},
+		{slot{"sessions:ip:" + ip, l.config.MaxSessionsPerIP}, ReasonIPSessions},
+		{slot{"sessions", l.config.MaxSessions}, ReasonSessions},
+	} {
+		if slot.max <= 0 {
+			continue
+		}
+		ok, err := l.backend.Acquire(ctx, slot.key, id, slot.max, l.config.SessionTTL)
+		if err == nil && !ok {
+			err = &Rejection{Reason: slot.reason}
+		}
+		if err != nil {
+			releaseSlots()
+			return nil, err
+		}
+		acquired = append(acquired, slot.slot)
+	}
+	if len(acquired) == 0 {
+		return func() {}, nil
+	}
+
+	// the slots expire only if this instance dies without releasing them
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(l.config.SessionTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.renew(id, acquired)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			releaseSlots()
+		})
+	}, nil
+}
+
+// slot is a key whose holders are limited to max.
+type slot struct {
+	key string
+	max int
+}
+
+// renew pushes back the expiry of the slots a session holds.
+func (l *Limiter) renew(id string, slots []slot) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, slot := range slots {
+		ok, err := l.backend.Acquire(ctx, slot.key, id, slot.max, l.config.SessionTTL)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to renew session slot", "session_id", id, "key", slot.key, "error", err)
+		case !ok:
+			// it expired while the backend was unreachable and was taken since
+			slog.Warn("Session slot was lost", "session_id", id, "key", slot.key)
+		}
+	}
+}
+
+// IsRejection reports whether err is a *Rejection, and returns it.
+func IsRejection(err error) (*Rejection, bool) {
+	var rejection *Rejection
+	ok := errors.As(err, &rejection)
+	return rejection, ok
+}
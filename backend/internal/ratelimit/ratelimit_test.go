@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// backends returns each backend along with a function that moves its clock forward.
+func backends(t *testing.T) map[string]func() (Backend, func(time.Duration)) {
+	return map[string]func() (Backend, func(time.Duration)){
+		"memory": func() (Backend, func(time.Duration)) {
+			backend := NewMemoryBackend()
+			now := time.Now()
+			backend.now = func() time.Time { return now }
+			return backend, func(d time.Duration) { now = now.Add(d) }
+		},
+		"redis": func() (Backend, func(time.Duration)) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { client.Close() })
+			backend := NewRedisBackend(client)
+			now := time.Now()
+			backend.now = func() time.Time { return now }
+			return backend, func(d time.Duration) {
+				now = now.Add(d)
+				server.FastForward(d)
+			}
+		},
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend, advance := newBackend()
+			limiter := New(backend, Config{MaxSessions: 3, MaxSessionsPerUser: 2, SessionTTL: time.Hour})
+
+			release1, err := limiter.Admit(ctx, "s1", "alice", "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := limiter.Admit(ctx, "s2", "alice", "10.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+			_, err = limiter.Admit(ctx, "s3", "alice", "10.0.0.1")
+			if rejection, ok := IsRejection(err); !ok || rejection.Reason != ReasonUserSessions {
+				t.Fatalf("third session of alice: err = %v, want %s", err, ReasonUserSessions)
+			}
+
+			if _, err := limiter.Admit(ctx, "s4", "bob", "10.0.0.2"); err != nil {
+				t.Fatal(err)
+			}
+			_, err = limiter.Admit(ctx, "s5", "carol", "10.0.0.3")
+			if rejection, ok := IsRejection(err); !ok || rejection.Reason != ReasonSessions {
+				t.Fatalf("fourth session: err = %v, want %s", err, ReasonSessions)
+			}
+			// carol's rejected session must not hold her user slot
+			release1()
+			if _, err := limiter.Admit(ctx, "s6", "carol", "10.0.0.3"); err != nil {
+				t.Fatalf("session after a release: %v", err)
+			}
+
+			// slots that are never released expire
+			advance(time.Hour)
+			if _, err := limiter.Admit(ctx, "s7", "alice", "10.0.0.1"); err != nil {
+				t.Fatalf("session after the slots expired: %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiterPerIP(t *testing.T) {
+	ctx := context.Background()
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend, _ := newBackend()
+			limiter := New(backend, Config{MaxSessionsPerUser: 1, MaxSessionsPerIP: 2})
+
+			// a client naming itself anew for each session still has one IP
+			for i, user := range []string{"mallory-1", "mallory-2"} {
+				if _, err := limiter.Admit(ctx, fmt.Sprintf("s%d", i), user, "10.0.0.1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := limiter.Admit(ctx, "s3", "mallory-3", "10.0.0.1")
+			if rejection, ok := IsRejection(err); !ok || rejection.Reason != ReasonIPSessions {
+				t.Fatalf("third session from the IP: err = %v, want %s", err, ReasonIPSessions)
+			}
+			if _, err := limiter.Admit(ctx, "s4", "alice", "10.0.0.2"); err != nil {
+				t.Fatalf("session from another IP: %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiterRenewsSlots(t *testing.T) {
+	ctx := context.Background()
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend, advance := newBackend()
+			limiter := New(backend, Config{MaxSessions: 1, SessionTTL: time.Minute})
+			release, err := limiter.Admit(ctx, "s1", "alice", "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			// a session running longer than the TTL keeps its slot
+			for i := 0; i < 10; i++ {
+				advance(time.Minute / 3)
+				limiter.renew("s1", []slot{{"sessions", 1}})
+			}
+			_, err = limiter.Admit(ctx, "s2", "bob", "10.0.0.2")
+			if rejection, ok := IsRejection(err); !ok || rejection.Reason != ReasonSessions {
+				t.Fatalf("session beside a renewed one: err = %v, want %s", err, ReasonSessions)
+			}
+
+			// one that is no longer renewed loses it
+			advance(time.Minute)
+			if _, err := limiter.Admit(ctx, "s3", "bob", "10.0.0.2"); err != nil {
+				t.Fatalf("session after the slot expired: %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiterAttempts(t *testing.T) {
+	ctx := context.Background()
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend, advance := newBackend()
+			limiter := New(backend, Config{AttemptsPerMinute: 2})
+
+			for i := 0; i < 2; i++ {
+				if _, err := limiter.Admit(ctx, "s", "alice", "10.0.0.1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := limiter.Admit(ctx, "s", "alice", "10.0.0.2")
+			rejection, ok := IsRejection(err)
+			if !ok || rejection.Reason != ReasonRateLimited {
+				t.Fatalf("third attempt of alice: err = %v, want %s", err, ReasonRateLimited)
+			}
+			if rejection.RetryAfter <= 0 || rejection.RetryAfter > time.Minute {
+				t.Errorf("RetryAfter = %s, want within a minute", rejection.RetryAfter)
+			}
+			// the IP is limited whoever connects from it
+			if _, err := limiter.Admit(ctx, "s", "bob", "10.0.0.1"); err == nil {
+				t.Error("third attempt from 10.0.0.1 was admitted")
+			}
+
+			advance(time.Minute)
+			if _, err := limiter.Admit(ctx, "s", "alice", "10.0.0.1"); err != nil {
+				t.Fatalf("attempt after the window: %v", err)
+			}
+		})
+	}
+}
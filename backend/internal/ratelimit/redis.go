@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyPrefix is put before every key the RedisBackend uses.
+const KeyPrefix = "interviews-ai:limits:"
+
+// acquireScript keeps the holders of a key in a sorted set scored by their expiry.
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) and redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+local ttl = tonumber(ARGV[4])
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[1])
+if redis.call('PTTL', KEYS[1]) < ttl then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// hitScript counts attempts in fixed windows, returning whether the attempt is
+// allowed and the milliseconds left in the window.
+var hitScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if count > tonumber(ARGV[1]) then
+	return {0, redis.call('PTTL', KEYS[1])}
+end
+return {1, 0}
+`)
+
+// RedisBackend keeps the counters in Redis, or a server compatible with it, so
+// every instance using it shares the limits.
+type RedisBackend struct {
+	client redis.UniversalClient
+	now    func() time.Time
+}
+
+func NewRedisBackend(client redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{client: client, now: time.Now}
+}
+
+// OpenRedisBackend connects to the server at url, such as redis://:password@host:6379/0.
+func OpenRedisBackend(url string) (*RedisBackend, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisBackend(redis.NewClient(options)), nil
+}
+
+func (b *RedisBackend) Acquire(ctx context.Context, key string, id string, max int, ttl time.Duration) (bool, error) {
+	ok, err := acquireScript.Run(ctx, b.client, []string{KeyPrefix + key}, id, max, b.now().UnixMilli(), ttl.Milliseconds()).Int()
+	return ok == 1, err
+}
+
+func (b *RedisBackend) Release(ctx context.Context, key string, id string) error {
+	return b.client.ZRem(ctx, KeyPrefix+key, id).Err()
+}
+
+func (b *RedisBackend) Hit(ctx context.Context, key string, max int, window time.Duration) (bool, time.Duration, error) {
+	result, err := hitScript.Run(ctx, b.client, []string{KeyPrefix + key}, max, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// Ping checks the connection to the server.
+func (b *RedisBackend) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
+
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}